@@ -0,0 +1,182 @@
+package tt_pay
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/liaoxxxx/tt_pay/config"
+)
+
+// DefaultBatchConcurrency 批量查询的默认并发数
+const DefaultBatchConcurrency = 8
+
+// BatchOptions 为批量查询的参数
+type BatchOptions struct {
+	Concurrency int     // 并发数，<=0时使用DefaultBatchConcurrency
+	QPS         float64 // 客户端每秒请求数上限，<=0表示不限制
+}
+
+// QueryKey 标识一笔待查询的订单、退款或提现
+type QueryKey struct {
+	Uid     string // 订单、退款查询必传，提现查询忽略
+	OutNo   string // out_order_no、out_refund_no或out_trade_no
+	TradeNo string // trade_no、refund_no或withdraw_trade_no，OutNo为空时使用
+}
+
+// TradeQueryResult 为单笔订单的查询结果
+type TradeQueryResult struct {
+	Key  QueryKey
+	Resp *TradeQueryResponse
+	Err  error
+}
+
+// RefundQueryResult 为单笔退款的查询结果
+type RefundQueryResult struct {
+	Key  QueryKey
+	Resp *RefundQueryResponse
+	Err  error
+}
+
+// WithdrawQueryResult 为单笔提现的查询结果
+type WithdrawQueryResult struct {
+	Key  QueryKey
+	Resp *WithdrawQueryResponse
+	Err  error
+}
+
+// BatchTradeQuery 批量查询订单，结果与keys顺序一致
+// ctx取消后，尚未发出的查询不再执行，其Err为ctx.Err()
+func BatchTradeQuery(ctx context.Context, config config.Config, keys []QueryKey, opts BatchOptions) []TradeQueryResult {
+	ret := make([]TradeQueryResult, len(keys))
+	runBatch(ctx, len(keys), opts, func(ctx context.Context, i int, err error) {
+		ret[i].Key = keys[i]
+		if err != nil {
+			ret[i].Err = err
+			return
+		}
+		req := NewTradeQueryRequest(config)
+		req.Uid = keys[i].Uid
+		req.OutOrderNo = keys[i].OutNo
+		req.TradeNo = keys[i].TradeNo
+		ret[i].Resp, ret[i].Err = TradeQuery(ctx, req)
+	})
+	return ret
+}
+
+// BatchRefundQuery 批量查询退款，结果与keys顺序一致
+// ctx取消后，尚未发出的查询不再执行，其Err为ctx.Err()
+func BatchRefundQuery(ctx context.Context, config config.Config, keys []QueryKey, opts BatchOptions) []RefundQueryResult {
+	ret := make([]RefundQueryResult, len(keys))
+	runBatch(ctx, len(keys), opts, func(ctx context.Context, i int, err error) {
+		ret[i].Key = keys[i]
+		if err != nil {
+			ret[i].Err = err
+			return
+		}
+		req := NewRefundQueryRequest(config)
+		req.Uid = keys[i].Uid
+		req.OutRefundNo = keys[i].OutNo
+		req.RefundNo = keys[i].TradeNo
+		ret[i].Resp, ret[i].Err = RefundQuery(ctx, req)
+	})
+	return ret
+}
+
+// BatchWithdrawQuery 批量查询提现，结果与keys顺序一致
+// ctx取消后，尚未发出的查询不再执行，其Err为ctx.Err()
+func BatchWithdrawQuery(ctx context.Context, config config.Config, keys []QueryKey, opts BatchOptions) []WithdrawQueryResult {
+	ret := make([]WithdrawQueryResult, len(keys))
+	runBatch(ctx, len(keys), opts, func(ctx context.Context, i int, err error) {
+		ret[i].Key = keys[i]
+		if err != nil {
+			ret[i].Err = err
+			return
+		}
+		req := NewWithdrawQueryRequest(config)
+		req.OutTradeNo = keys[i].OutNo
+		req.WithdrawTradeNo = keys[i].TradeNo
+		ret[i].Resp, ret[i].Err = WithdrawQuery(ctx, req)
+	})
+	return ret
+}
+
+// 以opts限制的并发与QPS对0..n-1依次调用f，全部完成后返回
+// 未能执行的项（ctx已取消）以ctx.Err()调用f
+func runBatch(ctx context.Context, n int, opts BatchOptions, f func(ctx context.Context, i int, err error)) {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultBatchConcurrency
+	}
+	if concurrency > n {
+		concurrency = n
+	}
+	limiter := newIntervalLimiter(opts.QPS)
+
+	items := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range items {
+				if err := limiter.Wait(ctx); err != nil {
+					f(ctx, i, err)
+					continue
+				}
+				f(ctx, i, nil)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		items <- i
+	}
+	close(items)
+	wg.Wait()
+}
+
+// 按固定间隔放行请求的限流器，用于客户端QPS限制
+type intervalLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// qps<=0时返回nil，nil限流器不限制
+func newIntervalLimiter(qps float64) *intervalLimiter {
+	if qps <= 0 {
+		return nil
+	}
+	return &intervalLimiter{interval: time.Duration(float64(time.Second) / qps)}
+}
+
+// Wait 等待下一个可用时间点，ctx取消时返回ctx.Err()
+func (l *intervalLimiter) Wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+
+	wait := time.Until(at)
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,133 @@
+package tt_pay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/liaoxxxx/tt_pay/util"
+)
+
+// 订单查询网关桩，out_order_no为missing时返回订单不存在，记录最大并发数
+type batchGateway struct {
+	mu       sync.Mutex
+	inFlight int
+	max      int
+	calls    int
+	delay    time.Duration
+	onCall   func()
+}
+
+func newBatchGateway(t *testing.T, delay time.Duration) (*batchGateway, *httptest.Server) {
+	t.Helper()
+	g := &batchGateway{delay: delay}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g.mu.Lock()
+		g.calls++
+		g.inFlight++
+		if g.inFlight > g.max {
+			g.max = g.inFlight
+		}
+		if g.onCall != nil {
+			g.onCall()
+		}
+		g.mu.Unlock()
+		time.Sleep(g.delay)
+		g.mu.Lock()
+		g.inFlight--
+		g.mu.Unlock()
+
+		var biz map[string]string
+		json.Unmarshal([]byte(r.FormValue("biz_content")), &biz)
+		if biz["out_order_no"] == "missing" {
+			w.Write([]byte(`{"response":{"code":"40004","msg":"Business Failed","sub_code":"TP.TRADE_NOT_EXIST"}}`))
+			return
+		}
+		w.Write([]byte(`{"response":{"code":"10000","msg":"Success","out_order_no":"` + biz["out_order_no"] + `"}}`))
+	}))
+	t.Cleanup(ts.Close)
+	return g, ts
+}
+
+func TestBatchTradeQuery(t *testing.T) {
+	registerTestSubCodes(t)
+	g, ts := newBatchGateway(t, 20*time.Millisecond)
+	keys := []QueryKey{
+		{Uid: testUid, OutNo: "order_1"},
+		{Uid: testUid, OutNo: "missing"},
+		{Uid: testUid, OutNo: "order_3"},
+		{Uid: testUid, OutNo: "order_4"},
+		{Uid: testUid, OutNo: "order_5"},
+		{Uid: testUid},
+	}
+	results := BatchTradeQuery(context.Background(), testConfig(ts.URL), keys, BatchOptions{Concurrency: 2})
+	if len(results) != len(keys) {
+		t.Fatalf("expected %d results, got %d", len(keys), len(results))
+	}
+	for i, r := range results {
+		if r.Key != keys[i] {
+			t.Errorf("result %d: unexpected key %+v", i, r.Key)
+		}
+		switch i {
+		case 1:
+			if !errors.Is(r.Err, util.ErrOrderNotExist) {
+				t.Errorf("result %d: expected ErrOrderNotExist, got %v", i, r.Err)
+			}
+		case 5:
+			if !errors.Is(r.Err, util.ErrInvalidParam) {
+				t.Errorf("result %d: expected ErrInvalidParam, got %v", i, r.Err)
+			}
+		default:
+			if r.Err != nil || r.Resp.OutOrderNo != keys[i].OutNo {
+				t.Errorf("result %d: unexpected %+v %v", i, r.Resp, r.Err)
+			}
+		}
+	}
+	if g.max > 2 {
+		t.Errorf("concurrency limit exceeded: %d", g.max)
+	}
+}
+
+func TestBatchQueryQPS(t *testing.T) {
+	_, ts := newBatchGateway(t, 0)
+	keys := make([]QueryKey, 5)
+	for i := range keys {
+		keys[i] = QueryKey{OutNo: "w_1"}
+	}
+	start := time.Now()
+	for _, r := range BatchWithdrawQuery(context.Background(), testConfig(ts.URL), keys, BatchOptions{Concurrency: 5, QPS: 50}) {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+	}
+	// 50 QPS下5个请求至少间隔4个20ms
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("QPS limit not applied, took %v", elapsed)
+	}
+}
+
+func TestBatchQueryCancel(t *testing.T) {
+	g, ts := newBatchGateway(t, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// 第一个请求到达时取消，其余请求不再发出
+	g.onCall = cancel
+	keys := make([]QueryKey, 4)
+	for i := range keys {
+		keys[i] = QueryKey{Uid: testUid, OutNo: "refund_1"}
+	}
+	results := BatchRefundQuery(ctx, testConfig(ts.URL), keys, BatchOptions{Concurrency: 1})
+	for i, r := range results[1:] {
+		if !errors.Is(r.Err, context.Canceled) || r.Key != keys[i+1] {
+			t.Errorf("result %d: expected context.Canceled, got %v", i+1, r.Err)
+		}
+	}
+	if g.calls != 1 {
+		t.Errorf("expected 1 call before cancel, got %d", g.calls)
+	}
+}
@@ -0,0 +1,194 @@
+package tt_pay
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/liaoxxxx/tt_pay/util"
+)
+
+// BreakerState 为熔断器状态
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // 闭合，请求正常发出
+	BreakerOpen                         // 断开，请求直接失败
+	BreakerHalfOpen                     // 半开，放行少量探测请求
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half_open"
+	}
+	return "unknown"
+}
+
+// ErrCircuitOpen 熔断器断开，请求未发出
+var ErrCircuitOpen = errors.New("tt_pay: circuit breaker is open")
+
+// CircuitOpenError 熔断器断开时Execute返回的错误，请求未发出，可以安全重试
+// errors.Is可匹配ErrCircuitOpen、util.ErrRetryable及util.ErrNotSent
+type CircuitOpenError struct {
+	Host       string
+	RetryAfter time.Duration // 距离进入半开状态的时长
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("tt_pay: circuit breaker for %s is open, retry after %v", e.Host, e.RetryAfter)
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen || target == util.ErrRetryable || target == util.ErrNotSent
+}
+
+// BreakerConfig 为熔断器参数，零值字段使用默认值
+type BreakerConfig struct {
+	FailureThreshold int           // 连续失败多少次后断开，默认5
+	OpenTimeout      time.Duration // 断开多久后进入半开，默认30s
+	HalfOpenRequests int           // 半开时放行的探测请求数，全部成功后闭合，默认1
+}
+
+// CircuitBreaker 按网关域名分别熔断，只统计网络错误及5xx响应，业务失败（util.Error）视为成功
+type CircuitBreaker struct {
+	config BreakerConfig
+	now    func() time.Time
+
+	mu       sync.Mutex
+	circuits map[string]*circuit // host
+}
+
+type circuit struct {
+	state      BreakerState
+	generation uint64 // 每次状态切换加一，用于忽略切换前放行的请求结果
+	failures   int
+	openedAt   time.Time
+	probes     int // 半开时已放行的探测请求数
+	successes  int // 半开时已成功的探测请求数
+}
+
+// NewCircuitBreaker 初始化CircuitBreaker
+func NewCircuitBreaker(config BreakerConfig) *CircuitBreaker {
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = 5
+	}
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = 30 * time.Second
+	}
+	if config.HalfOpenRequests <= 0 {
+		config.HalfOpenRequests = 1
+	}
+	return &CircuitBreaker{
+		config:   config,
+		now:      time.Now,
+		circuits: make(map[string]*circuit),
+	}
+}
+
+var circuitBreaker *CircuitBreaker
+
+// SetCircuitBreaker 设置Execute使用的熔断器，传nil则关闭
+func SetCircuitBreaker(b *CircuitBreaker) {
+	circuitBreaker = b
+}
+
+// State 返回host当前的状态
+func (b *CircuitBreaker) State(host string) BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := b.circuits[host]
+	if !ok {
+		return BreakerClosed
+	}
+	b.advance(c)
+	return c.state
+}
+
+// 断开超时后进入半开，调用方需持有锁
+func (b *CircuitBreaker) advance(c *circuit) {
+	if c.state == BreakerOpen && !b.now().Before(c.openedAt.Add(b.config.OpenTimeout)) {
+		b.setState(c, BreakerHalfOpen)
+		c.probes, c.successes = 0, 0
+	}
+}
+
+// 切换状态，调用方需持有锁
+func (b *CircuitBreaker) setState(c *circuit, state BreakerState) {
+	c.state = state
+	c.generation++
+}
+
+// 判断是否放行请求，放行后调用方必须以返回的generation调用done
+func (b *CircuitBreaker) allow(host string) (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := b.circuits[host]
+	if !ok {
+		c = &circuit{}
+		b.circuits[host] = c
+	}
+	b.advance(c)
+	switch c.state {
+	case BreakerOpen:
+		return 0, &CircuitOpenError{Host: host, RetryAfter: c.openedAt.Add(b.config.OpenTimeout).Sub(b.now())}
+	case BreakerHalfOpen:
+		if c.probes >= b.config.HalfOpenRequests {
+			return 0, &CircuitOpenError{Host: host}
+		}
+		c.probes++
+	}
+	return c.generation, nil
+}
+
+// 记录请求结果，放行后状态已切换的请求不计入统计
+func (b *CircuitBreaker) done(host string, generation uint64, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuits[host]
+	if c.generation != generation {
+		return
+	}
+	switch c.state {
+	case BreakerClosed:
+		if !failed {
+			c.failures = 0
+			return
+		}
+		c.failures++
+		if c.failures >= b.config.FailureThreshold {
+			b.open(c)
+		}
+	case BreakerHalfOpen:
+		if failed {
+			b.open(c)
+			return
+		}
+		c.successes++
+		if c.successes >= b.config.HalfOpenRequests {
+			b.setState(c, BreakerClosed)
+			c.failures = 0
+		}
+	}
+}
+
+func (b *CircuitBreaker) open(c *circuit) {
+	b.setState(c, BreakerOpen)
+	c.openedAt = b.now()
+	c.failures = 0
+}
+
+// 提取url中的域名，熔断按域名区分
+func urlHost(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return rawUrl
+	}
+	return u.Host
+}
@@ -0,0 +1,151 @@
+package tt_pay
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/liaoxxxx/tt_pay/util"
+)
+
+// 可手动推进的时钟
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.t }
+
+func (c *fakeClock) Advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestBreaker(config BreakerConfig) (*CircuitBreaker, *fakeClock) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	b := NewCircuitBreaker(config)
+	b.now = clock.Now
+	return b, clock
+}
+
+func TestCircuitBreakerStates(t *testing.T) {
+	b, clock := newTestBreaker(BreakerConfig{FailureThreshold: 3, OpenTimeout: 10 * time.Second, HalfOpenRequests: 2})
+	const host = "tp-pay.snssdk.com"
+
+	// 成功会重置连续失败计数
+	for _, failed := range []bool{true, true, false, true, true} {
+		gen, err := b.allow(host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.done(host, gen, failed)
+	}
+	if s := b.State(host); s != BreakerClosed {
+		t.Fatalf("expected closed, got %s", s)
+	}
+	stale, _ := b.allow(host)
+	gen, _ := b.allow(host)
+	b.done(host, gen, true)
+	if s := b.State(host); s != BreakerOpen {
+		t.Fatalf("expected open, got %s", s)
+	}
+
+	clock.Advance(4 * time.Second)
+	var openErr *CircuitOpenError
+	if _, err := b.allow(host); !errors.As(err, &openErr) || openErr.RetryAfter != 6*time.Second {
+		t.Fatalf("expected CircuitOpenError, got %v", err)
+	}
+	if b.State("other.example.com") != BreakerClosed {
+		t.Error("hosts must not share state")
+	}
+
+	// 半开：放行2个探测请求，探测失败重新断开
+	clock.Advance(6 * time.Second)
+	if s := b.State(host); s != BreakerHalfOpen {
+		t.Fatalf("expected half_open, got %s", s)
+	}
+	probe, _ := b.allow(host)
+	b.allow(host)
+	if _, err := b.allow(host); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected probe limit, got %v", err)
+	}
+	// 断开前放行的请求结果不影响半开状态
+	b.done(host, stale, true)
+	if s := b.State(host); s != BreakerHalfOpen {
+		t.Fatalf("expected half_open after stale result, got %s", s)
+	}
+	b.done(host, probe, false)
+	b.done(host, probe, true)
+	if s := b.State(host); s != BreakerOpen {
+		t.Fatalf("expected open after failed probe, got %s", s)
+	}
+
+	// 上一轮半开放行的探测不占用本轮名额，全部探测成功后闭合
+	clock.Advance(10 * time.Second)
+	gens := make([]uint64, 2)
+	for i := range gens {
+		var err error
+		if gens[i], err = b.allow(host); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b.done(host, probe, false)
+	b.done(host, gens[0], false)
+	if s := b.State(host); s != BreakerHalfOpen {
+		t.Fatalf("expected half_open, got %s", s)
+	}
+	b.done(host, gens[1], false)
+	if s := b.State(host); s != BreakerClosed {
+		t.Fatalf("expected closed, got %s", s)
+	}
+	// 闭合后迟到的探测结果同样忽略
+	b.done(host, probe, true)
+	if s := b.State(host); s != BreakerClosed {
+		t.Fatalf("expected closed, got %s", s)
+	}
+}
+
+func TestCircuitBreakerExecute(t *testing.T) {
+	b, _ := newTestBreaker(BreakerConfig{FailureThreshold: 2})
+	SetCircuitBreaker(b)
+	defer SetCircuitBreaker(nil)
+
+	calls := 0
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(status)
+		if status != http.StatusOK {
+			w.Write([]byte("<html>bad gateway</html>"))
+			return
+		}
+		w.Write([]byte(`{"response":{"code":"40004","msg":"Business Failed","sub_code":"TP.TRADE_NOT_EXIST"}}`))
+	}))
+	defer ts.Close()
+	query := func() error {
+		req := NewTradeQueryRequest(testConfig(ts.URL))
+		req.Uid = testUid
+		req.OutOrderNo = "order_1"
+		_, err := TradeQuery(context.Background(), req)
+		return err
+	}
+
+	// 业务失败不触发熔断
+	for i := 0; i < 3; i++ {
+		if err := query(); !errors.Is(err, util.ErrBusiness) {
+			t.Fatalf("expected business error, got %v", err)
+		}
+	}
+
+	status = http.StatusBadGateway
+	for i := 0; i < 2; i++ {
+		if err := query(); !errors.Is(err, util.ErrNetwork) {
+			t.Fatalf("expected network error, got %v", err)
+		}
+	}
+	if err := query(); !errors.Is(err, ErrCircuitOpen) || !util.IsRetryable(err) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+	if calls != 5 {
+		t.Errorf("open circuit must not send requests, got %d calls", calls)
+	}
+}
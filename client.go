@@ -2,15 +2,19 @@ package tt_pay
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	simplejson "github.com/bitly/go-simplejson"
+	"github.com/liaoxxxx/tt_pay/tracing"
 	"github.com/liaoxxxx/tt_pay/util"
 )
 
@@ -42,6 +46,52 @@ type TPRequest interface {
 	GetLogId() string
 }
 
+// 网关公共参数
+type gatewayParams struct {
+	AppId     string
+	AppSecret string
+	Method    string
+	Format    string
+	Charset   string
+	SignType  string
+	Timestamp string
+	Version   string
+}
+
+// 实现该接口的Request可由Execute分阶段编码，便于分别追踪编码与加签
+type stagedRequest interface {
+	encodeBizContent() (string, error)
+	gatewayParams() gatewayParams
+}
+
+// 对公共参数及biz_content加签，返回URL Encode后的POST请求Body
+func encodeGatewayForm(p gatewayParams, bizContent string) string {
+	signParams := make(map[string]interface{})
+	signParams["app_id"] = p.AppId
+	signParams["method"] = p.Method
+	signParams["format"] = p.Format
+	signParams["charset"] = p.Charset
+	signParams["sign_type"] = p.SignType
+	signParams["timestamp"] = p.Timestamp
+	signParams["version"] = p.Version
+	signParams["biz_content"] = bizContent
+
+	sign := util.BuildMd5WithSalt(signParams, p.AppSecret)
+	// 序列化
+	values := url.Values{}
+	values.Set("app_id", p.AppId)
+	values.Set("method", p.Method)
+	values.Set("format", p.Format)
+	values.Set("charset", p.Charset)
+	values.Set("sign_type", p.SignType)
+	values.Set("sign", sign)
+	values.Set("timestamp", p.Timestamp)
+	values.Set("version", p.Version)
+	values.Set("biz_content", bizContent)
+
+	return values.Encode()
+}
+
 // TPResponse接口
 // Decode：从收到的JSON格式响应中解析参数
 type TPResponse interface {
@@ -51,27 +101,76 @@ type TPResponse interface {
 
 // 执行请求
 func Execute(ctx context.Context, timeout int, req TPRequest, resp TPResponse) error {
+	method := requestMethod(req)
+	ctx, span := tracer.Start(ctx, spanExecute)
+	span.SetAttribute(tracing.AttrMethod, method)
+	setOrderAttributes(span, req)
+
+	// 限流等待不计入请求耗时，等待被取消时请求未发出，不上报ObserveRequest
+	if err := waitRateLimit(ctx, requestMerchantId(req), method); err != nil {
+		err = util.Wrap(util.NotSent(err), "Execute failed when [waitRateLimit()]")
+		span.RecordError(err)
+		span.End()
+		return err
+	}
+
+	start := time.Now()
+	statusCode, err := execute(ctx, span, timeout, req, resp)
+
+	if statusCode > 0 {
+		span.SetAttribute(tracing.AttrStatusCode, strconv.Itoa(statusCode))
+	}
+	span.RecordError(err)
+	span.End()
+	metricsHook.ObserveRequest(method, statusCode, time.Since(start), err)
+	return err
+}
+
+// 执行请求，返回HTTP状态码供监控使用，未收到响应时状态码为0
+func execute(ctx context.Context, span tracing.Span, timeout int, req TPRequest, resp TPResponse) (int, error) {
 	if timeout <= 0 {
-		return errors.New("ClientTimeout must be a positive number")
+		return 0, util.NotSent(errors.New("ClientTimeout must be a positive number"))
 	}
 
-	body, err := req.Encode()
+	body, err := encodeRequest(ctx, req)
 	if err != nil {
-		return util.Wrap(err, "Execute failed when [TPRequest.Encode()]")
+		return 0, util.Wrap(util.NotSent(err), "Execute failed when [TPRequest.Encode()]")
 	}
 
 	logId := req.GetLogId()
 	if _logId, ok := ctx.Value("K_LOGID").(string); ok {
 		logId = _logId
 	}
+	span.SetAttribute(tracing.AttrLogId, logId)
 
-	statusCode, respBytes, err := HttpPost(req.GetUrl(), "application/x-www-form-urlencoded", body, logId, timeout)
+	httpCtx, httpSpan := tracer.Start(ctx, spanHttp)
+	httpSpan.SetAttribute(tracing.AttrLogId, logId)
+	httpCtx = contextWithTraceId(httpCtx, httpSpan.TraceId())
+	statusCode, respBytes, err := postGateway(httpCtx, req, body, logId, timeout)
+	if statusCode > 0 {
+		httpSpan.SetAttribute(tracing.AttrStatusCode, strconv.Itoa(statusCode))
+	}
+	httpSpan.RecordError(err)
+	httpSpan.End()
 	if err != nil {
-		return util.Wrap(err, "Execute failed when [HttpPost()]")
+		return statusCode, util.Wrap(err, "Execute failed when [HttpPost()]")
+	}
+	// 5xx且响应体不是JSON时，请求可能未到达财经后端，按网络错误处理；带网关错误体的5xx照常解析
+	if statusCode >= http.StatusInternalServerError && !json.Valid(respBytes) {
+		return statusCode, util.Wrap(util.NewStatusError(statusCode), "Execute failed when [HttpPost()]")
 	}
 
-	util.Debug("statusCode[%v] resp[%s]", statusCode, string(respBytes))
+	util.Debug("statusCode[%v] resp[%s]", statusCode, util.RedactJSON(respBytes))
 
+	_, decodeSpan := tracer.Start(ctx, spanDecode)
+	err = decodeResponse(respBytes, req, resp)
+	decodeSpan.RecordError(err)
+	decodeSpan.End()
+	return statusCode, err
+}
+
+// 解析响应，请求失败时返回*util.Error
+func decodeResponse(respBytes []byte, req TPRequest, resp TPResponse) error {
 	respJson, err := simplejson.NewJson(respBytes)
 	if err != nil {
 		return util.Wrap(err, "Execute failed when [simplejson.NewJson()]")
@@ -92,23 +191,57 @@ func Execute(ctx context.Context, timeout int, req TPRequest, resp TPResponse) e
 	return nil
 }
 
+// 向url发送网关请求，熔断器断开时直接失败，不发出请求
+func postUrl(ctx context.Context, url, body, logId string, timeout int) (int, []byte, error) {
+	breaker, host := circuitBreaker, urlHost(url)
+	var generation uint64
+	if breaker != nil {
+		var err error
+		if generation, err = breaker.allow(host); err != nil {
+			return 0, nil, err
+		}
+	}
+	// 请求发出后不随调用方ctx取消，与HttpPost一致只受timeout限制
+	statusCode, respBytes, err := HttpPostWithContext(detachContext(ctx), url, "application/x-www-form-urlencoded", body, logId, timeout)
+	if breaker != nil {
+		// 只有网络错误及5xx计入失败
+		failed := err != nil || statusCode >= http.StatusInternalServerError
+		breaker.done(host, generation, failed)
+	}
+	return statusCode, respBytes, err
+}
+
 func HttpPost(url, contentType, body string, logId string, timeoutMs int) (cnt int, respBytes []byte, err error) {
+	return HttpPostWithContext(context.Background(), url, contentType, body, logId, timeoutMs)
+}
+
+// HttpPostWithContext 同HttpPost，ctx取消时请求随之取消
+// 通过SetTraceHeader开启后，ctx中携带的trace id通过该请求头透传
+func HttpPostWithContext(ctx context.Context, url, contentType, body string, logId string, timeoutMs int) (cnt int, respBytes []byte, err error) {
 	req, err := http.NewRequest("POST", url, strings.NewReader(body))
 	if err != nil {
-		util.Debug("HttpTypePost NewRequest url[%s] body[%s] err[%s]\n", url, body, err)
+		util.Debug("HttpTypePost NewRequest url[%s] body[%s] err[%s]\n", url, util.RedactForm(body), err)
 		return 0, nil, util.Wrap(err, "HttpPost failed when [http.NewRequest()]")
 	}
-	ctx := context.Background()
+	parent := ctx
 	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeoutMs)*time.Millisecond)
 	defer cancel()
 	req = req.WithContext(ctx)
 	req.Header.Set("Content-type", contentType)
 	req.Header.Set("X-Tt-Logid", logId)
+	if traceId := traceIdFromContext(ctx); traceId != "" && traceHeader != "" {
+		req.Header.Set(traceHeader, traceId)
+		util.Debug("HttpPost logid[%s] traceid[%s]\n", logId, traceId)
+	}
 
 	resp, err := httpClient.Do(req)
 	if err != nil {
 		util.Debug("HttpPost client.Do err: %v, url: %s\n", err, url)
-		return 0, nil, util.Wrap(err, "HttpPost failed when [client.Do()]")
+		// 调用方取消不属于网络错误，不可按可重试处理
+		if parent.Err() != nil {
+			return 0, nil, util.Wrap(parent.Err(), "HttpPost failed when [client.Do()]")
+		}
+		return 0, nil, util.Wrap(util.NewNetworkError(err), "HttpPost failed when [client.Do()]")
 	}
 	// 如果关闭Body失败，将错误信息打印到log中
 	// 这里考虑下出现error要不要返回以及如何handle
@@ -120,11 +253,11 @@ func HttpPost(url, contentType, body string, logId string, timeoutMs int) (cnt i
 	respBody, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		util.Debug("HttpPost ioutil.ReadAll err: %v, url: %s\n", err, url)
-		return resp.StatusCode, nil, util.Wrap(err, "HttpPost failed when [ioutil.ReadAll()]")
+		return resp.StatusCode, nil, util.Wrap(util.NewNetworkError(err), "HttpPost failed when [ioutil.ReadAll()]")
 	}
 
 	util.Debug("HttpTypePost url[%s] contentType[%s] body[%s] code[%d] resp body[%s]\n",
-		url, contentType, body, resp.StatusCode, string(respBody))
+		url, contentType, util.RedactForm(body), resp.StatusCode, util.RedactJSON(respBody))
 	return resp.StatusCode, respBody, nil
 }
 
@@ -153,9 +286,10 @@ func success(respJson *simplejson.Json, req TPRequest) error {
 	switch respJson.Get("response").Interface() {
 	case nil:
 		// 默认值设为-1，不与其他返回码冲突
-		if respJson.Get("code").MustInt(-1) != 0 {
+		if code := respJson.Get("code").MustInt(-1); code != 0 {
 			ret := new(util.Error)
-			ret.Code = respJson.Get("code").MustString("")
+			// code一般为数字，兼容字符串
+			ret.Code = respJson.Get("code").MustString(strconv.Itoa(code))
 			ret.Msg = respJson.Get("msg").MustString("")
 			ret.Detail = "log_id:" + req.GetLogId()
 			return ret
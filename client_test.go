@@ -0,0 +1,190 @@
+package tt_pay
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/liaoxxxx/tt_pay/config"
+	"github.com/liaoxxxx/tt_pay/util"
+)
+
+const (
+	testAppSecret = "test-app-secret-0123456789"
+	testUid       = "uid_998877"
+	testAccount   = "6222000011112222"
+	testName      = "张三"
+	testIp        = "10.20.30.40"
+	testDeviceId  = "device_5566"
+)
+
+// 测试桩使用的sub_code，实际值以财经侧接口文档为准，由接入方通过util.RegisterSubCode收录
+func registerTestSubCodes(t *testing.T) {
+	t.Helper()
+	codes := map[string]util.Category{
+		"TP.TRADE_NOT_EXIST":    util.CategoryOrderNotExist,
+		"TP.REFUND_NOT_EXIST":   util.CategoryOrderNotExist,
+		"TP.WITHDRAW_NOT_EXIST": util.CategoryOrderNotExist,
+	}
+	for code, c := range codes {
+		util.RegisterSubCode(code, c)
+	}
+	t.Cleanup(func() {
+		for code := range codes {
+			util.UnregisterSubCode(code)
+		}
+	})
+}
+
+// 启动本地网关桩，所有请求均返回body
+func newStubGateway(t *testing.T, body string) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func testConfig(domain string) config.Config {
+	return config.Config{
+		AppId:             "app_1",
+		AppSecret:         testAppSecret,
+		MerchantId:        "merchant_1",
+		TPDomain:          domain,
+		TPClientTimeoutMs: 3000,
+	}
+}
+
+// 捕获Debug日志输出
+func captureDebug(t *testing.T, f func()) string {
+	t.Helper()
+	var buf bytes.Buffer
+	oldMode, oldWriter := util.DebugMode, log.Writer()
+	util.DebugMode = true
+	log.SetOutput(&buf)
+	defer func() {
+		util.DebugMode = oldMode
+		log.SetOutput(oldWriter)
+	}()
+	f()
+	return buf.String()
+}
+
+func TestExecuteDebugNoLeak(t *testing.T) {
+	ts := newStubGateway(t, `{"response":{"code":"10000","msg":"Success","withdraw_trade_no":"w_1",`+
+		`"uid":"`+testUid+`","account":"`+testAccount+`","name":"`+testName+`"},"sign":"resp_sign"}`)
+
+	out := captureDebug(t, func() {
+		req := NewRefundCreateRequest(testConfig(ts.URL))
+		req.Uid = testUid
+		req.OutOrderNo = "order_1"
+		req.OutRefundNo = "refund_1"
+		req.RefundAmount = 1
+		req.NotifyUrl = "https://example.com/notify"
+		req.RiskInfo = `{"ip":"` + testIp + `","device_id":"` + testDeviceId + `"}`
+		if _, err := RefundCreate(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+
+		queryReq := NewWithdrawQueryRequest(testConfig(ts.URL))
+		queryReq.OutTradeNo = "w_order_1"
+		resp, err := WithdrawQuery(context.Background(), queryReq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Account != testAccount {
+			t.Errorf("redaction must not change decoded response, got %s", resp.Account)
+		}
+	})
+
+	if !strings.Contains(out, "order_1") {
+		t.Fatalf("expected debug output, got:\n%s", out)
+	}
+	for _, secret := range []string{testAppSecret, testUid, testAccount, testName, testIp, testDeviceId, "resp_sign"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("log leaks %q:\n%s", secret, out)
+		}
+	}
+}
+
+func TestExecuteNetworkErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte("<html>bad gateway</html>"))
+	}))
+	defer ts.Close()
+
+	req := NewTradeQueryRequest(testConfig(ts.URL))
+	req.Uid = "uid_1"
+	req.OutOrderNo = "order_1"
+	_, err := TradeQuery(context.Background(), req)
+	var netErr *util.NetworkError
+	if !errors.As(err, &netErr) || netErr.StatusCode != http.StatusBadGateway || !util.IsRetryable(err) {
+		t.Errorf("expected retryable 502 network error, got %v", err)
+	}
+
+	ts.Close()
+	_, err = TradeQuery(context.Background(), req)
+	if !errors.Is(err, util.ErrNetwork) || errors.Is(err, util.ErrBusiness) {
+		t.Errorf("expected network error, got %v", err)
+	}
+
+	// 调用方取消不可重试
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := HttpPostWithContext(ctx, ts.URL, "text/plain", "", "log_1", 1000); !errors.Is(err, context.Canceled) || util.IsRetryable(err) {
+		t.Errorf("expected non-retryable canceled error, got %v", err)
+	}
+}
+
+func TestExecute5xxWithGatewayBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"response":{"code":"40004","msg":"Business Failed","sub_code":"TP.TRADE_NOT_EXIST"}}`))
+	}))
+	defer ts.Close()
+
+	req := NewTradeQueryRequest(testConfig(ts.URL))
+	req.Uid = "uid_1"
+	req.OutOrderNo = "order_1"
+	_, err := TradeQuery(context.Background(), req)
+	var tpErr *util.Error
+	if !errors.As(err, &tpErr) || tpErr.SubCode != "TP.TRADE_NOT_EXIST" {
+		t.Errorf("expected *util.Error, got %v", err)
+	}
+}
+
+func TestRequestStringNoLeak(t *testing.T) {
+	req := NewRefundCreateRequest(testConfig("https://example.com"))
+	req.OutRefundNo = "refund_1"
+	for _, format := range []string{"%v", "%+v", "%#v"} {
+		out := fmt.Sprintf(format, req)
+		if strings.Contains(out, testAppSecret) || !strings.Contains(out, "OutRefundNo:refund_1") {
+			t.Errorf("%s: unexpected output %s", format, out)
+		}
+	}
+}
+
+// 响应体取自client.go中success的文档示例
+func TestExecuteDocumentedErrorBody(t *testing.T) {
+	ts := newStubGateway(t, `{"response":{"code":"20000","msg":"Service Currently Unavailable",`+
+		`"sub_code":"TP.SYSTEM_ERROR","sub_msg":"接口返回错误"},"sign":"ERITJKEIJKJHKKKKKKKHJEREEEEEEEEEEE"}`)
+	req := NewTradeQueryRequest(testConfig(ts.URL))
+	req.Uid = testUid
+	req.OutOrderNo = "order_1"
+	_, err := TradeQuery(context.Background(), req)
+	var tpErr *util.Error
+	if !errors.As(err, &tpErr) || tpErr.Code != "20000" || tpErr.SubMsg != "接口返回错误" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !util.IsRetryable(err) || tpErr.Category() != util.CategorySystem || errors.Is(err, util.ErrOrderNotExist) {
+		t.Errorf("unexpected category %s", tpErr.Category())
+	}
+}
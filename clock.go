@@ -0,0 +1,37 @@
+package tt_pay
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock 为时间来源，测试中可替换为固定时间，使请求的timestamp及签名可复现
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+var (
+	clockLock sync.RWMutex
+	clock     Clock = systemClock{}
+)
+
+// SetClock 设置New*Request、收银台参数等使用的时间来源，传nil恢复为系统时间
+func SetClock(c Clock) {
+	clockLock.Lock()
+	defer clockLock.Unlock()
+	if c == nil {
+		c = systemClock{}
+	}
+	clock = c
+}
+
+// Now 返回SetClock设置的时间来源的当前时间
+func Now() time.Time {
+	clockLock.RLock()
+	defer clockLock.RUnlock()
+	return clock.Now()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 仓库中提交的生成代码必须与schema一致，修改schema后需执行go generate
+func TestGeneratedUpToDate(t *testing.T) {
+	schemas, err := loadSchemas("../../schema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schemas) == 0 {
+		t.Fatal("no schema found")
+	}
+	for _, s := range schemas {
+		got, err := generate("tt_pay", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := os.ReadFile(filepath.Join("../..", s.OutputFile()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s is out of date, run go generate", s.OutputFile())
+		}
+	}
+}
+
+func TestSchemaCheck(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema Schema
+		want   string
+	}{
+		{"missing method", Schema{Name: "Foo"}, "required"},
+		{"bad type", Schema{Name: "Foo", Method: "tp.foo", MethodConst: "MethodFoo",
+			Fields: []Field{{Name: "Amount", Type: "float64"}}}, "unsupported type"},
+		{"unknown biz field", Schema{Name: "Foo", Method: "tp.foo", MethodConst: "MethodFoo",
+			BizContent: []BizKey{{Key: "uid", Field: "Uid"}}}, "unknown field"},
+		{"unknown order attribute", Schema{Name: "Foo", Method: "tp.foo", MethodConst: "MethodFoo",
+			BizContent:      []BizKey{{Key: "merchant_id", Field: "MerchantId"}},
+			OrderAttributes: []string{"out_order_no"}}, "not in biz_content"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.schema.check()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutputFile(t *testing.T) {
+	s := &Schema{Name: "WithdrawCreate"}
+	if got := s.OutputFile(); got != "withdraw_create_gen.go" {
+		t.Errorf("got %s", got)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Schema 描述一个网关接口，对应schema目录下的一个json文件
+type Schema struct {
+	Name            string   `json:"name"`             // 类型名前缀，如TradeQuery
+	Method          string   `json:"method"`           // 网关方法名，如tp.trade.query
+	MethodConst     string   `json:"method_const"`     // consts包中的方法名常量
+	Doc             string   `json:"doc"`              // 接口说明，用于生成注释
+	CheckMethod     bool     `json:"check_method"`     // 是否查验Method
+	ExportPath      bool     `json:"export_path"`      // 请求路径是否导出为Path
+	Fields          []Field  `json:"fields"`           // 业务参数，按声明顺序查验
+	BizContent      []BizKey `json:"biz_content"`      // biz_content中的字段
+	LogId           []string `json:"log_id"`           // 生成logid的字段，靠前的优先
+	OrderAttributes []string `json:"order_attributes"` // 写入链路追踪的biz_content字段
+	Response        Response `json:"response"`
+
+	file string
+}
+
+// Field 为Request中的参数
+type Field struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Validate string `json:"validate"` // ttpay tag
+	Comment  string `json:"comment"`
+}
+
+// BizKey 为biz_content中的字段与Request参数的对应关系
+type BizKey struct {
+	Key   string `json:"key"`
+	Field string `json:"field"`
+}
+
+// Response 描述接口响应
+type Response struct {
+	Doc         string          `json:"doc"`
+	WithRequest bool            `json:"with_request"` // 响应中保留请求，用于生成收银台参数
+	FallbackKey string          `json:"fallback_key"` // 无response字段时从该字段解析，默认为data
+	Fields      []ResponseField `json:"fields"`
+}
+
+// ResponseField 为响应中的字段
+type ResponseField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Json string `json:"json"`
+}
+
+// 嵌入的config.Config中可作为biz_content来源的参数
+var configFields = map[string]bool{"AppId": true, "MerchantId": true}
+
+// 目前支持的参数类型
+var fieldTypes = map[string]bool{
+	"string": true,
+	"int":    true,
+	"bool":   true,
+	// tt_pay包中定义的枚举类型，底层为string
+	"AccountType": true,
+	// 时间类型，写入biz_content时转换为网关格式，见bizFormats
+	"time.Time":     true,
+	"time.Duration": true,
+}
+
+// 写入biz_content时需要转换格式的参数类型及对应的转换函数
+var bizFormats = map[string]string{
+	"time.Time":     "formatUnixTime", // Unix时间戳（秒）
+	"time.Duration": "formatSeconds",  // 秒数
+}
+
+// 读取目录下所有schema，按文件名排序
+func loadSchemas(dir string) ([]*Schema, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	ret := make([]*Schema, 0, len(files))
+	for _, file := range files {
+		s, err := loadSchema(file)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, s)
+	}
+	return ret, nil
+}
+
+func loadSchema(file string) (*Schema, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	s := new(Schema)
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	s.file = filepath.Base(file)
+	if err := s.check(); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return s, nil
+}
+
+func (s *Schema) check() error {
+	if s.Name == "" || s.Method == "" || s.MethodConst == "" {
+		return fmt.Errorf("name, method and method_const are required")
+	}
+	declared := make(map[string]bool)
+	for _, f := range s.Fields {
+		if f.Name == "" || !fieldTypes[f.Type] {
+			return fmt.Errorf("field %q: unsupported type %q", f.Name, f.Type)
+		}
+		if declared[f.Name] {
+			return fmt.Errorf("field %q: declared twice", f.Name)
+		}
+		declared[f.Name] = true
+	}
+	bizKeys := make(map[string]bool)
+	for _, b := range s.BizContent {
+		if !declared[b.Field] && !configFields[b.Field] {
+			return fmt.Errorf("biz_content %q: unknown field %q", b.Key, b.Field)
+		}
+		bizKeys[b.Key] = true
+	}
+	for _, name := range s.LogId {
+		if !declared[name] {
+			return fmt.Errorf("log_id: unknown field %q", name)
+		}
+	}
+	for _, key := range s.OrderAttributes {
+		if !bizKeys[key] {
+			return fmt.Errorf("order_attributes: %q is not in biz_content", key)
+		}
+	}
+	for _, f := range s.Response.Fields {
+		if f.Name == "" || f.Type == "" || f.Json == "" {
+			return fmt.Errorf("response field %q: name, type and json are required", f.Name)
+		}
+	}
+	if s.Response.FallbackKey == "" {
+		s.Response.FallbackKey = "data"
+	}
+	return nil
+}
+
+// 生成的文件名，如TradeQuery对应trade_query_gen.go
+func (s *Schema) OutputFile() string {
+	var b strings.Builder
+	for i, r := range s.Name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String() + "_gen.go"
+}
+
+// 请求路径字段名
+func (s *Schema) PathField() string {
+	if s.ExportPath {
+		return "Path"
+	}
+	return "path"
+}
+
+// 参数中是否有时间类型，决定是否导入time包
+func (s *Schema) UsesTime() bool {
+	for _, f := range s.Fields {
+		if strings.HasPrefix(f.Type, "time.") {
+			return true
+		}
+	}
+	return false
+}
+
+// biz_content中字段的取值表达式，时间类型转换为网关格式
+func (s *Schema) BizValue(b BizKey) string {
+	for _, f := range s.Fields {
+		if f.Name == b.Field {
+			if format, ok := bizFormats[f.Type]; ok {
+				return format + "(req." + b.Field + ")"
+			}
+		}
+	}
+	return "req." + b.Field
+}
+
+// biz_content字段对应的Request参数
+func (s *Schema) BizField(key string) string {
+	for _, b := range s.BizContent {
+		if b.Key == key {
+			return b.Field
+		}
+	}
+	return ""
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"text/template"
+)
+
+var fileTemplate = template.Must(template.New("file").Parse(`// Code generated by ttpaygen from schema/{{.File}}. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"encoding/json"
+	"fmt"
+{{- if .Schema.UsesTime}}
+	"time"
+{{- end}}
+
+	"github.com/bitly/go-simplejson"
+
+	"github.com/liaoxxxx/tt_pay/config"
+	"github.com/liaoxxxx/tt_pay/consts"
+	"github.com/liaoxxxx/tt_pay/util"
+)
+{{with .Schema}}
+// {{.Doc}}Request
+type {{.Name}}Request struct {
+	config.Config
+	Method     string{{if .CheckMethod}} ` + "`" + `ttpay:"eq={{.Method}}"` + "`" + `{{end}}
+	Format     string ` + "`" + `ttpay:"eq=JSON"` + "`" + `
+	Charset    string ` + "`" + `ttpay:"eq=utf-8"` + "`" + `
+	SignType   string ` + "`" + `ttpay:"eq=MD5"` + "`" + `
+	Timestamp  string ` + "`" + `ttpay:"number"` + "`" + `
+	Version    string ` + "`" + `ttpay:"version"` + "`" + `
+	bizContent *simplejson.Json ` + "`" + `ttpay:"nonnil"` + "`" + `
+	{{.PathField}} string
+{{- range .Fields}}
+	{{.Name}} {{.Type}}{{if .Validate}} ` + "`" + `ttpay:"{{.Validate}}"` + "`" + `{{end}}{{if .Comment}} // {{.Comment}}{{end}}
+{{- end}}
+}
+
+// New函数内赋默认值，目前含默认值（或仅支持一个值的）参数包括：
+// Version = "1.0"
+// SignType = "MD5"
+// Format = "JSON"
+// Charset = "utf-8"
+// Path = "gateway"，可通过SetPath改为"gateway-u"
+// Config.TPDomain = "https://tp-pay.snssdk.com"（未配置TPDomains时）
+// Method = "{{.Method}}"
+// Timestamp 自动设置为当前Unix时间戳，时间来源可通过SetClock替换
+// 另外，注意初始化bizContent，以免出现nil指针错误
+func New{{.Name}}Request(config config.Config) *{{.Name}}Request {
+	ret := new({{.Name}}Request)
+	ret.Config = config
+	ret.Version = "1.0"
+	ret.SignType = "MD5"
+	ret.Format = "JSON"
+	ret.Charset = "utf-8"
+	ret.{{.PathField}} = consts.TPPath
+	if len(ret.Config.TPDomain) == 0 && len(ret.Config.TPDomains) == 0 {
+		ret.Config.TPDomain = consts.TPDomain
+	}
+	ret.Method = consts.{{.MethodConst}}
+	ret.Timestamp = fmt.Sprintf("%d", Now().Unix())
+	ret.bizContent = simplejson.New()
+	return ret
+}
+
+// 将Request编码成POST请求的Body
+func (req *{{.Name}}Request) Encode() (string, error) {
+	bizContent, err := req.encodeBizContent()
+	if err != nil {
+		return "", err
+	}
+	return encodeGatewayForm(req.gatewayParams(), bizContent), nil
+}
+
+// 编码biz_content
+func (req *{{.Name}}Request) encodeBizContent() (string, error) {
+{{- $s := .}}
+{{- range .BizContent}}
+	req.bizContent.Set("{{.Key}}", {{$s.BizValue .}})
+{{- end}}
+
+	bizContentBytes, err := req.bizContent.Encode()
+	if err != nil {
+		util.Debug("{{.Name}}Request Encode bizContent.Encode err: %s, bizContent %v\n", err, util.RedactMap(req.bizContent.MustMap()))
+		return "", util.Wrap(err, "{{.Name}}Request Encode failed when [bizContent.Encode()]")
+	}
+
+	return string(bizContentBytes), nil
+}
+
+// 网关公共参数
+func (req *{{.Name}}Request) gatewayParams() gatewayParams {
+	return gatewayParams{
+		AppId:     req.Config.AppId,
+		AppSecret: req.Config.AppSecret,
+		Method:    req.Method,
+		Format:    req.Format,
+		Charset:   req.Charset,
+		SignType:  req.SignType,
+		Timestamp: req.Timestamp,
+		Version:   req.Version,
+	}
+}
+
+// 生成该次请求logid
+{{- if gt (len .LogId) 1}}
+// {{range $i, $f := .LogId}}{{if $i}}、{{end}}{{$f}}{{end}}哪个不空用哪个，都不空时优先用靠前的
+{{- end}}
+func (req *{{.Name}}Request) GetLogId() string {
+{{- range $i, $f := .LogId}}
+{{- if eq $i 0}}
+	id := req.{{$f}}
+{{- else}}
+	if len(id) == 0 {
+		id = req.{{$f}}
+	}
+{{- end}}
+{{- end}}
+	return fmt.Sprintf("%s_%s_%s_%s", req.Config.AppId, req.Config.MerchantId, {{if .LogId}}id{{else}}""{{end}}, req.Timestamp)
+}
+
+// 获取请求url地址，配置多个域名时使用当前可用的域名
+func (req *{{.Name}}Request) GetUrl() string {
+	return ActiveDomain(req.Config) + "/" + req.{{.PathField}}
+}
+
+// 获取请求路径，切换域名时与各域名拼接
+func (req *{{.Name}}Request) GetPath() string {
+	return req.{{.PathField}}
+}
+
+// 设置请求路径，可选consts.TPPath（默认）或consts.TPPathU
+// 两者加签方式相同，响应的解析见Decode
+func (req *{{.Name}}Request) SetPath(path string) {
+	req.{{.PathField}} = path
+}
+
+// 获取接口方法名
+func (req *{{.Name}}Request) GetMethod() string {
+	return req.Method
+}
+
+// 订单号，用于链路追踪
+func (req *{{.Name}}Request) orderAttributes() map[string]string {
+	return map[string]string{
+{{- $s := .}}
+{{- range .OrderAttributes}}
+		"{{.}}": req.{{$s.BizField .}},
+{{- end}}
+	}
+}
+
+// 输出请求参数，AppSecret已脱敏
+func (req *{{.Name}}Request) String() string {
+	return formatRequest(req)
+}
+
+// 用于%#v输出，AppSecret已脱敏
+func (req *{{.Name}}Request) GoString() string {
+	return formatRequest(req)
+}
+
+// 提供该接口，方便业务方设置可选参数，比如product_code、payment_type等
+func (req *{{.Name}}Request) SetBizContentKV(key string, val interface{}) {
+	req.bizContent.Set(key, val)
+}
+
+// {{.Response.Doc}}
+type {{.Name}}Response struct {
+	Data *simplejson.Json
+{{- range .Response.Fields}}
+	{{.Name}} {{.Type}} ` + "`" + `json:"{{.Json}}"` + "`" + `
+{{- end}}
+{{- if .Response.WithRequest}}
+	req *{{.Name}}Request // 包含拉起收银台所需参数
+{{- end}}
+}
+
+// 初始化{{.Response.Doc}}
+func New{{.Name}}Response({{if .Response.WithRequest}}req *{{.Name}}Request{{end}}) *{{.Name}}Response {
+	ret := new({{.Name}}Response)
+	ret.Data = simplejson.New()
+{{- if .Response.WithRequest}}
+	ret.req = req
+{{- end}}
+	return ret
+}
+
+// 将响应json数据反序列化为对应接口
+func (resp *{{.Name}}Response) Decode() error {
+	var respBytes []byte
+	var err error
+	// 走网关的接口拿到的参数在response里，否则（如gateway-u）在{{.Response.FallbackKey}}里
+	switch resp.Data.Get("response").Interface() {
+	case nil:
+		respBytes, err = resp.Data.Get("{{.Response.FallbackKey}}").Encode()
+	default:
+		respBytes, err = resp.Data.Get("response").Encode()
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(respBytes, resp); err != nil {
+		return err
+	}
+	return nil
+}
+
+// 设置原始响应
+func (resp *{{.Name}}Response) SetData(data *simplejson.Json) {
+	resp.Data = data
+}
+{{- end}}
+`))
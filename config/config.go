@@ -1,11 +1,56 @@
 package config
 
+import (
+	"fmt"
+
+	"github.com/liaoxxxx/tt_pay/util"
+)
+
 type Config struct {
-	AppId             string
+	AppId             string `ttpay:"id,max=32"`
 	AppSecret         string
-	MerchantId        string
-	TPDomain          string // 请求支付域名 加http或者https前缀，比如：https://tp-pay.snssdk.com
+	MerchantId        string   `ttpay:"id,max=32"`
+	TPDomain          string   // 请求支付域名 加http或者https前缀，比如：https://tp-pay.snssdk.com
+	TPDomains         []string // 按优先级排列的多个支付域名，主域名在前，配置后忽略TPDomain，连接失败时依次切换
 	TPClientTimeoutMs int
+	RSAPrivateKey     string // 商户RSA私钥，PEM格式，用于MD5withRSA签名（util.BuildMd5WithRsa）
+	RSAPublicKey      string // 财经侧RSA公钥，PEM格式，用于回调验签，为空时使用consts.TtPayPublicKey
+}
+
+// GetDomains 返回按优先级排列的支付域名
+func (c Config) GetDomains() []string {
+	if len(c.TPDomains) > 0 {
+		return c.TPDomains
+	}
+	return []string{c.TPDomain}
+}
+
+// GetMerchantId 嵌入Config的Request均可通过该方法获取商户号，用于限流等场景
+func (c Config) GetMerchantId() string {
+	return c.MerchantId
+}
+
+// String 输出配置，AppSecret及RSAPrivateKey已脱敏
+func (c Config) String() string {
+	return fmt.Sprintf("{AppId:%s AppSecret:%s MerchantId:%s TPDomain:%s TPDomains:%v TPClientTimeoutMs:%d RSAPrivateKey:%s RSAPublicKey:%s}",
+		c.AppId, util.MaskSecret(c.AppSecret), c.MerchantId, c.TPDomain, c.TPDomains, c.TPClientTimeoutMs,
+		util.MaskSecret(c.RSAPrivateKey), c.RSAPublicKey)
+}
+
+// GoString 用于%#v输出，AppSecret及RSAPrivateKey已脱敏
+func (c Config) GoString() string {
+	return fmt.Sprintf("config.Config{AppId:%q, AppSecret:%q, MerchantId:%q, TPDomain:%q, TPDomains:%#v, TPClientTimeoutMs:%d, RSAPrivateKey:%q, RSAPublicKey:%q}",
+		c.AppId, util.MaskSecret(c.AppSecret), c.MerchantId, c.TPDomain, c.TPDomains, c.TPClientTimeoutMs,
+		util.MaskSecret(c.RSAPrivateKey), c.RSAPublicKey)
+}
+
+// Validate 查验必填的配置项，返回*util.ValidationError
+func (c Config) Validate() error {
+	v := new(util.Validator)
+	v.Check(util.CheckAppId(c.AppId))
+	v.Check(util.CheckMerchantId(c.MerchantId))
+	v.Check(util.CheckAppSecret(c.AppSecret))
+	return v.Err()
 }
 
 type TTPay struct {
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// 环境变量名，FromEnv读取时加上前缀，如TTPAY_APP_ID
+const (
+	EnvAppId      = "APP_ID"
+	EnvAppSecret  = "APP_SECRET"
+	EnvMerchantId = "MERCHANT_ID"
+	EnvDomain     = "DOMAIN"
+	EnvDomains    = "DOMAINS" // 多个域名以逗号分隔
+	EnvTimeoutMs  = "TIMEOUT_MS"
+
+	EnvRSAPrivateKey = "RSA_PRIVATE_KEY"
+	EnvRSAPublicKey  = "RSA_PUBLIC_KEY"
+)
+
+// FromEnv 从环境变量读取配置，prefix为变量名前缀，如TTPAY
+// AppSecret及RSA密钥未设置时依次从secrets读取，读取后查验AppId、MerchantId、AppSecret
+func FromEnv(prefix string, secrets ...SecretProvider) (Config, error) {
+	c := Config{
+		AppId:      os.Getenv(envKey(prefix, EnvAppId)),
+		AppSecret:  os.Getenv(envKey(prefix, EnvAppSecret)),
+		MerchantId: os.Getenv(envKey(prefix, EnvMerchantId)),
+		TPDomain:   os.Getenv(envKey(prefix, EnvDomain)),
+
+		RSAPrivateKey: os.Getenv(envKey(prefix, EnvRSAPrivateKey)),
+		RSAPublicKey:  os.Getenv(envKey(prefix, EnvRSAPublicKey)),
+	}
+	if domains := os.Getenv(envKey(prefix, EnvDomains)); domains != "" {
+		for _, d := range strings.Split(domains, ",") {
+			if d = strings.TrimSpace(d); d != "" {
+				c.TPDomains = append(c.TPDomains, d)
+			}
+		}
+	}
+	if s := os.Getenv(envKey(prefix, EnvTimeoutMs)); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return Config{}, fmt.Errorf("config: env %s: invalid integer %q", envKey(prefix, EnvTimeoutMs), s)
+		}
+		c.TPClientTimeoutMs = n
+	}
+	return finish(c, "env "+envKey(prefix, ""), secrets)
+}
+
+// 配置文件格式，字段名同环境变量的小写
+type fileConfig struct {
+	AppId      string   `json:"app_id" yaml:"app_id" toml:"app_id"`
+	AppSecret  string   `json:"app_secret" yaml:"app_secret" toml:"app_secret"`
+	MerchantId string   `json:"merchant_id" yaml:"merchant_id" toml:"merchant_id"`
+	Domain     string   `json:"domain" yaml:"domain" toml:"domain"`
+	Domains    []string `json:"domains" yaml:"domains" toml:"domains"`
+	TimeoutMs  int      `json:"timeout_ms" yaml:"timeout_ms" toml:"timeout_ms"`
+
+	RSAPrivateKey string `json:"rsa_private_key" yaml:"rsa_private_key" toml:"rsa_private_key"`
+	RSAPublicKey  string `json:"rsa_public_key" yaml:"rsa_public_key" toml:"rsa_public_key"`
+}
+
+// FromFile 从配置文件读取配置，按扩展名支持.yaml/.yml、.json、.toml，未知字段视为错误
+// AppSecret及RSA密钥未设置时依次从secrets读取，读取后查验AppId、MerchantId、AppSecret
+func FromFile(path string, secrets ...SecretProvider) (Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("config: %w", err)
+	}
+	var fc fileConfig
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+		err = dec.Decode(&fc)
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&fc)
+	case ".toml":
+		var md toml.MetaData
+		md, err = toml.Decode(string(b), &fc)
+		if err == nil && len(md.Undecoded()) > 0 {
+			err = fmt.Errorf("unknown field %q", md.Undecoded()[0].String())
+		}
+	default:
+		return Config{}, fmt.Errorf("config: %s: unsupported format %q", path, ext)
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("config: %s: %w", path, err)
+	}
+	c := Config{
+		AppId:             fc.AppId,
+		AppSecret:         fc.AppSecret,
+		MerchantId:        fc.MerchantId,
+		TPDomain:          fc.Domain,
+		TPDomains:         fc.Domains,
+		TPClientTimeoutMs: fc.TimeoutMs,
+		RSAPrivateKey:     fc.RSAPrivateKey,
+		RSAPublicKey:      fc.RSAPublicKey,
+	}
+	return finish(c, path, secrets)
+}
+
+// 补全AppSecret及RSA密钥并查验，source用于错误信息
+func finish(c Config, source string, secrets []SecretProvider) (Config, error) {
+	for name, val := range map[string]*string{
+		SecretAppSecret:     &c.AppSecret,
+		SecretRSAPrivateKey: &c.RSAPrivateKey,
+		SecretRSAPublicKey:  &c.RSAPublicKey,
+	} {
+		if *val != "" || len(secrets) == 0 {
+			continue
+		}
+		secret, err := lookupSecret(context.Background(), name, secrets)
+		if err != nil && !errors.Is(err, ErrSecretNotFound) {
+			return Config{}, fmt.Errorf("config: %s: %w", source, err)
+		}
+		*val = secret
+	}
+	if err := c.Validate(); err != nil {
+		return Config{}, fmt.Errorf("config: %s: %w", source, err)
+	}
+	return c, nil
+}
+
+func envKey(prefix, name string) string {
+	if prefix == "" || strings.HasSuffix(prefix, "_") {
+		return prefix + name
+	}
+	return prefix + "_" + name
+}
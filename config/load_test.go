@@ -0,0 +1,118 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/liaoxxxx/tt_pay/util"
+)
+
+const testSecret = "s3cr3t_value"
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("TTPAY_APP_ID", "app_1")
+	t.Setenv("TTPAY_MERCHANT_ID", "merchant_1")
+	t.Setenv("TTPAY_DOMAINS", "https://a.example.com, https://b.example.com")
+	t.Setenv("TTPAY_TIMEOUT_MS", "3000")
+
+	// AppSecret缺失
+	_, err := FromEnv("TTPAY")
+	var ve *util.ValidationError
+	if !errors.As(err, &ve) || ve.Field("AppSecret") == nil || len(ve.Fields) != 1 {
+		t.Fatalf("expected AppSecret error, got %v", err)
+	}
+
+	t.Setenv("TTPAY_APP_SECRET", testSecret)
+	t.Setenv("TTPAY_RSA_PUBLIC_KEY", "public_pem")
+	secrets := FileSecretProvider{Dir: filepath.Dir(writeFile(t, SecretRSAPrivateKey, "private_pem\n"))}
+	c, err := FromEnv("TTPAY_", secrets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.AppId != "app_1" || c.AppSecret != testSecret || c.TPClientTimeoutMs != 3000 ||
+		len(c.TPDomains) != 2 || c.TPDomains[1] != "https://b.example.com" ||
+		c.RSAPrivateKey != "private_pem" || c.RSAPublicKey != "public_pem" {
+		t.Errorf("unexpected config %+v", c)
+	}
+
+	t.Setenv("TTPAY_TIMEOUT_MS", "3s")
+	if _, err := FromEnv("TTPAY"); err == nil || !strings.Contains(err.Error(), "TTPAY_TIMEOUT_MS") {
+		t.Errorf("expected timeout error, got %v", err)
+	}
+}
+
+func TestFromFile(t *testing.T) {
+	files := map[string]string{
+		"tt_pay.yaml": "app_id: app_1\nmerchant_id: merchant_1\ndomains:\n  - https://a.example.com\ntimeout_ms: 3000\nrsa_public_key: public_pem\n",
+		"tt_pay.json": `{"app_id": "app_1", "merchant_id": "merchant_1", "domains": ["https://a.example.com"], "timeout_ms": 3000, "rsa_public_key": "public_pem"}`,
+		"tt_pay.toml": "app_id = \"app_1\"\nmerchant_id = \"merchant_1\"\ndomains = [\"https://a.example.com\"]\ntimeout_ms = 3000\nrsa_public_key = \"public_pem\"\n",
+	}
+	secrets := FileSecretProvider{Dir: filepath.Dir(writeFile(t, SecretAppSecret, testSecret+"\n"))}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			path := writeFile(t, name, content)
+			c, err := FromFile(path, EnvSecretProvider{Prefix: "TTPAY_TEST"}, secrets)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.AppId != "app_1" || c.MerchantId != "merchant_1" || c.AppSecret != testSecret ||
+				c.TPClientTimeoutMs != 3000 || len(c.TPDomains) != 1 || c.RSAPublicKey != "public_pem" {
+				t.Errorf("unexpected config %+v", c)
+			}
+		})
+	}
+}
+
+func TestFromFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"tt_pay.ini", "app_id=app_1", "unsupported format"},
+		{"tt_pay.yaml", "app_id: app_1\nappsecret: x\n", "appsecret"},
+		{"tt_pay.toml", "app_id = \"app_1\"\nmerchantid = \"m\"\n", "merchantid"},
+		{"tt_pay.json", `{"app_id": "app 1", "merchant_id": "merchant_1", "app_secret": "x"}`, "AppId"},
+	}
+	for _, tt := range tests {
+		_, err := FromFile(writeFile(t, tt.name, tt.content))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestSecretProviders(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("TTPAY_RSA_PRIVATE_KEY", "pem")
+	if v, err := (EnvSecretProvider{Prefix: "TTPAY"}).Secret(ctx, SecretRSAPrivateKey); err != nil || v != "pem" {
+		t.Errorf("got %q %v", v, err)
+	}
+	if _, err := (FileSecretProvider{Dir: t.TempDir()}).Secret(ctx, SecretRSAPublicKey); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("expected ErrSecretNotFound, got %v", err)
+	}
+}
+
+func TestConfigRedaction(t *testing.T) {
+	c := Config{AppId: "app_1", AppSecret: testSecret, MerchantId: "merchant_1", RSAPrivateKey: testSecret + "_pem"}
+	for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+		out := fmt.Sprintf(format, c)
+		if strings.Contains(out, testSecret) || !strings.Contains(out, "merchant_1") {
+			t.Errorf("%s: unexpected output %s", format, out)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 密钥名
+const (
+	SecretAppSecret     = "app_secret"
+	SecretRSAPrivateKey = "rsa_private_key" // 商户RSA私钥，PEM格式，读取到Config.RSAPrivateKey
+	SecretRSAPublicKey  = "rsa_public_key"  // 财经侧RSA公钥，PEM格式，读取到Config.RSAPublicKey
+)
+
+// ErrSecretNotFound 密钥不存在
+var ErrSecretNotFound = errors.New("config: secret not found")
+
+// SecretProvider 为密钥来源，用于避免将AppSecret、RSA密钥写在代码或配置文件中
+// 密钥不存在时返回ErrSecretNotFound
+type SecretProvider interface {
+	Secret(ctx context.Context, name string) (string, error)
+}
+
+// EnvSecretProvider 从环境变量读取密钥，变量名为Prefix加大写的密钥名，如TTPAY_APP_SECRET
+type EnvSecretProvider struct {
+	Prefix string
+}
+
+func (p EnvSecretProvider) Secret(ctx context.Context, name string) (string, error) {
+	key := envKey(p.Prefix, strings.ToUpper(name))
+	val, ok := os.LookupEnv(key)
+	if !ok || val == "" {
+		return "", fmt.Errorf("%w: env %s", ErrSecretNotFound, key)
+	}
+	return val, nil
+}
+
+// FileSecretProvider 从Dir目录下与密钥名同名的文件读取密钥，适用于Kubernetes Secret挂载等场景
+// 文件末尾的空白字符会被去除
+type FileSecretProvider struct {
+	Dir string
+}
+
+func (p FileSecretProvider) Secret(ctx context.Context, name string) (string, error) {
+	path := filepath.Join(p.Dir, name)
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("%w: file %s", ErrSecretNotFound, path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("config: read secret %s: %w", path, err)
+	}
+	val := strings.TrimRight(string(b), " \t\r\n")
+	if val == "" {
+		return "", fmt.Errorf("%w: file %s is empty", ErrSecretNotFound, path)
+	}
+	return val, nil
+}
+
+// 依次从providers读取密钥，均不存在时返回ErrSecretNotFound
+func lookupSecret(ctx context.Context, name string, providers []SecretProvider) (string, error) {
+	for _, p := range providers {
+		val, err := p.Secret(ctx, name)
+		if err == nil {
+			return val, nil
+		}
+		if !errors.Is(err, ErrSecretNotFound) {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+}
@@ -9,9 +9,30 @@ const (
 	MethodWithdrawCreate = "tp.withdraw.create"
 	MethodWithdrawQuery  = "tp.withdraw.query"
 
+	// 回调类型，用于监控等场景区分回调来源
+	NotifyTypeTrade    = "trade.notify"
+	NotifyTypeRefund   = "refund.notify"
+	NotifyTypeWithdraw = "withdraw.notify"
+
+	// 订单状态
+	TradeStatusSuccess    = "SUCCESS"
+	TradeStatusProcessing = "PROCESSING"
+	TradeStatusFail       = "FAIL"
+	TradeStatusTimeout    = "TIMEOUT"
+
+	// 退款状态
+	RefundStatusSuccess    = "SUCCESS"
+	RefundStatusFail       = "FAIL"
+	RefundStatusProcessing = "PROCESSING"
+
+	// 提现状态
+	WithdrawStatusSuccess    = "SUCCESS"
+	WithdrawStatusFail       = "FAIL"
+	WithdrawStatusProcessing = "PROCESSING"
+
 	TPDomain = "https://tp-pay.snssdk.com"
 	TPPath   = "gateway"
-	TPPathU  = "gateway-u"
+	TPPathU  = "gateway-u" // 与gateway加签方式相同，请求通过SetPath选择
 
 	TtPayPublicKey = `-----BEGIN PUBLIC KEY-----
 MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQDOZZ7iAkS3oN970+yDONe5TPhP
@@ -0,0 +1,344 @@
+package tt_pay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/liaoxxxx/tt_pay/consts"
+	"github.com/liaoxxxx/tt_pay/store"
+	"github.com/liaoxxxx/tt_pay/util"
+)
+
+// EventType 为支付生命周期事件类型
+type EventType string
+
+const (
+	EventTradeCreated      EventType = "TradeCreated"
+	EventTradePaid         EventType = "TradePaid"
+	EventTradeClosed       EventType = "TradeClosed" // 支付失败或超时
+	EventRefundRequested   EventType = "RefundRequested"
+	EventRefundSucceeded   EventType = "RefundSucceeded"
+	EventRefundFailed      EventType = "RefundFailed"
+	EventWithdrawRequested EventType = "WithdrawRequested"
+	EventWithdrawCompleted EventType = "WithdrawCompleted" // 成功或失败，见Order.Status
+)
+
+// EventBus的默认参数
+const (
+	DefaultEventShards        = 16
+	DefaultEventQueueSize     = 256
+	DefaultEventRetryInterval = 100 * time.Millisecond
+	maxEventRetryInterval     = 30 * time.Second
+)
+
+// ErrEventBusClosed EventBus已关闭
+var ErrEventBusClosed = errors.New("tt_pay: event bus closed")
+
+// ErrEventQueueFull 事件队列已满，事件未发布
+var ErrEventQueueFull = errors.New("tt_pay: event queue full")
+
+// Event 为一次生命周期事件
+// 查询与回调可能多次得到同一状态，同一事件会重复发布，订阅方需按Id幂等处理
+type Event struct {
+	Type   EventType
+	Order  store.Order // 本次接口返回的订单信息，字段可能不全
+	Source string      // 事件来源：store.SourceCreate、SourceQuery或SourceNotify
+	Time   time.Time
+}
+
+// Id 事件标识，同一订单同类型的事件Id相同
+func (e Event) Id() string {
+	return e.key() + ":" + string(e.Type)
+}
+
+// 同一订单的事件按发布顺序投递
+func (e Event) key() string {
+	return string(e.Order.Kind) + ":" + e.Order.MerchantId + ":" + e.Order.OutNo
+}
+
+// EventHandler 处理事件，返回错误或panic时稍后重新投递
+type EventHandler func(ctx context.Context, ev Event) error
+
+// EventDropHandler 在事件被丢弃时调用，可将事件写入业务自己的存储后补发，err为丢弃原因：
+// ErrEventQueueFull、ErrEventBusClosed（含Close超时放弃重试），或达到最大投递次数时订阅方最后返回的错误
+type EventDropHandler func(ev Event, err error)
+
+type subscriber struct {
+	handler EventHandler
+	types   map[EventType]bool // 为空时接收全部事件
+}
+
+// EventBus 进程内事件总线
+// 事件按订单分片投递，同一订单的事件对每个订阅方保证顺序
+// 处理失败时按退避间隔重试直到成功，语义为至少一次；以下情况事件会被丢弃并交给SetDropHandler设置的函数：
+// SDK内部发布时队列已满、SetRetry设置了最大投递次数且已达到、Close超时后未完成的重试
+type EventBus struct {
+	mu          sync.RWMutex
+	subs        map[int]*subscriber
+	nextId      int
+	shards      []chan Event
+	interval    time.Duration
+	maxAttempts int
+	dropHandler EventDropHandler
+	closed      bool
+	publishing  sync.WaitGroup // 正在入队的Publish，Close等待其返回后关闭队列
+	stopped     chan struct{}  // 停止接收事件
+	aborted     chan struct{}  // 放弃重试
+	closeOnce   sync.Once
+	abortOnce   sync.Once
+	wg          sync.WaitGroup
+}
+
+// NewEventBus 创建事件总线并启动投递协程，shards<=0时使用DefaultEventShards
+func NewEventBus(shards int) *EventBus {
+	if shards <= 0 {
+		shards = DefaultEventShards
+	}
+	b := &EventBus{
+		subs:     make(map[int]*subscriber),
+		shards:   make([]chan Event, shards),
+		interval: DefaultEventRetryInterval,
+		stopped:  make(chan struct{}),
+		aborted:  make(chan struct{}),
+	}
+	for i := range b.shards {
+		b.shards[i] = make(chan Event, DefaultEventQueueSize)
+		b.wg.Add(1)
+		go b.work(b.shards[i])
+	}
+	return b
+}
+
+// SetRetry 设置重试的初始间隔(每次翻倍，最长30s)及最大投递次数
+// maxAttempts<=0时不限次数（默认），订阅方持续失败时会一直占用所在分片；达到次数后事件被丢弃
+func (b *EventBus) SetRetry(interval time.Duration, maxAttempts int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if interval > 0 {
+		b.interval = interval
+	}
+	b.maxAttempts = maxAttempts
+}
+
+// SetDropHandler 设置事件被丢弃时的处理函数，未设置时只打印日志
+func (b *EventBus) SetDropHandler(h EventDropHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.dropHandler = h
+}
+
+// 丢弃事件，交给dropHandler或打印日志
+func (b *EventBus) drop(ev Event, err error) {
+	b.mu.RLock()
+	h := b.dropHandler
+	b.mu.RUnlock()
+	if h == nil {
+		log.Printf("tt_pay: drop event [%s]: %v", ev.Id(), err)
+		return
+	}
+	h(ev, err)
+}
+
+// Subscribe 注册订阅方，types为空时接收全部事件，返回取消订阅的函数
+func (b *EventBus) Subscribe(handler EventHandler, types ...EventType) func() {
+	s := &subscriber{handler: handler}
+	if len(types) > 0 {
+		s.types = make(map[EventType]bool, len(types))
+		for _, t := range types {
+			s.types[t] = true
+		}
+	}
+	b.mu.Lock()
+	id := b.nextId
+	b.nextId++
+	b.subs[id] = s
+	b.mu.Unlock()
+	return func() {
+		b.mu.Lock()
+		delete(b.subs, id)
+		b.mu.Unlock()
+	}
+}
+
+// Publish 发布事件，队列已满时阻塞至入队、ctx结束或总线关闭
+func (b *EventBus) Publish(ctx context.Context, ev Event) error {
+	return b.publish(ctx, ev, true)
+}
+
+// 选出分片后释放锁再入队，避免阻塞Subscribe及投递；block为false时队列已满直接返回ErrEventQueueFull
+func (b *EventBus) publish(ctx context.Context, ev Event, block bool) error {
+	if ev.Time.IsZero() {
+		ev.Time = Now()
+	}
+	h := fnv.New32a()
+	h.Write([]byte(ev.key()))
+
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		return ErrEventBusClosed
+	}
+	ch := b.shards[h.Sum32()%uint32(len(b.shards))]
+	b.publishing.Add(1)
+	b.mu.RUnlock()
+	defer b.publishing.Done()
+
+	if !block {
+		select {
+		case ch <- ev:
+			return nil
+		default:
+			return ErrEventQueueFull
+		}
+	}
+	select {
+	case ch <- ev:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-b.stopped:
+		return ErrEventBusClosed
+	}
+}
+
+// Close 停止接收事件，等待队列中剩余的事件投递完成
+// ctx结束时放弃未完成的重试，等待当前处理返回后返回ctx.Err()
+func (b *EventBus) Close(ctx context.Context) error {
+	b.closeOnce.Do(func() {
+		b.mu.Lock()
+		b.closed = true
+		b.mu.Unlock()
+		// 唤醒阻塞的Publish，全部返回后才能关闭队列
+		close(b.stopped)
+		b.publishing.Wait()
+		for _, ch := range b.shards {
+			close(ch)
+		}
+	})
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		b.abortOnce.Do(func() { close(b.aborted) })
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (b *EventBus) work(ch chan Event) {
+	defer b.wg.Done()
+	for ev := range ch {
+		b.mu.RLock()
+		subs := make([]*subscriber, 0, len(b.subs))
+		for _, s := range b.subs {
+			if s.types == nil || s.types[ev.Type] {
+				subs = append(subs, s)
+			}
+		}
+		interval, maxAttempts := b.interval, b.maxAttempts
+		b.mu.RUnlock()
+
+		for _, s := range subs {
+			b.deliver(s, ev, interval, maxAttempts)
+		}
+	}
+}
+
+// 投递给单个订阅方，失败时重试，其他订阅方不会重复收到
+func (b *EventBus) deliver(s *subscriber, ev Event, interval time.Duration, maxAttempts int) {
+	for attempt := 1; ; attempt++ {
+		err := s.handle(ev)
+		if err == nil {
+			return
+		}
+		util.Debug("Handle event [%s] failed: attempt[%d] err[%s]", ev.Id(), attempt, err)
+		if maxAttempts > 0 && attempt >= maxAttempts {
+			b.drop(ev, fmt.Errorf("after %d attempts: %w", attempt, err))
+			return
+		}
+		select {
+		case <-time.After(interval):
+		case <-b.aborted:
+			b.drop(ev, fmt.Errorf("%w: %v", ErrEventBusClosed, err))
+			return
+		}
+		if interval *= 2; interval > maxEventRetryInterval {
+			interval = maxEventRetryInterval
+		}
+	}
+}
+
+// 调用订阅方，panic按处理失败重试，避免投递协程退出后该分片的事件全部阻塞
+func (s *subscriber) handle(ev Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("tt_pay: event handler panic: %v", r)
+		}
+	}()
+	return s.handler(context.Background(), ev)
+}
+
+var eventBus *EventBus
+
+// SetEventBus 设置事件总线，传nil则关闭
+// 配置后下单、查询及回调解析成功时会按订单状态发布事件，不等待入队以免阻塞请求，
+// 队列已满或总线已关闭时事件交给EventBus.SetDropHandler设置的函数
+func SetEventBus(b *EventBus) {
+	eventBus = b
+}
+
+func publishOrder(ctx context.Context, o *store.Order, source string) {
+	if eventBus == nil || o.OutNo == "" {
+		return
+	}
+	typ, ok := orderEventType(o, source)
+	if !ok {
+		return
+	}
+	ev := Event{Type: typ, Order: *o, Source: source, Time: Now()}
+	if err := eventBus.publish(ctx, ev, false); err != nil {
+		eventBus.drop(ev, err)
+	}
+}
+
+// 按订单类型及状态确定事件，处理中等中间状态不发布
+func orderEventType(o *store.Order, source string) (EventType, bool) {
+	switch o.Kind {
+	case store.KindTrade:
+		switch {
+		case source == store.SourceCreate:
+			return EventTradeCreated, true
+		case o.Status == consts.TradeStatusSuccess:
+			return EventTradePaid, true
+		case o.Status == consts.TradeStatusFail || o.Status == consts.TradeStatusTimeout:
+			return EventTradeClosed, true
+		}
+	case store.KindRefund:
+		switch {
+		case source == store.SourceCreate:
+			return EventRefundRequested, true
+		case o.Status == consts.RefundStatusSuccess:
+			return EventRefundSucceeded, true
+		case o.Status == consts.RefundStatusFail:
+			return EventRefundFailed, true
+		}
+	case store.KindWithdraw:
+		switch {
+		case source == store.SourceCreate:
+			return EventWithdrawRequested, true
+		case o.Status == consts.WithdrawStatusSuccess || o.Status == consts.WithdrawStatusFail:
+			return EventWithdrawCompleted, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,245 @@
+package tt_pay
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/liaoxxxx/tt_pay/store"
+)
+
+func TestEventBusHooks(t *testing.T) {
+	bus := NewEventBus(0)
+	SetEventBus(bus)
+	defer SetEventBus(nil)
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var got []EventType
+	bus.Subscribe(func(ctx context.Context, ev Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, ev.Type)
+		return nil
+	})
+
+	ts := newStubGateway(t, `{"response":{"code":"10000","msg":"Success","out_order_no":"order_1",`+
+		`"out_refund_no":"refund_1","refund_no":"r_100","refund_amount":"50","refund_status":"SUCCESS"},"sign":"s"}`)
+	req := NewRefundCreateRequest(testConfig(ts.URL))
+	req.Uid = testUid
+	req.OutOrderNo = "order_1"
+	req.OutRefundNo = "refund_1"
+	req.RefundAmount = 50
+	req.NotifyUrl = "https://example.com/notify"
+	req.RiskInfo = `{"ip":"` + testIp + `"}`
+	if _, err := RefundCreate(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	queryReq := NewRefundQueryRequest(testConfig(ts.URL))
+	queryReq.Uid = testUid
+	queryReq.OutRefundNo = "refund_1"
+	if _, err := RefundQuery(ctx, queryReq); err != nil {
+		t.Fatal(err)
+	}
+
+	priv, pub := newTestKeyPair(t)
+	param := signNotify(t, map[string]string{
+		"merchant_id":  "merchant_1",
+		"out_order_no": "order_2",
+		"trade_status": "TIMEOUT",
+	}, priv)
+	if _, err := TradeNotify(ctx, &TradeNotifyRequest{Param: param, PublicKey: pub}); err != nil {
+		t.Fatal(err)
+	}
+	// 处理中状态不发布事件
+	param = signNotify(t, map[string]string{"out_order_no": "order_3", "trade_status": "PROCESSING"}, priv)
+	if _, err := TradeNotify(ctx, &TradeNotifyRequest{Param: param, PublicKey: pub}); err != nil {
+		t.Fatal(err)
+	}
+
+	bus.Close(ctx)
+	if len(got) != 3 {
+		t.Fatalf("unexpected events %v", got)
+	}
+	// 不同订单间不保证顺序，同一订单按发布顺序
+	refund := []EventType{}
+	for _, typ := range got {
+		if typ != EventTradeClosed {
+			refund = append(refund, typ)
+		}
+	}
+	if len(refund) != 2 || refund[0] != EventRefundRequested || refund[1] != EventRefundSucceeded {
+		t.Fatalf("unexpected refund events %v", refund)
+	}
+}
+
+func TestEventBusRetryKeepsOrder(t *testing.T) {
+	bus := NewEventBus(1)
+	bus.SetRetry(time.Millisecond, 0)
+	ctx := context.Background()
+
+	var failures int
+	var paid, all []string
+	bus.Subscribe(func(ctx context.Context, ev Event) error {
+		if ev.Type == EventTradeCreated && failures < 2 {
+			failures++
+			return errors.New("unavailable")
+		}
+		paid = append(paid, ev.Order.OutNo+":"+string(ev.Type))
+		return nil
+	}, EventTradeCreated, EventTradePaid)
+	// 其他订阅方不受重试影响，只收到一次
+	unsubscribe := bus.Subscribe(func(ctx context.Context, ev Event) error {
+		all = append(all, ev.Id())
+		return nil
+	})
+
+	order := store.Order{Kind: store.KindTrade, MerchantId: "merchant_1", OutNo: "order_1"}
+	bus.Publish(ctx, Event{Type: EventTradeCreated, Order: order})
+	bus.Publish(ctx, Event{Type: EventTradePaid, Order: order})
+	bus.Publish(ctx, Event{Type: EventRefundFailed, Order: store.Order{Kind: store.KindRefund, OutNo: "refund_1"}})
+	bus.Close(ctx)
+	unsubscribe()
+
+	if failures != 2 || len(paid) != 2 || paid[0] != "order_1:TradeCreated" || paid[1] != "order_1:TradePaid" {
+		t.Fatalf("failures %d, events %v", failures, paid)
+	}
+	if len(all) != 3 || all[0] != "trade:merchant_1:order_1:TradeCreated" {
+		t.Fatalf("unexpected events %v", all)
+	}
+	if err := bus.Publish(ctx, Event{Type: EventTradePaid, Order: order}); !errors.Is(err, ErrEventBusClosed) {
+		t.Fatalf("expected ErrEventBusClosed, got %v", err)
+	}
+}
+
+func TestEventBusMaxAttempts(t *testing.T) {
+	bus := NewEventBus(1)
+	bus.SetRetry(time.Millisecond, 3)
+	var attempts int
+	var dropped []string
+	bus.SetDropHandler(func(ev Event, err error) {
+		dropped = append(dropped, ev.Id()+":"+err.Error())
+	})
+	bus.Subscribe(func(ctx context.Context, ev Event) error {
+		attempts++
+		if attempts == 1 {
+			panic("boom")
+		}
+		return errors.New("unavailable")
+	})
+	bus.Publish(context.Background(), Event{Type: EventWithdrawRequested, Order: store.Order{Kind: store.KindWithdraw, OutNo: "w_1"}})
+	bus.Close(context.Background())
+	// panic按失败重试，达到次数后交给DropHandler
+	if attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d", attempts)
+	}
+	if len(dropped) != 1 || dropped[0] != "withdraw::w_1:WithdrawRequested:after 3 attempts: unavailable" {
+		t.Fatalf("unexpected dropped %v", dropped)
+	}
+}
+
+func TestEventBusRecoversPanic(t *testing.T) {
+	bus := NewEventBus(1)
+	bus.SetRetry(time.Millisecond, 0)
+	var got []string
+	bus.Subscribe(func(ctx context.Context, ev Event) error {
+		if ev.Order.OutNo == "order_1" && len(got) == 0 {
+			got = append(got, "panic")
+			panic("boom")
+		}
+		got = append(got, ev.Order.OutNo)
+		return nil
+	})
+	ctx := context.Background()
+	bus.Publish(ctx, Event{Type: EventTradePaid, Order: store.Order{Kind: store.KindTrade, OutNo: "order_1"}})
+	bus.Publish(ctx, Event{Type: EventTradePaid, Order: store.Order{Kind: store.KindTrade, OutNo: "order_2"}})
+	if err := bus.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[1] != "order_1" || got[2] != "order_2" {
+		t.Fatalf("unexpected deliveries %v", got)
+	}
+}
+
+func TestEventBusCloseAbortsRetry(t *testing.T) {
+	bus := NewEventBus(1)
+	bus.SetRetry(time.Hour, 0)
+	var attempts int
+	bus.Subscribe(func(ctx context.Context, ev Event) error {
+		attempts++
+		return errors.New("unavailable")
+	})
+	bus.Publish(context.Background(), Event{Type: EventTradePaid, Order: store.Order{Kind: store.KindTrade, OutNo: "order_1"}})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := bus.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+	if attempts != 1 {
+		t.Fatalf("expected 1 attempt, got %d", attempts)
+	}
+}
+
+func TestPublishOrderDoesNotBlock(t *testing.T) {
+	bus := NewEventBus(1)
+	SetEventBus(bus)
+	defer SetEventBus(nil)
+	release := make(chan struct{})
+	var delivered int
+	bus.Subscribe(func(ctx context.Context, ev Event) error {
+		<-release
+		delivered++
+		return nil
+	})
+
+	var dropped int
+	bus.SetDropHandler(func(ev Event, err error) {
+		if !errors.Is(err, ErrEventQueueFull) || ev.Time.IsZero() {
+			t.Errorf("unexpected drop %v %v", ev, err)
+		}
+		dropped++
+	})
+
+	// 投递协程阻塞时，队列满后的事件交给DropHandler
+	ctx := context.Background()
+	for i := 0; i < DefaultEventQueueSize+10; i++ {
+		publishOrder(ctx, &store.Order{Kind: store.KindTrade, MerchantId: "merchant_1", OutNo: "order_1"}, store.SourceCreate)
+	}
+	close(release)
+	if err := bus.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if delivered < DefaultEventQueueSize || delivered > DefaultEventQueueSize+1 || delivered+dropped != DefaultEventQueueSize+10 {
+		t.Fatalf("unexpected delivered %d, dropped %d", delivered, dropped)
+	}
+}
+
+func TestEventBusPublishDuringClose(t *testing.T) {
+	bus := NewEventBus(1)
+	block := make(chan struct{})
+	bus.Subscribe(func(ctx context.Context, ev Event) error {
+		<-block
+		return nil
+	})
+	ctx := context.Background()
+	order := store.Order{Kind: store.KindTrade, OutNo: "order_1"}
+	for i := 0; i < DefaultEventQueueSize+1; i++ {
+		bus.Publish(ctx, Event{Type: EventTradePaid, Order: order})
+	}
+	// 队列已满，Publish阻塞至关闭
+	errs := make(chan error)
+	go func() { errs <- bus.Publish(ctx, Event{Type: EventTradePaid, Order: order}) }()
+	time.Sleep(10 * time.Millisecond)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(block)
+	}()
+	if err := bus.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errs; !errors.Is(err, ErrEventBusClosed) {
+		t.Fatalf("expected ErrEventBusClosed, got %v", err)
+	}
+}
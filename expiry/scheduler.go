@@ -0,0 +1,264 @@
+// Package expiry 跟踪已创建订单的有效期，在到期前后查询订单状态，
+// 发出已支付、仍待支付、已过期事件，可选地在过期后关闭订单
+//
+// 到期后订单仍处理中时按重试间隔继续查询，直到支付成功、失败、超时或订单不存在；
+// 连续查询失败达到上限时发出EventAbandoned并停止跟踪。
+//
+// SDK未提供关单接口，需要关单时通过SetCloser接入业务自己的实现。
+package expiry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/liaoxxxx/tt_pay"
+	"github.com/liaoxxxx/tt_pay/config"
+	"github.com/liaoxxxx/tt_pay/consts"
+	"github.com/liaoxxxx/tt_pay/util"
+)
+
+const (
+	DefaultCheckBefore   = time.Minute      // 到期前多久查询
+	DefaultCheckAfter    = time.Minute      // 到期后多久查询，用于确认最终状态
+	DefaultRetryInterval = 30 * time.Second // 查询失败后的重试间隔
+	DefaultBatchSize     = 100              // RunOnce每次处理的最大记录数
+	DefaultMaxFailures   = 10               // 连续查询失败多少次后放弃跟踪
+)
+
+// EventType 为事件类型
+type EventType int
+
+const (
+	EventPaid      EventType = iota + 1 // 订单已支付，停止跟踪
+	EventPending                        // 到期前订单仍处理中，到期后会再次查询，Resp不为nil
+	EventExpired                        // 订单失败、超时，或到期后仍不存在，停止跟踪
+	EventAbandoned                      // 连续查询失败达到上限，停止跟踪，订单状态未知
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventPaid:
+		return "paid"
+	case EventPending:
+		return "pending"
+	case EventExpired:
+		return "expired"
+	case EventAbandoned:
+		return "abandoned"
+	}
+	return "unknown"
+}
+
+// Event 为一次查询的结果
+type Event struct {
+	Type     EventType
+	Entry    Entry
+	Resp     *tt_pay.TradeQueryResponse // 订单不存在（仅EventExpired）时为nil
+	Closed   bool                       // EventExpired时Closer已成功关单
+	CloseErr error                      // EventExpired时Closer返回的错误
+	Err      error                      // EventAbandoned时最后一次查询的错误
+}
+
+// Handler 处理事件，在RunOnce中同步调用
+type Handler func(ctx context.Context, ev Event)
+
+// Closer 关闭过期订单，由业务方实现
+type Closer func(ctx context.Context, e Entry) error
+
+// Scheduler 在订单到期前后查询订单状态并发出事件
+type Scheduler struct {
+	config        config.Config
+	store         Store
+	handler       Handler
+	closer        Closer
+	clock         tt_pay.Clock
+	checkBefore   time.Duration
+	checkAfter    time.Duration
+	retryInterval time.Duration
+	maxFailures   int
+}
+
+// NewScheduler 初始化Scheduler，查询使用config，handler可为nil
+// 订单不存在的sub_code未收录时返回util.ErrSubCodeNotRegistered，否则未支付的订单无法识别为已过期
+func NewScheduler(config config.Config, store Store, handler Handler) (*Scheduler, error) {
+	if err := util.RequireCategories(util.CategoryOrderNotExist); err != nil {
+		return nil, fmt.Errorf("expiry: %w", err)
+	}
+	return &Scheduler{
+		config:        config,
+		store:         store,
+		handler:       handler,
+		clock:         clockFunc(tt_pay.Now),
+		checkBefore:   DefaultCheckBefore,
+		checkAfter:    DefaultCheckAfter,
+		retryInterval: DefaultRetryInterval,
+		maxFailures:   DefaultMaxFailures,
+	}, nil
+}
+
+type clockFunc func() time.Time
+
+func (f clockFunc) Now() time.Time { return f() }
+
+// SetClock 设置时间来源，默认与tt_pay.SetClock一致
+func (s *Scheduler) SetClock(c tt_pay.Clock) {
+	s.clock = c
+}
+
+// SetOffsets 设置到期前、到期后的查询时间
+func (s *Scheduler) SetOffsets(before, after time.Duration) {
+	s.checkBefore = before
+	s.checkAfter = after
+}
+
+// SetRetryInterval 设置查询失败后的重试间隔
+func (s *Scheduler) SetRetryInterval(d time.Duration) {
+	s.retryInterval = d
+}
+
+// SetMaxFailures 设置连续查询失败的上限，达到后发出EventAbandoned，0表示不限
+func (s *Scheduler) SetMaxFailures(n int) {
+	s.maxFailures = n
+}
+
+// SetCloser 设置过期订单的关单实现，未设置时只发出EventExpired
+func (s *Scheduler) SetCloser(c Closer) {
+	s.closer = c
+}
+
+// Track 开始跟踪订单，expireAt为订单到期时间
+func (s *Scheduler) Track(ctx context.Context, uid, outOrderNo string, expireAt time.Time) error {
+	next := expireAt.Add(-s.checkBefore)
+	if now := s.clock.Now(); next.Before(now) {
+		next = now
+	}
+	return s.store.Put(ctx, Entry{
+		MerchantId: s.config.MerchantId,
+		Uid:        uid,
+		OutOrderNo: outOrderNo,
+		ExpireAt:   expireAt,
+		NextCheck:  next,
+	})
+}
+
+// TrackRequest 按下单请求的TradeTime与ValidTime跟踪订单
+func (s *Scheduler) TrackRequest(ctx context.Context, req *tt_pay.TradeCreateRequest) error {
+	if req.TradeTime.IsZero() || req.ValidTime <= 0 {
+		return fmt.Errorf("expiry: %s has no TradeTime or ValidTime", req.OutOrderNo)
+	}
+	return s.Track(ctx, req.Uid, req.OutOrderNo, req.TradeTime.Add(req.ValidTime))
+}
+
+// Run 每隔interval调用一次RunOnce，直到ctx结束，应在单独的goroutine中运行
+func (s *Scheduler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.RunOnce(ctx); err != nil {
+			util.Debug("expiry: run failed: err[%s]", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce 处理已到查询时间的订单，返回处理的记录数
+func (s *Scheduler) RunOnce(ctx context.Context) (int, error) {
+	entries, err := s.store.Due(ctx, s.clock.Now(), DefaultBatchSize)
+	if err != nil {
+		return 0, util.Wrap(err, "expiry: Store.Due failed")
+	}
+	for i, e := range entries {
+		if ctx.Err() != nil {
+			return i, ctx.Err()
+		}
+		if err := s.check(ctx, e); err != nil {
+			return i, err
+		}
+	}
+	return len(entries), nil
+}
+
+// 查询订单并按结果发出事件、更新记录，只返回存储的错误
+func (s *Scheduler) check(ctx context.Context, e Entry) error {
+	req := tt_pay.NewTradeQueryRequest(s.config)
+	req.Uid = e.Uid
+	req.OutOrderNo = e.OutOrderNo
+	resp, err := tt_pay.TradeQuery(ctx, req)
+	now := s.clock.Now()
+	switch {
+	case err == nil && resp.TradeStatus == consts.TradeStatusSuccess:
+		if err := s.store.Delete(ctx, e.MerchantId, e.OutOrderNo); err != nil {
+			return util.Wrap(err, "expiry: Store.Delete failed")
+		}
+		s.emit(ctx, Event{Type: EventPaid, Entry: e, Resp: resp})
+	case err == nil && (resp.TradeStatus == consts.TradeStatusFail || resp.TradeStatus == consts.TradeStatusTimeout):
+		// 已是终态，无需等到到期后再查询
+		return s.expire(ctx, e, resp)
+	case err == nil || errors.Is(err, util.ErrOrderNotExist):
+		e.Failures = 0
+		afterCheck := e.ExpireAt.Add(s.checkAfter)
+		if !e.Checked && now.Before(afterCheck) {
+			e.Checked = true
+			e.NextCheck = afterCheck
+			if err := s.store.Put(ctx, e); err != nil {
+				return util.Wrap(err, "expiry: Store.Put failed")
+			}
+			// 到期前订单不存在时不发事件，到期后再确认
+			if resp != nil {
+				s.emit(ctx, Event{Type: EventPending, Entry: e, Resp: resp})
+			}
+			return nil
+		}
+		// 到期后仍处理中的订单可能随后支付成功，继续查询直到终态
+		if err == nil {
+			e.Checked = true
+			e.NextCheck = now.Add(s.retryInterval)
+			if err := s.store.Put(ctx, e); err != nil {
+				return util.Wrap(err, "expiry: Store.Put failed")
+			}
+			return nil
+		}
+		return s.expire(ctx, e, nil)
+	default:
+		util.Debug("expiry: query %s failed: err[%s]", e.OutOrderNo, err)
+		e.Failures++
+		if s.maxFailures > 0 && e.Failures >= s.maxFailures {
+			if err := s.store.Delete(ctx, e.MerchantId, e.OutOrderNo); err != nil {
+				return util.Wrap(err, "expiry: Store.Delete failed")
+			}
+			s.emit(ctx, Event{Type: EventAbandoned, Entry: e, Err: err})
+			return nil
+		}
+		e.NextCheck = now.Add(s.retryInterval)
+		if err := s.store.Put(ctx, e); err != nil {
+			return util.Wrap(err, "expiry: Store.Put failed")
+		}
+	}
+	return nil
+}
+
+// 停止跟踪过期订单，配置了Closer时先关单
+func (s *Scheduler) expire(ctx context.Context, e Entry, resp *tt_pay.TradeQueryResponse) error {
+	ev := Event{Type: EventExpired, Entry: e, Resp: resp}
+	if s.closer != nil {
+		ev.CloseErr = s.closer(ctx, e)
+		ev.Closed = ev.CloseErr == nil
+	}
+	if err := s.store.Delete(ctx, e.MerchantId, e.OutOrderNo); err != nil {
+		return util.Wrap(err, "expiry: Store.Delete failed")
+	}
+	s.emit(ctx, ev)
+	return nil
+}
+
+func (s *Scheduler) emit(ctx context.Context, ev Event) {
+	if s.handler != nil {
+		s.handler(ctx, ev)
+	}
+}
@@ -0,0 +1,224 @@
+package expiry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/liaoxxxx/tt_pay"
+	"github.com/liaoxxxx/tt_pay/config"
+	"github.com/liaoxxxx/tt_pay/util"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.t }
+
+func (c *fakeClock) Advance(d time.Duration) { c.t = c.t.Add(d) }
+
+// 本地网关桩，按out_order_no返回订单状态，状态为空时订单不存在，为"502"时返回502
+type stubGateway struct {
+	mu     sync.Mutex
+	status map[string]string
+}
+
+func (g *stubGateway) set(outOrderNo, status string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.status[outOrderNo] = status
+}
+
+func newStubGateway(t *testing.T) (*stubGateway, string) {
+	t.Helper()
+	g := &stubGateway{status: make(map[string]string)}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var biz map[string]interface{}
+		json.Unmarshal([]byte(r.FormValue("biz_content")), &biz)
+		no, _ := biz["out_order_no"].(string)
+		g.mu.Lock()
+		status := g.status[no]
+		g.mu.Unlock()
+		switch status {
+		case "":
+			w.Write([]byte(`{"response":{"code":"40004","msg":"Business Failed","sub_code":"TP.TRADE_NOT_EXIST"}}`))
+		case "502":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.Write([]byte(`{"response":{"code":"10000","msg":"Success","out_order_no":"` + no + `","trade_status":"` + status + `"}}`))
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return g, ts.URL
+}
+
+func testConfig(domain string) config.Config {
+	return config.Config{
+		AppId:             "app_1",
+		AppSecret:         "test-app-secret-0123456789",
+		MerchantId:        "merchant_1",
+		TPDomain:          domain,
+		TPClientTimeoutMs: 3000,
+	}
+}
+
+func TestSchedulerEvents(t *testing.T) {
+	registerTestSubCodes(t)
+	ctx := context.Background()
+	g, domain := newStubGateway(t)
+	clock := &fakeClock{t: time.Unix(1565000000, 0)}
+	store := NewMemoryStore()
+
+	var events []string
+	s, err := NewScheduler(testConfig(domain), store, func(ctx context.Context, ev Event) {
+		events = append(events, ev.Entry.OutOrderNo+":"+ev.Type.String())
+		if ev.Type == EventPending && ev.Resp == nil {
+			t.Errorf("pending event without response for %s", ev.Entry.OutOrderNo)
+		}
+		if ev.Type == EventExpired && ev.Entry.OutOrderNo == "order_late" && !ev.Closed {
+			t.Errorf("expected order_late closed, got %v", ev.CloseErr)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetClock(clock)
+	s.SetMaxFailures(3)
+	var closed []string
+	s.SetCloser(func(ctx context.Context, e Entry) error {
+		closed = append(closed, e.OutOrderNo)
+		return nil
+	})
+
+	expireAt := clock.Now().Add(10 * time.Minute)
+	for _, no := range []string{"order_paid", "order_late", "order_gone", "order_failed", "order_flaky", "order_down"} {
+		if err := s.Track(ctx, "uid_1", no, expireAt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g.set("order_paid", "SUCCESS")
+	g.set("order_late", "PROCESSING")
+	g.set("order_failed", "FAIL")
+	g.set("order_flaky", "502")
+	g.set("order_down", "502")
+
+	// 未到查询时间
+	if n, err := s.RunOnce(ctx); err != nil || n != 0 {
+		t.Fatalf("RunOnce = %d, %v", n, err)
+	}
+
+	clock.Advance(9 * time.Minute)
+	if n, err := s.RunOnce(ctx); err != nil || n != 6 {
+		t.Fatalf("RunOnce = %d, %v", n, err)
+	}
+	// 已失败的订单不等到期，不存在的订单到期前不发事件
+	if len(events) != 3 || events[0] != "order_failed:expired" || events[1] != "order_late:pending" || events[2] != "order_paid:paid" {
+		t.Fatalf("unexpected events %v", events)
+	}
+	// 查询失败的订单按重试间隔再查
+	due, _ := store.Due(ctx, clock.Now().Add(DefaultRetryInterval), 0)
+	if len(due) != 2 || due[0].OutOrderNo != "order_down" || due[1].OutOrderNo != "order_flaky" || due[1].Failures != 1 {
+		t.Fatalf("unexpected retry entries %+v", due)
+	}
+
+	events = nil
+	g.set("order_flaky", "SUCCESS")
+	clock.Advance(DefaultRetryInterval)
+	if _, err := s.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0] != "order_flaky:paid" {
+		t.Fatalf("unexpected events %v", events)
+	}
+	// 连续失败达到上限后放弃跟踪
+	clock.Advance(DefaultRetryInterval)
+	if _, err := s.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[1] != "order_down:abandoned" {
+		t.Fatalf("unexpected events %v", events)
+	}
+
+	// 到期后仍处理中的订单继续查询，不过期
+	events = nil
+	clock.Advance(2 * time.Minute)
+	if _, err := s.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0] != "order_gone:expired" {
+		t.Fatalf("unexpected events %v", events)
+	}
+	g.set("order_late", "TIMEOUT")
+	clock.Advance(DefaultRetryInterval)
+	if _, err := s.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[1] != "order_late:expired" {
+		t.Fatalf("unexpected events %v", events)
+	}
+	if len(closed) != 3 || store.Len() != 0 {
+		t.Fatalf("closed %v, remaining %d", closed, store.Len())
+	}
+}
+
+func TestTrackRequest(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1565000000, 0)}
+	store := NewMemoryStore()
+	// 默认码表无法识别订单不存在
+	if _, err := NewScheduler(testConfig(""), store, nil); !errors.Is(err, util.ErrSubCodeNotRegistered) {
+		t.Fatalf("expected ErrSubCodeNotRegistered, got %v", err)
+	}
+	registerTestSubCodes(t)
+	s, err := NewScheduler(testConfig(""), store, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetClock(clock)
+
+	req := tt_pay.NewTradeCreateRequest(testConfig(""))
+	req.OutOrderNo = "order_1"
+	if err := s.TrackRequest(context.Background(), req); err == nil {
+		t.Fatal("expected error without ValidTime")
+	}
+	req.TradeTime = clock.Now()
+	req.ValidTime = 30 * time.Second
+	if err := s.TrackRequest(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	// 有效期短于CheckBefore时立即查询
+	due, _ := store.Due(context.Background(), clock.Now(), 0)
+	if len(due) != 1 || !due[0].ExpireAt.Equal(clock.Now().Add(30*time.Second)) {
+		t.Fatalf("unexpected entries %+v", due)
+	}
+	if _, err := s.RunOnce(canceledContext()); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected canceled, got %v", err)
+	}
+}
+
+func canceledContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}
+
+// 测试桩使用的sub_code，实际值以财经侧接口文档为准，由接入方通过util.RegisterSubCode收录
+func registerTestSubCodes(t *testing.T) {
+	t.Helper()
+	codes := map[string]util.Category{
+		"TP.TRADE_NOT_EXIST": util.CategoryOrderNotExist,
+	}
+	for code, c := range codes {
+		util.RegisterSubCode(code, c)
+	}
+	t.Cleanup(func() {
+		for code := range codes {
+			util.UnregisterSubCode(code)
+		}
+	})
+}
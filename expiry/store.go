@@ -0,0 +1,87 @@
+package expiry
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Entry 为一笔被跟踪的订单
+type Entry struct {
+	MerchantId string
+	Uid        string
+	OutOrderNo string
+	ExpireAt   time.Time // 订单到期时间
+	NextCheck  time.Time // 下次查询时间
+	Checked    bool      // 到期前的查询已完成
+	Failures   int       // 连续查询失败次数
+}
+
+// Store 为跟踪记录的存储接口，MerchantId、OutOrderNo唯一确定一条记录，实现需保证并发安全
+type Store interface {
+	// Put 新增或覆盖记录
+	Put(ctx context.Context, e Entry) error
+	// Due 按NextCheck先后返回不晚于now的记录，最多limit条
+	Due(ctx context.Context, now time.Time, limit int) ([]Entry, error)
+	// Delete 删除记录，不存在时不报错
+	Delete(ctx context.Context, merchantId, outOrderNo string) error
+}
+
+type entryKey struct {
+	merchantId string
+	outOrderNo string
+}
+
+// MemoryStore 为内存实现，适用于测试及单机场景，进程重启后记录丢失
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[entryKey]Entry
+}
+
+// NewMemoryStore 初始化MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[entryKey]Entry)}
+}
+
+func (s *MemoryStore) Put(ctx context.Context, e Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[entryKey{e.MerchantId, e.OutOrderNo}] = e
+	return nil
+}
+
+func (s *MemoryStore) Due(ctx context.Context, now time.Time, limit int) ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ret []Entry
+	for _, e := range s.entries {
+		if !e.NextCheck.After(now) {
+			ret = append(ret, e)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].NextCheck.Equal(ret[j].NextCheck) {
+			return ret[i].OutOrderNo < ret[j].OutOrderNo
+		}
+		return ret[i].NextCheck.Before(ret[j].NextCheck)
+	})
+	if limit > 0 && len(ret) > limit {
+		ret = ret[:limit]
+	}
+	return ret, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, merchantId, outOrderNo string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, entryKey{merchantId, outOrderNo})
+	return nil
+}
+
+// Len 返回跟踪中的记录数
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
@@ -0,0 +1,146 @@
+package tt_pay
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/liaoxxxx/tt_pay/config"
+)
+
+// DefaultDomainCooldown 域名连接失败后被标记为不可用的时长
+const DefaultDomainCooldown = 30 * time.Second
+
+// DomainStatus 为域名的健康状态，用于诊断
+type DomainStatus struct {
+	Domain    string
+	Healthy   bool
+	Failures  int       // 连续连接失败次数
+	DownUntil time.Time // 不可用截止时间，Healthy为true时为零值
+}
+
+type domainState struct {
+	failures  int
+	downUntil time.Time
+}
+
+var (
+	domainLock     sync.Mutex
+	domainStates   = make(map[string]*domainState)
+	domainCooldown = DefaultDomainCooldown
+	domainNow      = time.Now
+)
+
+// SetDomainCooldown 设置域名连接失败后被跳过的时长，期间优先使用后续域名
+func SetDomainCooldown(d time.Duration) {
+	domainLock.Lock()
+	defer domainLock.Unlock()
+	domainCooldown = d
+}
+
+// ActiveDomain 返回config中当前使用的域名，即按优先级第一个可用的域名
+// 所有域名都不可用时返回主域名
+func ActiveDomain(config config.Config) string {
+	return orderDomains(config.GetDomains())[0]
+}
+
+// DomainHealth 返回config中各域名的健康状态，顺序与配置一致
+func DomainHealth(config config.Config) []DomainStatus {
+	domainLock.Lock()
+	defer domainLock.Unlock()
+	now := domainNow()
+	var ret []DomainStatus
+	for _, d := range config.GetDomains() {
+		status := DomainStatus{Domain: d, Healthy: true}
+		if s, ok := domainStates[d]; ok {
+			status.Failures = s.failures
+			if now.Before(s.downUntil) {
+				status.Healthy = false
+				status.DownUntil = s.downUntil
+			}
+		}
+		ret = append(ret, status)
+	}
+	return ret
+}
+
+// 按尝试顺序返回域名：可用的域名在前，均保持配置顺序
+func orderDomains(domains []string) []string {
+	if len(domains) <= 1 {
+		return domains
+	}
+	domainLock.Lock()
+	defer domainLock.Unlock()
+	now := domainNow()
+	healthy := make([]string, 0, len(domains))
+	var down []string
+	for _, d := range domains {
+		if s, ok := domainStates[d]; ok && now.Before(s.downUntil) {
+			down = append(down, d)
+			continue
+		}
+		healthy = append(healthy, d)
+	}
+	return append(healthy, down...)
+}
+
+func markDomain(domain string, ok bool) {
+	domainLock.Lock()
+	defer domainLock.Unlock()
+	s, exists := domainStates[domain]
+	if ok {
+		if exists {
+			delete(domainStates, domain)
+		}
+		return
+	}
+	if !exists {
+		s = &domainState{}
+		domainStates[domain] = s
+	}
+	s.failures++
+	s.downUntil = domainNow().Add(domainCooldown)
+}
+
+// 支持多域名的Request，嵌入config.Config的生成代码均已实现
+type domainRequest interface {
+	GetDomains() []string
+	GetPath() string
+}
+
+// 发送网关请求，配置多个域名时，连接失败或熔断断开则切换到下一个域名
+// 只在请求确定未发出时切换，超时、5xx等结果未知的情况不切换，避免重复提交
+func postGateway(ctx context.Context, req TPRequest, body, logId string, timeout int) (int, []byte, error) {
+	dr, ok := req.(domainRequest)
+	if !ok || len(dr.GetDomains()) <= 1 {
+		return postUrl(ctx, req.GetUrl(), body, logId, timeout)
+	}
+	var (
+		statusCode int
+		respBytes  []byte
+		err        error
+	)
+	for _, domain := range orderDomains(dr.GetDomains()) {
+		statusCode, respBytes, err = postUrl(ctx, domain+"/"+dr.GetPath(), body, logId, timeout)
+		if err == nil {
+			markDomain(domain, true)
+			return statusCode, respBytes, nil
+		}
+		if errors.Is(err, ErrCircuitOpen) {
+			continue
+		}
+		if !isConnectError(err) || ctx.Err() != nil {
+			return statusCode, respBytes, err
+		}
+		markDomain(domain, false)
+	}
+	return statusCode, respBytes, err
+}
+
+// 判断是否为建立连接失败，此时请求未发出
+func isConnectError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
@@ -0,0 +1,122 @@
+package tt_pay
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/liaoxxxx/tt_pay/util"
+)
+
+func resetDomainStates(t *testing.T) *fakeClock {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	domainNow = clock.Now
+	t.Cleanup(func() {
+		domainLock.Lock()
+		domainStates = make(map[string]*domainState)
+		domainLock.Unlock()
+		domainNow = time.Now
+	})
+	return clock
+}
+
+// 返回一个无法建立连接的域名
+func deadDomain(t *testing.T) string {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	ts.Close()
+	return ts.URL
+}
+
+func TestDomainFailover(t *testing.T) {
+	clock := resetDomainStates(t)
+	primary := deadDomain(t)
+	calls := 0
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path != "/gateway" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		w.Write([]byte(`{"response":{"code":"10000","msg":"Success","out_order_no":"order_1"}}`))
+	}))
+	defer backup.Close()
+
+	config := testConfig("")
+	config.TPDomains = []string{primary, backup.URL}
+	query := func() error {
+		req := NewTradeQueryRequest(config)
+		req.Uid = testUid
+		req.OutOrderNo = "order_1"
+		_, err := TradeQuery(context.Background(), req)
+		return err
+	}
+
+	if ActiveDomain(config) != primary {
+		t.Fatalf("expected primary to be active")
+	}
+	if err := query(); err != nil {
+		t.Fatal(err)
+	}
+	if ActiveDomain(config) != backup.URL {
+		t.Errorf("expected backup to be active, got %s", ActiveDomain(config))
+	}
+	health := DomainHealth(config)
+	if health[0].Healthy || health[0].Failures != 1 || !health[1].Healthy {
+		t.Errorf("unexpected health %+v", health)
+	}
+
+	// 冷却期内直接使用备用域名
+	if err := query(); err != nil {
+		t.Fatal(err)
+	}
+	if h := DomainHealth(config); h[0].Failures != 1 || calls != 2 {
+		t.Errorf("unexpected health %+v, calls %d", h, calls)
+	}
+
+	// 冷却期过后重新尝试主域名
+	clock.Advance(DefaultDomainCooldown)
+	if ActiveDomain(config) != primary {
+		t.Errorf("expected primary after cooldown")
+	}
+	if err := query(); err != nil {
+		t.Fatal(err)
+	}
+	if h := DomainHealth(config); h[0].Failures != 2 {
+		t.Errorf("unexpected health %+v", h)
+	}
+}
+
+func TestDomainNoFailoverOnServerError(t *testing.T) {
+	resetDomainStates(t)
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer primary.Close()
+	backupCalls := 0
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backupCalls++
+	}))
+	defer backup.Close()
+
+	config := testConfig("")
+	config.TPDomains = []string{primary.URL, backup.URL}
+	req := NewRefundCreateRequest(config)
+	req.Uid = testUid
+	req.OutOrderNo = "order_1"
+	req.OutRefundNo = "refund_1"
+	req.RefundAmount = 1
+	req.NotifyUrl = "https://example.com/notify"
+	req.RiskInfo = `{"ip":"` + testIp + `"}`
+	// 5xx时请求可能已被受理，不能切换域名重复提交
+	if _, err := RefundCreate(context.Background(), req); !errors.Is(err, util.ErrNetwork) {
+		t.Fatalf("expected network error, got %v", err)
+	}
+	if backupCalls != 0 {
+		t.Errorf("must not fail over on 5xx")
+	}
+	if !DomainHealth(config)[0].Healthy {
+		t.Errorf("5xx must not mark domain down")
+	}
+}
@@ -0,0 +1,24 @@
+package tt_pay
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// 输出Request的导出字段，生成代码的String、GoString方法调用此函数
+// Request嵌入了config.Config，若不覆盖会提升Config的String方法，只输出配置；
+// 这里Config字段仍使用其String方法，AppSecret已脱敏
+func formatRequest(req interface{}) string {
+	v := reflect.Indirect(reflect.ValueOf(req))
+	t := v.Type()
+	fields := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		fields = append(fields, fmt.Sprintf("%s:%v", f.Name, v.Field(i).Interface()))
+	}
+	return "&" + t.Name() + "{" + strings.Join(fields, " ") + "}"
+}
@@ -0,0 +1,286 @@
+// Package forwarder 将验签通过的财经侧回调转发给内部服务：
+// 回调经SDK验签后以内部HMAC密钥重新签名，以JSON POST给订阅了该类型的各个服务，
+// 失败时按退避重试，每次尝试都交给Recorder记录。
+//
+// 转发在后台进行，不影响应答财经侧；需要持久化时可在outbox的处理函数中调用Forward。
+package forwarder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/liaoxxxx/tt_pay"
+	"github.com/liaoxxxx/tt_pay/consts"
+	"github.com/liaoxxxx/tt_pay/util"
+)
+
+const (
+	DefaultMaxAttempts   = 5
+	DefaultRetryInterval = time.Second // 首次重试间隔，之后每次翻倍
+	DefaultTimeout       = 5 * time.Second
+	maxRetryInterval     = time.Minute
+)
+
+// Subscriber 为一个内部服务
+type Subscriber struct {
+	Name  string
+	Url   string
+	Types []string // 订阅的回调类型，如consts.NotifyTypeTrade，为空时订阅全部
+}
+
+func (s Subscriber) accepts(typ string) bool {
+	if len(s.Types) == 0 {
+		return true
+	}
+	for _, t := range s.Types {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// Payload 为转发的请求体
+type Payload struct {
+	Id         string            `json:"id"`
+	Type       string            `json:"type"`
+	Param      map[string]string `json:"param"` // 回调的全部参数
+	ReceivedAt time.Time         `json:"received_at"`
+}
+
+// DeliveryError 为未能投递的订阅方及最后一次的错误
+type DeliveryError struct {
+	Failed map[string]error
+}
+
+func (e *DeliveryError) Error() string {
+	names := make([]string, 0, len(e.Failed))
+	for name, err := range e.Failed {
+		names = append(names, fmt.Sprintf("%s: %v", name, err))
+	}
+	sort.Strings(names)
+	return "forwarder: delivery failed: " + strings.Join(names, "; ")
+}
+
+// 非重试类的错误，如4xx响应
+type permanentError struct {
+	error
+}
+
+// Forwarder 验签并转发回调
+type Forwarder struct {
+	key         []byte
+	subscribers []Subscriber
+	client      *http.Client
+	recorder    Recorder
+	maxAttempts int
+	interval    time.Duration
+	wg          sync.WaitGroup
+	stop        chan struct{}
+	stopOnce    sync.Once
+}
+
+// New 初始化Forwarder，key为内部HMAC密钥
+func New(key []byte, subscribers ...Subscriber) *Forwarder {
+	return &Forwarder{
+		key:         key,
+		subscribers: subscribers,
+		client:      &http.Client{Timeout: DefaultTimeout},
+		maxAttempts: DefaultMaxAttempts,
+		interval:    DefaultRetryInterval,
+		stop:        make(chan struct{}),
+	}
+}
+
+// SetHttpClient 设置转发使用的http.Client
+func (f *Forwarder) SetHttpClient(c *http.Client) {
+	f.client = c
+}
+
+// SetRecorder 设置投递记录，未设置时不记录
+func (f *Forwarder) SetRecorder(r Recorder) {
+	f.recorder = r
+}
+
+// SetRetry 设置每个订阅方的最大投递次数及首次重试间隔
+func (f *Forwarder) SetRetry(maxAttempts int, interval time.Duration) {
+	f.maxAttempts = maxAttempts
+	f.interval = interval
+}
+
+// TradeNotify 验签下单回调，通过后在后台转发
+func (f *Forwarder) TradeNotify(ctx context.Context, req *tt_pay.TradeNotifyRequest) (*tt_pay.TradeNotifyResponse, error) {
+	resp, err := tt_pay.TradeNotify(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	f.forwardAsync(consts.NotifyTypeTrade, resp.Param)
+	return resp, nil
+}
+
+// RefundNotify 验签退款回调，通过后在后台转发
+func (f *Forwarder) RefundNotify(ctx context.Context, req *tt_pay.RefundNotifyRequest) (*tt_pay.RefundNotifyResponse, error) {
+	resp, err := tt_pay.RefundNotify(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	f.forwardAsync(consts.NotifyTypeRefund, resp.Param)
+	return resp, nil
+}
+
+// WithdrawNotify 验签提现回调，通过后在后台转发
+func (f *Forwarder) WithdrawNotify(ctx context.Context, req *tt_pay.WithdrawNotifyRequest) (*tt_pay.WithdrawNotifyResponse, error) {
+	resp, err := tt_pay.WithdrawNotify(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	f.forwardAsync(consts.NotifyTypeWithdraw, resp.Param)
+	return resp, nil
+}
+
+func (f *Forwarder) forwardAsync(typ string, param map[string]string) {
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		if err := f.Forward(context.Background(), typ, param); err != nil {
+			log.Printf("tt_pay: %v", err)
+		}
+	}()
+}
+
+// Forward 将已验签的回调参数同步转发给订阅了typ的全部订阅方，各订阅方并行投递
+// 有订阅方最终失败时返回*DeliveryError
+func (f *Forwarder) Forward(ctx context.Context, typ string, param map[string]string) error {
+	payload := Payload{Id: tt_pay.NotifyMessageId(typ, param), Type: typ, Param: param, ReceivedAt: tt_pay.Now()}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return util.Wrap(err, "Forward failed when [json.Marshal()]")
+	}
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		failed = make(map[string]error)
+	)
+	for _, s := range f.subscribers {
+		if !s.accepts(typ) {
+			continue
+		}
+		wg.Add(1)
+		go func(s Subscriber) {
+			defer wg.Done()
+			if err := f.deliver(ctx, s, payload, body); err != nil {
+				mu.Lock()
+				failed[s.Name] = err
+				mu.Unlock()
+			}
+		}(s)
+	}
+	wg.Wait()
+	if len(failed) > 0 {
+		return &DeliveryError{Failed: failed}
+	}
+	return nil
+}
+
+// 投递给单个订阅方，网络错误、5xx及429时重试
+func (f *Forwarder) deliver(ctx context.Context, s Subscriber, payload Payload, body []byte) error {
+	interval := f.interval
+	for attempt := 1; ; attempt++ {
+		start := tt_pay.Now()
+		code, err := f.post(ctx, s, payload, body)
+		a := Attempt{
+			Id:         payload.Id,
+			Type:       payload.Type,
+			Subscriber: s.Name,
+			Attempt:    attempt,
+			StatusCode: code,
+			At:         start,
+			Duration:   tt_pay.Now().Sub(start),
+		}
+		if err != nil {
+			a.Error = err.Error()
+		}
+		f.record(ctx, a)
+		if err == nil {
+			return nil
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) || attempt >= f.maxAttempts {
+			return err
+		}
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-f.stop:
+			return err
+		}
+		if interval *= 2; interval > maxRetryInterval {
+			interval = maxRetryInterval
+		}
+	}
+}
+
+func (f *Forwarder) post(ctx context.Context, s Subscriber, payload Payload, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, &permanentError{err}
+	}
+	ts := tt_pay.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, payload.Type)
+	req.Header.Set(HeaderDelivery, payload.Id)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	req.Header.Set(HeaderSignature, Sign(f.key, ts, body))
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return resp.StatusCode, nil
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return resp.StatusCode, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, &permanentError{fmt.Errorf("status %d", resp.StatusCode)}
+}
+
+func (f *Forwarder) record(ctx context.Context, a Attempt) {
+	if f.recorder == nil {
+		return
+	}
+	if err := f.recorder.Record(ctx, a); err != nil {
+		log.Printf("tt_pay: record delivery [%s] to %s failed: %v", a.Id, a.Subscriber, err)
+	}
+}
+
+// Close 等待后台转发结束，ctx结束时放弃未完成的重试并返回ctx.Err()，之后不应再转发回调
+func (f *Forwarder) Close(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		f.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		f.stopOnce.Do(func() { close(f.stop) })
+		<-done
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,203 @@
+package forwarder
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/liaoxxxx/tt_pay"
+	"github.com/liaoxxxx/tt_pay/consts"
+	"github.com/liaoxxxx/tt_pay/util"
+)
+
+var testKey = []byte("internal-hmac-key")
+
+func newTestKeyPair(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	private := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	public := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})
+	return string(private), string(public)
+}
+
+func signNotify(t *testing.T, params map[string]string, privateKey string) string {
+	t.Helper()
+	signMap := make(map[string]interface{})
+	values := url.Values{}
+	for k, v := range params {
+		signMap[k] = v
+		values.Set(k, v)
+	}
+	sign, err := util.BuildMd5WithRsa(signMap, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values.Set("sign", sign)
+	return values.Encode()
+}
+
+// 内部服务桩，按顺序返回statuses中的状态码，用完后返回200
+type subscriberStub struct {
+	t        *testing.T
+	mu       sync.Mutex
+	statuses []int
+	received []Payload
+}
+
+func newSubscriberStub(t *testing.T, statuses ...int) (*subscriberStub, string) {
+	s := &subscriberStub{t: t, statuses: statuses}
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	return s, ts.URL
+}
+
+func (s *subscriberStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := VerifyRequest(r, testKey, time.Now(), time.Minute)
+	if err != nil {
+		s.t.Errorf("VerifyRequest: %v", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var p Payload
+	if err := json.Unmarshal(body, &p); err != nil {
+		s.t.Errorf("unmarshal payload: %v", err)
+	}
+	if r.Header.Get(HeaderDelivery) != p.Id || r.Header.Get(HeaderEvent) != p.Type {
+		s.t.Errorf("unexpected headers %v", r.Header)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.received = append(s.received, p)
+	if len(s.statuses) > 0 {
+		w.WriteHeader(s.statuses[0])
+		s.statuses = s.statuses[1:]
+	}
+}
+
+func (s *subscriberStub) payloads() []Payload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Payload(nil), s.received...)
+}
+
+func TestForwarderNotify(t *testing.T) {
+	ctx := context.Background()
+	trade, tradeUrl := newSubscriberStub(t)
+	refund, refundUrl := newSubscriberStub(t)
+	recorder := NewMemoryRecorder()
+	f := New(testKey,
+		Subscriber{Name: "orders", Url: tradeUrl},
+		Subscriber{Name: "refunds", Url: refundUrl, Types: []string{consts.NotifyTypeRefund}},
+	)
+	f.SetRecorder(recorder)
+
+	priv, pub := newTestKeyPair(t)
+	param := signNotify(t, map[string]string{
+		"notify_id":    "n_1",
+		"out_order_no": "order_1",
+		"trade_status": "SUCCESS",
+	}, priv)
+	if _, err := f.TradeNotify(ctx, &tt_pay.TradeNotifyRequest{Param: param, PublicKey: pub}); err != nil {
+		t.Fatal(err)
+	}
+	// 验签失败的回调不转发
+	bad := &tt_pay.TradeNotifyRequest{Param: strings.Replace(param, "order_1", "order_2", 1), PublicKey: pub}
+	if _, err := f.TradeNotify(ctx, bad); !errors.Is(err, util.ErrInvalidSign) {
+		t.Fatalf("expected ErrInvalidSign, got %v", err)
+	}
+	if err := f.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	got := trade.payloads()
+	if len(got) != 1 || got[0].Id != "trade.notify:n_1" || got[0].Param["out_order_no"] != "order_1" {
+		t.Fatalf("unexpected payloads %+v", got)
+	}
+	if len(refund.payloads()) != 0 {
+		t.Fatalf("refund subscriber received trade notify")
+	}
+	attempts := recorder.Attempts("trade.notify:n_1")
+	if len(attempts) != 1 || !attempts[0].Success() || attempts[0].StatusCode != 200 || attempts[0].Subscriber != "orders" {
+		t.Fatalf("unexpected attempts %+v", attempts)
+	}
+}
+
+func TestForwarderRetry(t *testing.T) {
+	flaky, flakyUrl := newSubscriberStub(t, 503, 502)
+	_, rejectUrl := newSubscriberStub(t, 400)
+	recorder := NewMemoryRecorder()
+	f := New(testKey, Subscriber{Name: "flaky", Url: flakyUrl}, Subscriber{Name: "reject", Url: rejectUrl})
+	f.SetRecorder(recorder)
+	f.SetRetry(3, time.Millisecond)
+
+	err := f.Forward(context.Background(), consts.NotifyTypeWithdraw, map[string]string{"out_trade_no": "w_1"})
+	var de *DeliveryError
+	if !errors.As(err, &de) || len(de.Failed) != 1 || de.Failed["reject"] == nil {
+		t.Fatalf("expected reject to fail, got %v", err)
+	}
+	if len(flaky.payloads()) != 3 {
+		t.Fatalf("expected 3 deliveries, got %d", len(flaky.payloads()))
+	}
+
+	var flakyAttempts, rejectAttempts []Attempt
+	for _, a := range recorder.Attempts("") {
+		if a.Subscriber == "flaky" {
+			flakyAttempts = append(flakyAttempts, a)
+		} else {
+			rejectAttempts = append(rejectAttempts, a)
+		}
+	}
+	if len(flakyAttempts) != 3 || flakyAttempts[0].StatusCode != 503 || flakyAttempts[2].Attempt != 3 || !flakyAttempts[2].Success() {
+		t.Fatalf("unexpected flaky attempts %+v", flakyAttempts)
+	}
+	// 4xx不重试
+	if len(rejectAttempts) != 1 || rejectAttempts[0].Success() {
+		t.Fatalf("unexpected reject attempts %+v", rejectAttempts)
+	}
+	// 没有notify_id时按参数生成Id，重试间保持不变
+	if flakyAttempts[0].Id != flakyAttempts[2].Id || !strings.HasPrefix(flakyAttempts[0].Id, "withdraw.notify:") {
+		t.Fatalf("unexpected id %s", flakyAttempts[0].Id)
+	}
+}
+
+func TestVerifyRequest(t *testing.T) {
+	body := []byte(`{"id":"trade.notify:n_1"}`)
+	now := time.Unix(1565000000, 0)
+	newRequest := func(body []byte, ts int64, key []byte) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(body)))
+		r.Header.Set(HeaderTimestamp, "1565000000")
+		r.Header.Set(HeaderSignature, Sign(key, ts, body))
+		return r
+	}
+	if _, err := VerifyRequest(newRequest(body, now.Unix(), testKey), testKey, now, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyRequest(newRequest(body, now.Unix(), []byte("other")), testKey, now, time.Minute); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature, got %v", err)
+	}
+	// 签名时间与头部不一致
+	if _, err := VerifyRequest(newRequest(body, now.Unix()+1, testKey), testKey, now, time.Minute); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature, got %v", err)
+	}
+	if _, err := VerifyRequest(newRequest(body, now.Unix(), testKey), testKey, now.Add(2*time.Minute), time.Minute); !errors.Is(err, ErrExpiredSignature) {
+		t.Fatalf("expected ErrExpiredSignature, got %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package forwarder
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Attempt 为一次投递尝试
+type Attempt struct {
+	Id         string // 消息Id
+	Type       string
+	Subscriber string
+	Attempt    int // 从1开始
+	StatusCode int // 未收到响应时为0
+	Error      string
+	At         time.Time
+	Duration   time.Duration
+}
+
+// Success 是否投递成功
+func (a Attempt) Success() bool {
+	return a.Error == ""
+}
+
+// Recorder 记录投递尝试，实现需保证并发安全，记录失败只打印日志
+type Recorder interface {
+	Record(ctx context.Context, a Attempt) error
+}
+
+// MemoryRecorder 为内存实现，适用于测试及排查
+type MemoryRecorder struct {
+	mu       sync.Mutex
+	attempts []Attempt
+}
+
+// NewMemoryRecorder 初始化MemoryRecorder
+func NewMemoryRecorder() *MemoryRecorder {
+	return &MemoryRecorder{}
+}
+
+func (r *MemoryRecorder) Record(ctx context.Context, a Attempt) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts = append(r.attempts, a)
+	return nil
+}
+
+// Attempts 按发生顺序返回消息的投递尝试，id为空时返回全部
+func (r *MemoryRecorder) Attempts(id string) []Attempt {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ret []Attempt
+	for _, a := range r.attempts {
+		if id == "" || a.Id == id {
+			ret = append(ret, a)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,60 @@
+package forwarder
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 转发请求的头部
+const (
+	HeaderEvent     = "X-TTPay-Event"     // 回调类型，如trade.notify
+	HeaderDelivery  = "X-TTPay-Delivery"  // 消息Id，重试时不变，可用于去重
+	HeaderTimestamp = "X-TTPay-Timestamp" // 签名时的Unix秒
+	HeaderSignature = "X-TTPay-Signature" // sha256=HMAC-SHA256(key, timestamp + "." + body)的hex
+)
+
+const signaturePrefix = "sha256="
+
+var (
+	ErrInvalidSignature = errors.New("forwarder: invalid signature")
+	ErrExpiredSignature = errors.New("forwarder: signature expired")
+)
+
+// Sign 计算转发请求的签名
+func Sign(key []byte, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyRequest 供内部服务校验转发请求，返回请求体
+// maxAge>0时拒绝签名时间与now相差超过maxAge的请求，防止重放
+func VerifyRequest(r *http.Request, key []byte, now time.Time, maxAge time.Duration) ([]byte, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	sig := r.Header.Get(HeaderSignature)
+	if !strings.HasPrefix(sig, signaturePrefix) || !hmac.Equal([]byte(sig), []byte(Sign(key, ts, body))) {
+		return nil, ErrInvalidSignature
+	}
+	if maxAge > 0 {
+		if d := now.Sub(time.Unix(ts, 0)); d > maxAge || d < -maxAge {
+			return nil, ErrExpiredSignature
+		}
+	}
+	return body, nil
+}
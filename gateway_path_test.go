@@ -0,0 +1,71 @@
+package tt_pay
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/liaoxxxx/tt_pay/consts"
+	"github.com/liaoxxxx/tt_pay/util"
+)
+
+// gateway返回response信封，gateway-u返回data信封
+func newPathGateway(t *testing.T, fail bool) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("sign") == "" || r.FormValue("method") == "" {
+			t.Errorf("missing gateway params on %s", r.URL.Path)
+		}
+		switch r.URL.Path {
+		case "/" + consts.TPPath:
+			w.Write([]byte(`{"response":{"code":"10000","msg":"Success","out_order_no":"order_1","trade_no":"t_1"},"sign":"s"}`))
+		case "/" + consts.TPPathU:
+			if fail {
+				w.Write([]byte(`{"code":1001,"msg":"invalid request"}`))
+				return
+			}
+			w.Write([]byte(`{"code":0,"msg":"","data":{"out_order_no":"order_1","trade_no":"t_1"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestGatewayPaths(t *testing.T) {
+	for _, path := range []string{consts.TPPath, consts.TPPathU} {
+		t.Run(path, func(t *testing.T) {
+			ts := newPathGateway(t, false)
+			req := NewTradeQueryRequest(testConfig(ts.URL))
+			req.Uid = testUid
+			req.OutOrderNo = "order_1"
+			req.SetPath(path)
+			if req.GetUrl() != ts.URL+"/"+path {
+				t.Errorf("unexpected url %s", req.GetUrl())
+			}
+			resp, err := TradeQuery(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.TradeNo != "t_1" || resp.OutOrderNo != "order_1" {
+				t.Errorf("unexpected response %+v", resp)
+			}
+		})
+	}
+}
+
+func TestGatewayUError(t *testing.T) {
+	ts := newPathGateway(t, true)
+	req := NewRefundQueryRequest(testConfig(ts.URL))
+	req.Uid = testUid
+	req.OutRefundNo = "refund_1"
+	req.SetPath(consts.TPPathU)
+	_, err := RefundQuery(context.Background(), req)
+	var tpErr *util.Error
+	if !errors.As(err, &tpErr) || tpErr.Code != "1001" || tpErr.Msg != "invalid request" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
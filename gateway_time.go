@@ -0,0 +1,126 @@
+package tt_pay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// GatewayTimeLayout 为网关响应及回调中日期时间字符串的格式
+const GatewayTimeLayout = "2006-01-02 15:04:05"
+
+// 网关部分字段使用的紧凑格式，与13位毫秒时间戳同为纯数字，按位数区分
+const gatewayCompactTimeLayout = "20060102150405"
+
+// GatewayLocation 为网关时间所在时区，无时区信息的时间按该时区解析
+var GatewayLocation = loadGatewayLocation()
+
+// 系统缺少时区数据时使用固定的东八区，Asia/Shanghai自1991年起不再使用夏令时
+func loadGatewayLocation() *time.Location {
+	if loc, err := time.LoadLocation("Asia/Shanghai"); err == nil {
+		return loc
+	}
+	return time.FixedZone("Asia/Shanghai", 8*3600)
+}
+
+var digitsRegexp = regexp.MustCompile(`^[0-9]+$`)
+
+// GatewayTime 为网关返回的时间，兼容Unix时间戳（10位秒或13位毫秒，字符串或数字）、
+// 14位的yyyyMMddHHmmss、GatewayTimeLayout及RFC3339格式，空值解析为零值
+// 与回调解析一致，JSON中无法解析的时间按零值处理，不中断响应的解析
+type GatewayTime struct {
+	time.Time
+}
+
+// ParseGatewayTime 解析网关返回的时间字符串
+func ParseGatewayTime(s string) (GatewayTime, error) {
+	switch {
+	case s == "":
+		return GatewayTime{}, nil
+	case digitsRegexp.MatchString(s):
+		switch len(s) {
+		case 10:
+			n, _ := strconv.ParseInt(s, 10, 64)
+			return GatewayTime{time.Unix(n, 0).In(GatewayLocation)}, nil
+		case 13:
+			n, _ := strconv.ParseInt(s, 10, 64)
+			return GatewayTime{time.UnixMilli(n).In(GatewayLocation)}, nil
+		case 14:
+			if t, err := time.ParseInLocation(gatewayCompactTimeLayout, s, GatewayLocation); err == nil {
+				return GatewayTime{t}, nil
+			}
+		}
+		return GatewayTime{}, fmt.Errorf("tt_pay: invalid time %q", s)
+	}
+	if t, err := time.ParseInLocation(GatewayTimeLayout, s, GatewayLocation); err == nil {
+		return GatewayTime{t}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return GatewayTime{t.In(GatewayLocation)}, nil
+	}
+	return GatewayTime{}, fmt.Errorf("tt_pay: invalid time %q", s)
+}
+
+// String 按GatewayTimeLayout输出网关时区的时间，零值输出空串
+func (t GatewayTime) String() string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.In(GatewayLocation).Format(GatewayTimeLayout)
+}
+
+func (t GatewayTime) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+func (t *GatewayTime) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		*t = GatewayTime{}
+		return nil
+	}
+	// 无法解析时置为零值，与回调解析忽略错误的处理一致
+	*t, _ = ParseGatewayTime(string(bytes.Trim(b, `"`)))
+	return nil
+}
+
+// DurationSeconds 为以秒为单位的时长，兼容网关返回的字符串及数字
+type DurationSeconds struct {
+	time.Duration
+}
+
+func (d DurationSeconds) MarshalJSON() ([]byte, error) {
+	return json.Marshal(strconv.FormatInt(int64(d.Duration/time.Second), 10))
+}
+
+func (d *DurationSeconds) UnmarshalJSON(b []byte) error {
+	b = bytes.Trim(b, `"`)
+	if len(b) == 0 || string(b) == "null" {
+		d.Duration = 0
+		return nil
+	}
+	n, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return fmt.Errorf("tt_pay: invalid seconds %q", b)
+	}
+	d.Duration = time.Duration(n) * time.Second
+	return nil
+}
+
+// 编码为网关的Unix时间戳（秒），零值编码为空串
+func formatUnixTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+// 编码为网关的秒数，不足一秒的部分舍去，零值编码为空串
+func formatSeconds(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return strconv.FormatInt(int64(d/time.Second), 10)
+}
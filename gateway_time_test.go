@@ -0,0 +1,92 @@
+package tt_pay
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseGatewayTime(t *testing.T) {
+	want := time.Date(2019, 8, 5, 18, 13, 20, 0, GatewayLocation)
+	for _, s := range []string{"1565000000", "1565000000000", "20190805181320", "2019-08-05 18:13:20", "2019-08-05T10:13:20Z"} {
+		got, err := ParseGatewayTime(s)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("ParseGatewayTime(%q) = %v, %v; want %v", s, got, err, want)
+		}
+		if got.String() != "2019-08-05 18:13:20" {
+			t.Errorf("String() = %q", got.String())
+		}
+	}
+	if got, err := ParseGatewayTime(""); err != nil || !got.IsZero() {
+		t.Errorf("empty time = %v, %v", got, err)
+	}
+	for _, s := range []string{"yesterday", "15650000", "156500000000", "20191305181320", "1565000000000000"} {
+		if _, err := ParseGatewayTime(s); err == nil {
+			t.Errorf("expected error for invalid time %q", s)
+		}
+	}
+}
+
+func TestTradeQueryResponseTimes(t *testing.T) {
+	ts := newStubGateway(t, `{"response":{"code":"10000","msg":"Success","out_order_no":"order_1",`+
+		`"create_time":"2019-08-05 18:13:20","pay_time":1565000060,"trade_time":"soon","expire_time":""}}`)
+	req := NewTradeQueryRequest(testConfig(ts.URL))
+	req.Uid = testUid
+	req.OutOrderNo = "order_1"
+	resp, err := TradeQuery(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.CreateTime.Unix() != 1565000000 || resp.PayTime.Sub(resp.CreateTime.Time) != time.Minute || !resp.ExpireTime.IsZero() || !resp.TradeTime.IsZero() {
+		t.Fatalf("unexpected times %v %v %v %v", resp.CreateTime, resp.PayTime, resp.ExpireTime, resp.TradeTime)
+	}
+	b, _ := json.Marshal(resp.PayTime)
+	if string(b) != `"2019-08-05 18:14:20"` {
+		t.Errorf("unexpected json %s", b)
+	}
+}
+
+func TestClockReproducibleRequest(t *testing.T) {
+	SetClock(&fakeClock{t: time.Unix(1565000000, 0)})
+	defer SetClock(nil)
+
+	encode := func() string {
+		req := validTradeCreateRequest()
+		req.TradeTime = Now()
+		req.ValidTime = 90 * time.Second
+		body, err := req.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return body
+	}
+	first := encode()
+	if second := encode(); first != second {
+		t.Fatalf("request not reproducible:\n%s\n%s", first, second)
+	}
+	req := validTradeCreateRequest()
+	if req.Timestamp != "1565000000" {
+		t.Errorf("unexpected timestamp %s", req.Timestamp)
+	}
+	req.TradeTime = Now()
+	req.ValidTime = 90 * time.Second
+	if _, err := req.Encode(); err != nil {
+		t.Fatal(err)
+	}
+	if got := req.bizContent.Get("trade_time").MustString(); got != "1565000000" {
+		t.Errorf("trade_time = %q", got)
+	}
+	if got := req.bizContent.Get("valid_time").MustString(); got != "90" {
+		t.Errorf("valid_time = %q", got)
+	}
+
+	params, err := NewTradeCreateResponse(req).getAppletParams2_0()
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := NewTradeCreateResponse(req).getAppletParams2_0()
+	if params != again {
+		t.Errorf("applet params not reproducible:\n%s\n%s", params, again)
+	}
+}
@@ -0,0 +1,4 @@
+package tt_pay
+
+// Request/Response的样板代码由schema目录下的接口描述生成，修改schema后重新执行go generate
+//go:generate go run ./cmd/ttpaygen -schema schema -out .
@@ -0,0 +1,130 @@
+package idempotency
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// FileStore 以追加写的JSON行文件保存记录，每次写入后fsync，适用于单进程的批量任务断点续跑
+// 打开时加载已有记录，上次进程未完成的处理中记录视为结果未知，重试前会先查询
+type FileStore struct {
+	mu      sync.Mutex
+	f       *os.File
+	records map[Key]Record
+}
+
+// 文件中的一行
+type fileLine struct {
+	Method     string          `json:"method"`
+	MerchantId string          `json:"merchant_id"`
+	OutNo      string          `json:"out_no"`
+	State      State           `json:"state"`
+	Response   json.RawMessage `json:"response,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Version    int64           `json:"version"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+}
+
+// OpenFileStore 打开或创建path处的记录文件
+// 进程崩溃可能留下不完整的最后一行，加载时忽略；其余行格式错误时返回错误
+func OpenFileStore(path string) (*FileStore, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("idempotency: %w", err)
+	}
+	s := &FileStore{f: f, records: make(map[Key]Record)}
+	if err := s.load(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("idempotency: load %s: %w", path, err)
+	}
+	return s, nil
+}
+
+func (s *FileStore) load() error {
+	scanner := bufio.NewScanner(s.f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var (
+		bad    error
+		offset int64 // 已加载的完整行的长度
+	)
+	for n := 1; scanner.Scan(); n++ {
+		if bad != nil {
+			return bad
+		}
+		var line fileLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			bad = fmt.Errorf("line %d: %w", n, err)
+			continue
+		}
+		offset += int64(len(scanner.Bytes())) + 1
+		rec := Record{
+			State:     line.State,
+			Response:  line.Response,
+			Error:     line.Error,
+			Version:   line.Version,
+			UpdatedAt: line.UpdatedAt,
+		}
+		if rec.State == StateInFlight {
+			rec.State = StateUnknown
+		}
+		s.records[Key{Method: line.Method, MerchantId: line.MerchantId, OutNo: line.OutNo}] = rec
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if bad != nil {
+		// 截掉不完整的最后一行，以免与后续写入连在一起
+		return s.f.Truncate(offset)
+	}
+	return nil
+}
+
+func (s *FileStore) Get(ctx context.Context, key Key) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.records[key]
+	if !ok {
+		return nil, nil
+	}
+	return &rec, nil
+}
+
+func (s *FileStore) CompareAndSwap(ctx context.Context, key Key, version int64, rec *Record) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.records[key].Version != version {
+		return false, nil
+	}
+	b, err := json.Marshal(fileLine{
+		Method:     key.Method,
+		MerchantId: key.MerchantId,
+		OutNo:      key.OutNo,
+		State:      rec.State,
+		Response:   rec.Response,
+		Error:      rec.Error,
+		Version:    version + 1,
+		UpdatedAt:  rec.UpdatedAt,
+	})
+	if err != nil {
+		return false, fmt.Errorf("idempotency: %w", err)
+	}
+	if _, err := s.f.Write(append(b, '\n')); err != nil {
+		return false, fmt.Errorf("idempotency: %w", err)
+	}
+	if err := s.f.Sync(); err != nil {
+		return false, fmt.Errorf("idempotency: %w", err)
+	}
+	rec.Version = version + 1
+	s.records[key] = *rec
+	return true, nil
+}
+
+// Close 关闭记录文件
+func (s *FileStore) Close() error {
+	return s.f.Close()
+}
@@ -0,0 +1,75 @@
+package idempotency
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileStoreReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "checkpoint.jsonl")
+	s, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := Key{Method: "m", MerchantId: "merchant_1", OutNo: "w_1"}
+	pending := Key{Method: "m", MerchantId: "merchant_1", OutNo: "w_2"}
+	mustSwap(t, s, done, 0, &Record{State: StateInFlight})
+	mustSwap(t, s, done, 1, &Record{State: StateSucceeded, Response: []byte(`{"withdraw_trade_no":"wt_1"}`)})
+	mustSwap(t, s, pending, 0, &Record{State: StateInFlight})
+	if ok, _ := s.CompareAndSwap(ctx, pending, 0, &Record{State: StateInFlight}); ok {
+		t.Fatal("expected version conflict")
+	}
+	s.Close()
+
+	// 模拟写入一半时进程退出
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"method":"m","out_no":"w_3","sta`)
+	f.Close()
+
+	s, err = OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	rec, _ := s.Get(ctx, done)
+	if rec == nil || rec.State != StateSucceeded || rec.Version != 2 || string(rec.Response) != `{"withdraw_trade_no":"wt_1"}` {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+	// 未完成的处理中记录视为结果未知
+	if rec, _ := s.Get(ctx, pending); rec == nil || rec.State != StateUnknown || rec.Version != 1 {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+	mustSwap(t, s, pending, 1, &Record{State: StateFailed, Error: "rejected"})
+	s.Close()
+
+	s, err = OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if rec, _ := s.Get(ctx, pending); rec == nil || rec.State != StateFailed || rec.Version != 2 {
+		t.Fatalf("unexpected record after truncated line %+v", rec)
+	}
+}
+
+func TestFileStoreCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.jsonl")
+	os.WriteFile(path, []byte("not json\n{\"method\":\"m\",\"version\":1}\n"), 0600)
+	if _, err := OpenFileStore(path); err == nil {
+		t.Fatal("expected error for corrupt line")
+	}
+}
+
+func mustSwap(t *testing.T, s Store, key Key, version int64, rec *Record) {
+	t.Helper()
+	ok, err := s.CompareAndSwap(context.Background(), key, version, rec)
+	if err != nil || !ok {
+		t.Fatalf("CompareAndSwap(%v, %d) = %v, %v", key, version, ok, err)
+	}
+}
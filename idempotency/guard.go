@@ -0,0 +1,261 @@
+// Package idempotency 为退款、提现等创建类接口提供客户端幂等
+//
+// 以(method, merchant_id, out_refund_no/out_trade_no)为key记录请求状态：
+// 已成功的请求直接返回之前的响应；处理中的请求返回ErrInFlight；
+// 结果未知（网络超时、5xx、可重试的系统错误）的请求在重试前先调用对应的查询接口确认是否已受理，
+// 确认未受理才会重新发起创建，避免重复退款/提现。
+//
+// 确认依赖查询接口返回的“单号不存在”被识别为util.ErrOrderNotExist，创建接口返回的重复单号被识别为
+// util.ErrDuplicateOrder，对应的sub_code以财经侧接口文档为准，需先通过util.RegisterSubCode收录，
+// 未收录时NewGuard返回util.ErrSubCodeNotRegistered。
+//
+// 预下单（TradeCreate）不与财经后端通信，无需幂等。
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bitly/go-simplejson"
+
+	"github.com/liaoxxxx/tt_pay"
+	"github.com/liaoxxxx/tt_pay/consts"
+	"github.com/liaoxxxx/tt_pay/util"
+)
+
+// DefaultInFlightTimeout 处理中的记录超过该时间未更新，视为结果未知
+const DefaultInFlightTimeout = 2 * time.Minute
+
+var (
+	// ErrInFlight 相同key的请求正在处理中
+	ErrInFlight = errors.New("idempotency: request is in flight")
+	// ErrAmbiguous 请求结果未知，可稍后使用相同单号重试
+	ErrAmbiguous = errors.New("idempotency: outcome is unknown")
+)
+
+// AmbiguousError 请求结果未知，errors.Is可匹配ErrAmbiguous及原始错误
+type AmbiguousError struct {
+	cause error
+}
+
+func (e *AmbiguousError) Error() string {
+	return "idempotency: outcome is unknown: " + e.cause.Error()
+}
+
+func (e *AmbiguousError) Unwrap() error { return e.cause }
+
+func (e *AmbiguousError) Is(target error) bool { return target == ErrAmbiguous }
+
+// Guard 包装创建类接口，保证相同单号至多被受理一次
+type Guard struct {
+	store           Store
+	inFlightTimeout time.Duration
+	now             func() time.Time
+}
+
+// NewGuard 初始化Guard，订单不存在及重复下单的sub_code未收录时返回util.ErrSubCodeNotRegistered
+func NewGuard(store Store) (*Guard, error) {
+	if err := util.RequireCategories(util.CategoryOrderNotExist, util.CategoryDuplicateOrder); err != nil {
+		return nil, fmt.Errorf("idempotency: %w", err)
+	}
+	return &Guard{
+		store:           store,
+		inFlightTimeout: DefaultInFlightTimeout,
+		now:             time.Now,
+	}, nil
+}
+
+// SetInFlightTimeout 设置处理中记录的超时时间，应大于请求超时时间
+func (g *Guard) SetInFlightTimeout(d time.Duration) {
+	g.inFlightTimeout = d
+}
+
+// RefundCreate 幂等的退款申请，key为out_refund_no
+func (g *Guard) RefundCreate(ctx context.Context, req *tt_pay.RefundCreateRequest) (*tt_pay.RefundCreateResponse, error) {
+	if req.OutRefundNo == "" {
+		return tt_pay.RefundCreate(ctx, req)
+	}
+	data, err := g.do(ctx, operation{
+		key: Key{Method: consts.MethodRefundCreate, MerchantId: req.MerchantId, OutNo: req.OutRefundNo},
+		create: func(ctx context.Context) (*simplejson.Json, error) {
+			resp, err := tt_pay.RefundCreate(ctx, req)
+			if err != nil {
+				return nil, err
+			}
+			return resp.Data, nil
+		},
+		resolve: func(ctx context.Context) (*simplejson.Json, error) {
+			queryReq := tt_pay.NewRefundQueryRequest(req.Config)
+			queryReq.Uid = req.Uid
+			queryReq.OutRefundNo = req.OutRefundNo
+			resp, err := tt_pay.RefundQuery(ctx, queryReq)
+			if err != nil {
+				return nil, err
+			}
+			return resp.Data, nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp := tt_pay.NewRefundCreateResponse()
+	if err := decode(resp, data); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// WithdrawCreate 幂等的提现下单，key为out_trade_no
+// 登录态不与财经后端通信，未指定out_trade_no时无法保证幂等，这两种情况直接调用tt_pay.WithdrawCreate
+func (g *Guard) WithdrawCreate(ctx context.Context, req *tt_pay.WithdrawCreateRequest) (*tt_pay.WithdrawCreateResponse, error) {
+	if req.WithLogin || req.OutTradeNo == "" {
+		return tt_pay.WithdrawCreate(ctx, req)
+	}
+	data, err := g.do(ctx, operation{
+		key: Key{Method: consts.MethodWithdrawCreate, MerchantId: req.MerchantId, OutNo: req.OutTradeNo},
+		create: func(ctx context.Context) (*simplejson.Json, error) {
+			resp, err := tt_pay.WithdrawCreate(ctx, req)
+			if err != nil {
+				return nil, err
+			}
+			return resp.Data, nil
+		},
+		resolve: func(ctx context.Context) (*simplejson.Json, error) {
+			queryReq := tt_pay.NewWithdrawQueryRequest(req.Config)
+			queryReq.OutTradeNo = req.OutTradeNo
+			resp, err := tt_pay.WithdrawQuery(ctx, queryReq)
+			if err != nil {
+				return nil, err
+			}
+			return resp.Data, nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp := tt_pay.NewWithdrawCreateResponse(req)
+	if err := decode(resp, data); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// 一种创建请求
+// create 发起创建，返回原始响应
+// resolve 查询创建结果，未受理时返回util.ErrOrderNotExist，查询响应需包含创建响应中的字段
+type operation struct {
+	key     Key
+	create  func(ctx context.Context) (*simplejson.Json, error)
+	resolve func(ctx context.Context) (*simplejson.Json, error)
+}
+
+func (g *Guard) do(ctx context.Context, op operation) ([]byte, error) {
+	for {
+		rec, err := g.store.Get(ctx, op.key)
+		if err != nil {
+			return nil, util.Wrap(err, "idempotency failed when [Store.Get()]")
+		}
+		var version int64
+		mustResolve := false
+		if rec != nil {
+			version = rec.Version
+			switch rec.State {
+			case StateSucceeded:
+				return rec.Response, nil
+			case StateInFlight:
+				if g.now().Sub(rec.UpdatedAt) < g.inFlightTimeout {
+					return nil, ErrInFlight
+				}
+				// 处理中的请求超时未完成，可能是进程退出，结果未知
+				mustResolve = true
+			case StateUnknown:
+				mustResolve = true
+			}
+		}
+		ok, err := g.store.CompareAndSwap(ctx, op.key, version, &Record{State: StateInFlight, UpdatedAt: g.now()})
+		if err != nil {
+			return nil, util.Wrap(err, "idempotency failed when [Store.CompareAndSwap()]")
+		}
+		if !ok {
+			// 其他调用方抢先更新了记录，重新读取
+			continue
+		}
+		return g.run(ctx, op, version+1, mustResolve)
+	}
+}
+
+func (g *Guard) run(ctx context.Context, op operation, version int64, mustResolve bool) ([]byte, error) {
+	if mustResolve {
+		data, err := op.resolve(ctx)
+		if err == nil {
+			return g.succeed(ctx, op.key, version, data)
+		}
+		if !errors.Is(err, util.ErrOrderNotExist) {
+			return nil, g.unknown(ctx, op.key, version, err)
+		}
+		// 确认未受理，可以重新创建
+	}
+
+	data, err := op.create(ctx)
+	switch {
+	case err == nil:
+		return g.succeed(ctx, op.key, version, data)
+	case errors.Is(err, util.ErrDuplicateOrder):
+		// 之前的请求已被受理，以查询结果为准
+		data, err = op.resolve(ctx)
+		if err != nil {
+			return nil, g.unknown(ctx, op.key, version, err)
+		}
+		return g.succeed(ctx, op.key, version, data)
+	case errors.Is(err, util.ErrPermanent):
+		// 财经侧明确拒绝或参数未通过查验，未受理
+		g.finish(ctx, op.key, version, &Record{State: StateFailed, Error: err.Error()})
+		return nil, err
+	case errors.Is(err, util.ErrNotSent):
+		// 请求发出前失败（如限流等待被取消、熔断），未受理
+		// 请求发出后即使调用方ctx已结束也不能据此判断，仍按结果未知处理
+		g.finish(ctx, op.key, version, &Record{State: StateFailed, Error: err.Error()})
+		return nil, err
+	default:
+		// 网络错误、可重试的系统错误（如TP.SYSTEM_ERROR）等，无法确定是否已受理
+		return nil, g.unknown(ctx, op.key, version, err)
+	}
+}
+
+func (g *Guard) succeed(ctx context.Context, key Key, version int64, data *simplejson.Json) ([]byte, error) {
+	b, err := data.Encode()
+	if err != nil {
+		return nil, g.unknown(ctx, key, version, err)
+	}
+	g.finish(ctx, key, version, &Record{State: StateSucceeded, Response: b})
+	return b, nil
+}
+
+func (g *Guard) unknown(ctx context.Context, key Key, version int64, err error) error {
+	g.finish(ctx, key, version, &Record{State: StateUnknown, Error: err.Error()})
+	return &AmbiguousError{cause: err}
+}
+
+// 写入最终状态，写入失败时记录保持处理中，超时后会按结果未知处理
+func (g *Guard) finish(ctx context.Context, key Key, version int64, rec *Record) {
+	rec.UpdatedAt = g.now()
+	if _, err := g.store.CompareAndSwap(ctx, key, version, rec); err != nil {
+		util.Debug("idempotency: save %s [%s] failed: %v\n", key.Method, key.OutNo, err)
+	}
+}
+
+type decoder interface {
+	SetData(data *simplejson.Json)
+	Decode() error
+}
+
+func decode(resp decoder, data []byte) error {
+	j, err := simplejson.NewJson(data)
+	if err != nil {
+		return fmt.Errorf("idempotency: decode saved response: %w", err)
+	}
+	resp.SetData(j)
+	return resp.Decode()
+}
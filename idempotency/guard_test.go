@@ -0,0 +1,277 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/liaoxxxx/tt_pay"
+	"github.com/liaoxxxx/tt_pay/config"
+	"github.com/liaoxxxx/tt_pay/consts"
+	"github.com/liaoxxxx/tt_pay/util"
+)
+
+const (
+	refundSuccess = `{"response":{"code":"10000","msg":"Success","out_order_no":"order_1",` +
+		`"out_refund_no":"refund_1","refund_no":"r_100","refund_amount":"50"},"sign":"s"}`
+	refundNotExist = `{"response":{"code":"40004","msg":"Business Failed","sub_code":"TP.REFUND_NOT_EXIST"}}`
+	systemError    = `{"response":{"code":"20000","msg":"Service Currently Unavailable","sub_code":"TP.SYSTEM_ERROR"}}`
+	invalidParam   = `{"response":{"code":"40002","msg":"Invalid Arguments"}}`
+)
+
+// 本地网关桩，按method依次返回预设响应，body为空时返回502
+type stubGateway struct {
+	responses map[string][]string
+	calls     map[string]int
+}
+
+func newStubGateway(t *testing.T, responses map[string][]string) (*stubGateway, string) {
+	t.Helper()
+	g := &stubGateway{responses: responses, calls: make(map[string]int)}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method := r.FormValue("method")
+		n := g.calls[method]
+		g.calls[method]++
+		list := g.responses[method]
+		if n >= len(list) {
+			t.Errorf("unexpected call %d to %s", n+1, method)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if list[n] == "" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(list[n]))
+	}))
+	t.Cleanup(ts.Close)
+	return g, ts.URL
+}
+
+func testRefundRequest(domain string) *tt_pay.RefundCreateRequest {
+	req := tt_pay.NewRefundCreateRequest(config.Config{
+		AppId:             "app_1",
+		AppSecret:         "secret",
+		MerchantId:        "merchant_1",
+		TPDomain:          domain,
+		TPClientTimeoutMs: 3000,
+	})
+	req.Uid = "uid_1"
+	req.OutOrderNo = "order_1"
+	req.OutRefundNo = "refund_1"
+	req.RefundAmount = 50
+	req.NotifyUrl = "https://example.com/notify"
+	req.RiskInfo = `{"ip":"10.20.30.40"}`
+	return req
+}
+
+func TestGuardCachesSuccess(t *testing.T) {
+	gw, url := newStubGateway(t, map[string][]string{consts.MethodRefundCreate: {refundSuccess}})
+	g := newTestGuard(t, NewMemoryStore())
+	for i := 0; i < 2; i++ {
+		resp, err := g.RefundCreate(context.Background(), testRefundRequest(url))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.RefundNo != "r_100" {
+			t.Errorf("unexpected refund_no %s", resp.RefundNo)
+		}
+	}
+	if gw.calls[consts.MethodRefundCreate] != 1 {
+		t.Errorf("create called %d times", gw.calls[consts.MethodRefundCreate])
+	}
+}
+
+func TestGuardResolvesAmbiguousCreate(t *testing.T) {
+	registerTestSubCodes(t)
+	tests := []struct {
+		name    string
+		query   string
+		creates int
+	}{
+		// 上次请求已受理，以查询结果为准，不再重复创建
+		{name: "accepted", query: refundSuccess, creates: 1},
+		// 上次请求未受理，重新创建
+		{name: "not exist", query: refundNotExist, creates: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw, url := newStubGateway(t, map[string][]string{
+				consts.MethodRefundCreate: {"", refundSuccess},
+				consts.MethodRefundQuery:  {tt.query},
+			})
+			s := NewMemoryStore()
+			g := newTestGuard(t, s)
+
+			_, err := g.RefundCreate(context.Background(), testRefundRequest(url))
+			if !errors.Is(err, ErrAmbiguous) || !errors.Is(err, util.ErrNetwork) {
+				t.Fatalf("expected ambiguous network error, got %v", err)
+			}
+			key := Key{Method: consts.MethodRefundCreate, MerchantId: "merchant_1", OutNo: "refund_1"}
+			if rec, _ := s.Get(context.Background(), key); rec.State != StateUnknown {
+				t.Fatalf("unexpected state %s", rec.State)
+			}
+
+			resp, err := g.RefundCreate(context.Background(), testRefundRequest(url))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.RefundNo != "r_100" {
+				t.Errorf("unexpected refund_no %s", resp.RefundNo)
+			}
+			if gw.calls[consts.MethodRefundCreate] != tt.creates || gw.calls[consts.MethodRefundQuery] != 1 {
+				t.Errorf("unexpected calls %v", gw.calls)
+			}
+			if rec, _ := s.Get(context.Background(), key); rec.State != StateSucceeded {
+				t.Errorf("unexpected state %s", rec.State)
+			}
+		})
+	}
+}
+
+// 系统错误可能已受理，重试前先查询；明确拒绝的请求直接重新创建
+func TestGuardFailureStates(t *testing.T) {
+	gw, url := newStubGateway(t, map[string][]string{
+		consts.MethodRefundCreate: {systemError, invalidParam, refundSuccess},
+		consts.MethodRefundQuery:  {invalidParam},
+	})
+	s := NewMemoryStore()
+	g := newTestGuard(t, s)
+	key := Key{Method: consts.MethodRefundCreate, MerchantId: "merchant_1", OutNo: "refund_1"}
+
+	if _, err := g.RefundCreate(context.Background(), testRefundRequest(url)); !errors.Is(err, ErrAmbiguous) || !errors.Is(err, util.ErrRetryable) {
+		t.Fatalf("expected ambiguous retryable error, got %v", err)
+	}
+	if rec, _ := s.Get(context.Background(), key); rec.State != StateUnknown {
+		t.Fatalf("unexpected state %s", rec.State)
+	}
+	// 查询失败时仍为结果未知，不重新创建
+	if _, err := g.RefundCreate(context.Background(), testRefundRequest(url)); !errors.Is(err, ErrAmbiguous) {
+		t.Fatalf("expected ambiguous error, got %v", err)
+	}
+	if gw.calls[consts.MethodRefundCreate] != 1 {
+		t.Fatalf("created again without resolving: %v", gw.calls)
+	}
+
+	s = NewMemoryStore()
+	g = newTestGuard(t, s)
+	if _, err := g.RefundCreate(context.Background(), testRefundRequest(url)); !errors.Is(err, util.ErrInvalidParam) || errors.Is(err, ErrAmbiguous) {
+		t.Fatalf("expected invalid param error, got %v", err)
+	}
+	if rec, _ := s.Get(context.Background(), key); rec.State != StateFailed {
+		t.Fatalf("unexpected state %s", rec.State)
+	}
+	if _, err := g.RefundCreate(context.Background(), testRefundRequest(url)); err != nil {
+		t.Fatal(err)
+	}
+	if gw.calls[consts.MethodRefundCreate] != 3 || gw.calls[consts.MethodRefundQuery] != 1 {
+		t.Errorf("unexpected calls %v", gw.calls)
+	}
+}
+
+func TestGuardCallerDeadline(t *testing.T) {
+	// 请求已发出，SDK超时与调用方ctx同时结束，结果未知
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte(refundSuccess))
+	}))
+	defer ts.Close()
+	s := NewMemoryStore()
+	g := newTestGuard(t, s)
+	key := Key{Method: consts.MethodRefundCreate, MerchantId: "merchant_1", OutNo: "refund_1"}
+	req := testRefundRequest(ts.URL)
+	req.TPClientTimeoutMs = 50
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := g.RefundCreate(ctx, req); !errors.Is(err, ErrAmbiguous) {
+		t.Fatalf("expected ambiguous error, got %v", err)
+	}
+	if ctx.Err() == nil {
+		t.Fatal("caller deadline should have passed")
+	}
+	if rec, _ := s.Get(context.Background(), key); rec.State != StateUnknown {
+		t.Fatalf("unexpected state %s", rec.State)
+	}
+
+	// 限流等待被取消时请求未发出，记为失败
+	tt_pay.SetRateLimit("merchant_1", consts.MethodRefundCreate, tt_pay.RateLimit{QPS: 0.001, Burst: 1})
+	defer tt_pay.SetRateLimit("merchant_1", consts.MethodRefundCreate, tt_pay.RateLimit{})
+	gw, url := newStubGateway(t, map[string][]string{consts.MethodRefundCreate: {refundSuccess}})
+	s = NewMemoryStore()
+	g = newTestGuard(t, s)
+	if _, err := g.RefundCreate(context.Background(), testRefundRequest(url)); err != nil {
+		t.Fatal(err)
+	}
+	key.OutNo = "refund_2"
+	req = testRefundRequest(url)
+	req.OutRefundNo = "refund_2"
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := g.RefundCreate(ctx, req); !errors.Is(err, util.ErrNotSent) || errors.Is(err, ErrAmbiguous) {
+		t.Fatalf("expected not sent error, got %v", err)
+	}
+	if rec, _ := s.Get(context.Background(), key); rec.State != StateFailed || gw.calls[consts.MethodRefundCreate] != 1 {
+		t.Fatalf("unexpected state %s, calls %v", rec.State, gw.calls)
+	}
+}
+
+func TestGuardInFlight(t *testing.T) {
+	gw, url := newStubGateway(t, map[string][]string{
+		consts.MethodRefundQuery: {refundSuccess},
+	})
+	s := NewMemoryStore()
+	key := Key{Method: consts.MethodRefundCreate, MerchantId: "merchant_1", OutNo: "refund_1"}
+	s.CompareAndSwap(context.Background(), key, 0, &Record{State: StateInFlight, UpdatedAt: time.Now()})
+	g := newTestGuard(t, s)
+
+	if _, err := g.RefundCreate(context.Background(), testRefundRequest(url)); !errors.Is(err, ErrInFlight) {
+		t.Fatalf("expected ErrInFlight, got %v", err)
+	}
+
+	// 超时后按结果未知处理，先查询
+	g.now = func() time.Time { return time.Now().Add(DefaultInFlightTimeout) }
+	if _, err := g.RefundCreate(context.Background(), testRefundRequest(url)); err != nil {
+		t.Fatal(err)
+	}
+	if gw.calls[consts.MethodRefundCreate] != 0 || gw.calls[consts.MethodRefundQuery] != 1 {
+		t.Errorf("unexpected calls %v", gw.calls)
+	}
+}
+
+// 收录测试sub_code后创建Guard
+func newTestGuard(t *testing.T, s Store) *Guard {
+	t.Helper()
+	registerTestSubCodes(t)
+	g, err := NewGuard(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+// 测试桩使用的sub_code，实际值以财经侧接口文档为准，由接入方通过util.RegisterSubCode收录
+func registerTestSubCodes(t *testing.T) {
+	t.Helper()
+	codes := map[string]util.Category{
+		"TP.REFUND_NOT_EXIST": util.CategoryOrderNotExist,
+		"TP.ORDER_EXISTS":     util.CategoryDuplicateOrder,
+	}
+	for code, c := range codes {
+		util.RegisterSubCode(code, c)
+	}
+	t.Cleanup(func() {
+		for code := range codes {
+			util.UnregisterSubCode(code)
+		}
+	})
+}
+
+func TestNewGuardRequiresSubCodes(t *testing.T) {
+	// 默认码表未收录订单不存在及重复下单的sub_code
+	if _, err := NewGuard(NewMemoryStore()); !errors.Is(err, util.ErrSubCodeNotRegistered) {
+		t.Fatalf("expected ErrSubCodeNotRegistered, got %v", err)
+	}
+}
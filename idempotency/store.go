@@ -0,0 +1,74 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// State 为一次创建请求的状态
+type State string
+
+const (
+	StateInFlight  State = "in_flight" // 请求处理中
+	StateSucceeded State = "succeeded" // 已确认创建成功，Response为响应
+	StateFailed    State = "failed"    // 已确认创建失败，可以重试
+	StateUnknown   State = "unknown"   // 结果未知（如网络超时），重试前需先查询
+)
+
+// Key 唯一确定一次创建请求
+type Key struct {
+	Method     string
+	MerchantId string
+	OutNo      string // out_refund_no或out_trade_no
+}
+
+// Record 为Key对应的请求记录
+type Record struct {
+	State     State
+	Response  []byte // 成功时的原始响应json
+	Error     string // 失败或结果未知时的错误信息
+	Version   int64  // 每次更新加1，用于CompareAndSwap
+	UpdatedAt time.Time
+}
+
+// Store 为请求记录的存储接口，实现需保证并发安全
+type Store interface {
+	// Get 查询记录，不存在时返回nil, nil
+	Get(ctx context.Context, key Key) (*Record, error)
+	// CompareAndSwap 当前记录的Version等于version时（0表示记录不存在）写入rec，
+	// 写入时rec.Version置为version+1；版本不一致时返回false
+	CompareAndSwap(ctx context.Context, key Key, version int64, rec *Record) (bool, error)
+}
+
+// MemoryStore 为内存实现，适用于测试及单机场景
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[Key]Record
+}
+
+// NewMemoryStore 初始化MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[Key]Record)}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key Key) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.records[key]
+	if !ok {
+		return nil, nil
+	}
+	return &rec, nil
+}
+
+func (s *MemoryStore) CompareAndSwap(ctx context.Context, key Key, version int64, rec *Record) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.records[key].Version != version {
+		return false, nil
+	}
+	rec.Version = version + 1
+	s.records[key] = *rec
+	return true, nil
+}
@@ -0,0 +1,282 @@
+package tt_pay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/liaoxxxx/tt_pay/config"
+	"github.com/liaoxxxx/tt_pay/util"
+)
+
+// ErrUnknownMerchant 商户未在MerchantRegistry中注册
+var ErrUnknownMerchant = errors.New("tt_pay: unknown merchant")
+
+// Merchant 为MerchantRegistry中的一个商户
+type Merchant struct {
+	Config    config.Config
+	PublicKey string         // 回调验签公钥，为空时使用Config.RSAPublicKey，均为空时使用consts.TtPayPublicKey
+	Handlers  NotifyHandlers // 该商户的回调处理函数，未设置的类型使用注册表的默认处理函数
+}
+
+// NotifyHandlers 各类回调的处理函数，m为回调所属的商户
+type NotifyHandlers struct {
+	Trade    func(ctx context.Context, m Merchant, resp *TradeNotifyResponse) error
+	Refund   func(ctx context.Context, m Merchant, resp *RefundNotifyResponse) error
+	Withdraw func(ctx context.Context, m Merchant, resp *WithdrawNotifyResponse) error
+}
+
+// 回调验签公钥，未设置PublicKey时使用配置中的公钥
+func (m Merchant) publicKey() string {
+	return firstNonEmpty(m.PublicKey, m.Config.RSAPublicKey)
+}
+
+// 以h中已设置的处理函数覆盖
+func (hs NotifyHandlers) merge(h NotifyHandlers) NotifyHandlers {
+	if h.Trade != nil {
+		hs.Trade = h.Trade
+	}
+	if h.Refund != nil {
+		hs.Refund = h.Refund
+	}
+	if h.Withdraw != nil {
+		hs.Withdraw = h.Withdraw
+	}
+	return hs
+}
+
+// MerchantLoader 加载全部商户，用于热更新，如从config.FromFile读取各商户的配置文件
+type MerchantLoader func(ctx context.Context) ([]Merchant, error)
+
+// MerchantRegistry 管理多个商户的配置，发起请求时按商户号取配置，回调时按merchant_id或app_id选择验签公钥和处理函数
+// 商户可通过Store、Replace或Reload热更新，正在处理的请求不受影响
+type MerchantRegistry struct {
+	mu        sync.RWMutex
+	merchants map[string]Merchant
+	apps      map[string]string // AppId到商户号，多个商户使用同一AppId时为空
+	handlers  NotifyHandlers
+	loader    MerchantLoader
+}
+
+// NewMerchantRegistry 创建注册表，merchants的配置需通过Validate查验且商户号不能重复
+func NewMerchantRegistry(merchants ...Merchant) (*MerchantRegistry, error) {
+	r := new(MerchantRegistry)
+	if err := r.Replace(merchants); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SetNotifyHandlers 设置默认的回调处理函数
+func (r *MerchantRegistry) SetNotifyHandlers(h NotifyHandlers) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers = h
+}
+
+// SetLoader 设置Reload使用的加载函数
+func (r *MerchantRegistry) SetLoader(loader MerchantLoader) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.loader = loader
+}
+
+// Store 新增或更新商户，其余商户保持不变
+func (r *MerchantRegistry) Store(merchants ...Merchant) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	all := make(map[string]Merchant, len(r.merchants)+len(merchants))
+	for id, m := range r.merchants {
+		all[id] = m
+	}
+	seen := make(map[string]bool, len(merchants))
+	for _, m := range merchants {
+		if err := checkMerchant(m, seen); err != nil {
+			return err
+		}
+		all[m.Config.MerchantId] = m
+	}
+	r.set(all)
+	return nil
+}
+
+// Replace 以merchants替换全部商户，任一商户配置有误时不做修改
+func (r *MerchantRegistry) Replace(merchants []Merchant) error {
+	all := make(map[string]Merchant, len(merchants))
+	seen := make(map[string]bool, len(merchants))
+	for _, m := range merchants {
+		if err := checkMerchant(m, seen); err != nil {
+			return err
+		}
+		all[m.Config.MerchantId] = m
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.set(all)
+	return nil
+}
+
+// Remove 移除商户
+func (r *MerchantRegistry) Remove(merchantId string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	all := make(map[string]Merchant, len(r.merchants))
+	for id, m := range r.merchants {
+		if id != merchantId {
+			all[id] = m
+		}
+	}
+	r.set(all)
+}
+
+// Reload 调用SetLoader设置的加载函数替换全部商户，加载失败时保留原有商户
+func (r *MerchantRegistry) Reload(ctx context.Context) error {
+	r.mu.RLock()
+	loader := r.loader
+	r.mu.RUnlock()
+	if loader == nil {
+		return errors.New("tt_pay: merchant loader not set")
+	}
+	merchants, err := loader(ctx)
+	if err != nil {
+		return util.Wrap(err, "load merchants")
+	}
+	return r.Replace(merchants)
+}
+
+// Watch 每隔interval调用一次Reload，直到ctx结束，应在单独的goroutine中运行
+func (r *MerchantRegistry) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Reload(ctx); err != nil {
+				util.Debug("Reload merchants failed: err[%s]", err)
+			}
+		}
+	}
+}
+
+// Merchant 按商户号返回商户，未注册时返回ErrUnknownMerchant
+func (r *MerchantRegistry) Merchant(merchantId string) (Merchant, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	m, ok := r.merchants[merchantId]
+	if !ok {
+		return Merchant{}, fmt.Errorf("%w: merchant_id %s", ErrUnknownMerchant, merchantId)
+	}
+	return m, nil
+}
+
+// Config 按商户号返回发起请求使用的配置
+func (r *MerchantRegistry) Config(merchantId string) (config.Config, error) {
+	m, err := r.Merchant(merchantId)
+	return m.Config, err
+}
+
+// MerchantIds 返回已注册的商户号，按字典序排列
+func (r *MerchantRegistry) MerchantIds() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ids := make([]string, 0, len(r.merchants))
+	for id := range r.merchants {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// TradeNotify 使用回调所属商户的公钥验签，并交给该商户的处理函数
+// 验签通过但处理函数返回错误时，同时返回resp和错误
+func (r *MerchantRegistry) TradeNotify(ctx context.Context, param string) (*TradeNotifyResponse, error) {
+	m, h, err := r.resolveNotify(param)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := TradeNotify(ctx, &TradeNotifyRequest{Param: param, PublicKey: m.publicKey()})
+	if err != nil || h.Trade == nil {
+		return resp, err
+	}
+	return resp, util.Wrap(h.Trade(ctx, m, resp), "handle trade notify")
+}
+
+// RefundNotify 使用回调所属商户的公钥验签，并交给该商户的处理函数
+func (r *MerchantRegistry) RefundNotify(ctx context.Context, param string) (*RefundNotifyResponse, error) {
+	m, h, err := r.resolveNotify(param)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := RefundNotify(ctx, &RefundNotifyRequest{Param: param, PublicKey: m.publicKey()})
+	if err != nil || h.Refund == nil {
+		return resp, err
+	}
+	return resp, util.Wrap(h.Refund(ctx, m, resp), "handle refund notify")
+}
+
+// WithdrawNotify 使用回调所属商户的公钥验签，并交给该商户的处理函数
+func (r *MerchantRegistry) WithdrawNotify(ctx context.Context, param string) (*WithdrawNotifyResponse, error) {
+	m, h, err := r.resolveNotify(param)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := WithdrawNotify(ctx, &WithdrawNotifyRequest{Param: param, PublicKey: m.publicKey()})
+	if err != nil || h.Withdraw == nil {
+		return resp, err
+	}
+	return resp, util.Wrap(h.Withdraw(ctx, m, resp), "handle withdraw notify")
+}
+
+// 按回调参数中的merchant_id选择商户，没有merchant_id时按app_id选择
+func (r *MerchantRegistry) resolveNotify(param string) (Merchant, NotifyHandlers, error) {
+	params, err := url.ParseQuery(param)
+	if err != nil {
+		util.Debug("Parse params failed: err[%s]", err)
+		return Merchant{}, NotifyHandlers{}, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	merchantId := params.Get("merchant_id")
+	if merchantId == "" {
+		appId := params.Get("app_id")
+		if merchantId = r.apps[appId]; merchantId == "" {
+			return Merchant{}, NotifyHandlers{}, fmt.Errorf("%w: app_id %s", ErrUnknownMerchant, appId)
+		}
+	}
+	m, ok := r.merchants[merchantId]
+	if !ok {
+		return Merchant{}, NotifyHandlers{}, fmt.Errorf("%w: merchant_id %s", ErrUnknownMerchant, merchantId)
+	}
+	return m, r.handlers.merge(m.Handlers), nil
+}
+
+// 替换全部商户并重建AppId索引，调用方需持有写锁
+func (r *MerchantRegistry) set(merchants map[string]Merchant) {
+	apps := make(map[string]string, len(merchants))
+	for id, m := range merchants {
+		if _, ok := apps[m.Config.AppId]; ok {
+			apps[m.Config.AppId] = ""
+			continue
+		}
+		apps[m.Config.AppId] = id
+	}
+	r.merchants = merchants
+	r.apps = apps
+}
+
+func checkMerchant(m Merchant, seen map[string]bool) error {
+	if err := m.Config.Validate(); err != nil {
+		return util.Wrap(err, "merchant "+m.Config.MerchantId)
+	}
+	if seen[m.Config.MerchantId] {
+		return fmt.Errorf("tt_pay: duplicate merchant_id %s", m.Config.MerchantId)
+	}
+	seen[m.Config.MerchantId] = true
+	return nil
+}
@@ -0,0 +1,167 @@
+package tt_pay
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/liaoxxxx/tt_pay/config"
+	"github.com/liaoxxxx/tt_pay/util"
+)
+
+// 生成测试用的RSA密钥对，返回PEM格式的私钥和公钥
+func newTestKeyPair(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	private := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	public := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})
+	return string(private), string(public)
+}
+
+// 以privateKey签名回调参数
+func signNotify(t *testing.T, params map[string]string, privateKey string) string {
+	t.Helper()
+	signMap := make(map[string]interface{})
+	values := url.Values{}
+	for k, v := range params {
+		signMap[k] = v
+		values.Set(k, v)
+	}
+	sign, err := util.BuildMd5WithRsa(signMap, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values.Set("sign", sign)
+	return values.Encode()
+}
+
+func testMerchant(merchantId, appId, publicKey string) Merchant {
+	c := testConfig("http://127.0.0.1")
+	c.MerchantId = merchantId
+	c.AppId = appId
+	return Merchant{Config: c, PublicKey: publicKey}
+}
+
+func TestMerchantRegistryRoutesNotify(t *testing.T) {
+	private1, public1 := newTestKeyPair(t)
+	private2, public2 := newTestKeyPair(t)
+
+	var routed []string
+	// 未设置PublicKey时使用配置中的公钥
+	m2 := testMerchant("merchant_2", "app_2", "")
+	m2.Config.RSAPublicKey = public2
+	m2.Handlers.Trade = func(ctx context.Context, m Merchant, resp *TradeNotifyResponse) error {
+		routed = append(routed, "own:"+m.Config.MerchantId+":"+resp.OutOrderNo)
+		return nil
+	}
+	r, err := NewMerchantRegistry(testMerchant("merchant_1", "app_1", public1), m2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetNotifyHandlers(NotifyHandlers{
+		Trade: func(ctx context.Context, m Merchant, resp *TradeNotifyResponse) error {
+			routed = append(routed, "default:"+m.Config.MerchantId+":"+resp.OutOrderNo)
+			return nil
+		},
+	})
+
+	param := signNotify(t, map[string]string{"merchant_id": "merchant_1", "app_id": "app_1", "out_order_no": "order_1"}, private1)
+	if _, err := r.TradeNotify(context.Background(), param); err != nil {
+		t.Fatal(err)
+	}
+	// 没有merchant_id时按app_id选择
+	param = signNotify(t, map[string]string{"app_id": "app_2", "out_order_no": "order_2"}, private2)
+	if _, err := r.TradeNotify(context.Background(), param); err != nil {
+		t.Fatal(err)
+	}
+	if len(routed) != 2 || routed[0] != "default:merchant_1:order_1" || routed[1] != "own:merchant_2:order_2" {
+		t.Fatalf("unexpected routing %v", routed)
+	}
+
+	// 使用其他商户的密钥签名
+	param = signNotify(t, map[string]string{"merchant_id": "merchant_2", "out_order_no": "order_3"}, private1)
+	if _, err := r.TradeNotify(context.Background(), param); !errors.Is(err, util.ErrInvalidSign) {
+		t.Fatalf("expected invalid sign, got %v", err)
+	}
+	param = signNotify(t, map[string]string{"merchant_id": "merchant_3"}, private1)
+	if _, err := r.RefundNotify(context.Background(), param); !errors.Is(err, ErrUnknownMerchant) {
+		t.Fatalf("expected unknown merchant, got %v", err)
+	}
+	if len(routed) != 2 {
+		t.Fatalf("handler called for rejected notify: %v", routed)
+	}
+}
+
+func TestMerchantRegistryHandlerError(t *testing.T) {
+	private, public := newTestKeyPair(t)
+	m := testMerchant("merchant_1", "app_1", public)
+	m.Handlers.Withdraw = func(ctx context.Context, m Merchant, resp *WithdrawNotifyResponse) error {
+		return errors.New("db down")
+	}
+	r, err := NewMerchantRegistry(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	param := signNotify(t, map[string]string{"merchant_id": "merchant_1", "out_trade_no": "w_1"}, private)
+	resp, err := r.WithdrawNotify(context.Background(), param)
+	if err == nil || resp == nil || resp.OutTradeNo != "w_1" {
+		t.Fatalf("expected resp with handler error, got %v %v", resp, err)
+	}
+}
+
+func TestMerchantRegistryReload(t *testing.T) {
+	r, err := NewMerchantRegistry(testMerchant("merchant_1", "app_1", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Config("merchant_2"); !errors.Is(err, ErrUnknownMerchant) {
+		t.Fatalf("expected unknown merchant, got %v", err)
+	}
+
+	rotated := testMerchant("merchant_1", "app_1", "")
+	rotated.Config.AppSecret = "rotated-app-secret-0123456789"
+	loaded := []Merchant{rotated, testMerchant("merchant_2", "app_2", "")}
+	r.SetLoader(func(ctx context.Context) ([]Merchant, error) {
+		return loaded, nil
+	})
+	if err := r.Reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	c, err := r.Config("merchant_1")
+	if err != nil || c.AppSecret != rotated.Config.AppSecret {
+		t.Fatalf("expected rotated secret, got %v %v", c, err)
+	}
+
+	// 配置有误时保留原有商户
+	loaded = []Merchant{{Config: config.Config{MerchantId: "merchant_3"}}}
+	if err := r.Reload(context.Background()); err == nil {
+		t.Fatal("expected invalid config error")
+	}
+	loaded = []Merchant{testMerchant("merchant_1", "app_1", ""), testMerchant("merchant_1", "app_2", "")}
+	if err := r.Reload(context.Background()); err == nil {
+		t.Fatal("expected duplicate merchant error")
+	}
+	if ids := r.MerchantIds(); len(ids) != 2 || ids[0] != "merchant_1" || ids[1] != "merchant_2" {
+		t.Fatalf("unexpected merchants %v", ids)
+	}
+
+	if err := r.Store(testMerchant("merchant_3", "app_3", "")); err != nil {
+		t.Fatal(err)
+	}
+	r.Remove("merchant_1")
+	if ids := r.MerchantIds(); len(ids) != 2 || ids[0] != "merchant_2" || ids[1] != "merchant_3" {
+		t.Fatalf("unexpected merchants %v", ids)
+	}
+}
@@ -0,0 +1,50 @@
+package tt_pay
+
+import (
+	"time"
+)
+
+// MetricsHook 为网关调用及回调解析的监控接口
+// ObserveRequest 在每次Execute结束后调用，statusCode为0表示未收到HTTP响应
+// ObserveNotify 在每次回调解析结束后调用，err不为nil表示解析或验签失败
+// 实现需保证并发安全，且不应阻塞调用方
+//
+// 可选实现ObserveLimiterWait(merchantId, method string, wait time.Duration)，
+// 配置了SetRateLimit时，每次请求在等待令牌前调用，wait为预计等待时长
+type MetricsHook interface {
+	ObserveRequest(method string, statusCode int, latency time.Duration, err error)
+	ObserveNotify(notifyType string, err error)
+}
+
+var metricsHook MetricsHook = nopMetricsHook{}
+
+// SetMetricsHook 设置监控接口，传nil则关闭监控
+// 开箱即用的Prometheus实现见metrics包
+func SetMetricsHook(h MetricsHook) {
+	if h == nil {
+		h = nopMetricsHook{}
+	}
+	metricsHook = h
+}
+
+type nopMetricsHook struct{}
+
+func (nopMetricsHook) ObserveRequest(string, int, time.Duration, error) {}
+
+func (nopMetricsHook) ObserveNotify(string, error) {}
+
+// 提取请求的商户号，嵌入config.Config的Request均已实现GetMerchantId方法
+func requestMerchantId(req TPRequest) string {
+	if r, ok := req.(interface{ GetMerchantId() string }); ok {
+		return r.GetMerchantId()
+	}
+	return ""
+}
+
+// 提取请求的method，自定义的TPRequest可实现GetMethod方法
+func requestMethod(req TPRequest) string {
+	if r, ok := req.(interface{ GetMethod() string }); ok {
+		return r.GetMethod()
+	}
+	return ""
+}
@@ -0,0 +1,275 @@
+// Package metrics 提供tt_pay.MetricsHook的Prometheus文本格式实现
+// 不依赖Prometheus客户端库，通过http.Handler暴露指标，可直接被Prometheus抓取
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/liaoxxxx/tt_pay/util"
+)
+
+const (
+	contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+	// 回调失败原因
+	ReasonInvalidSign = "invalid_sign"
+	ReasonParseError  = "parse_error"
+)
+
+// DefaultBuckets 为请求耗时直方图的默认分桶，单位秒
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Collector 实现了tt_pay.MetricsHook及http.Handler
+type Collector struct {
+	namespace string
+	buckets   []float64
+
+	mu         sync.Mutex
+	requests   map[string]uint64     // method
+	latencies  map[string]*histogram // method
+	statuses   map[[2]string]uint64  // method, status
+	bizErrors  map[[3]string]uint64  // method, code, sub_code
+	netErrors  map[string]uint64     // method
+	notifies   map[string]uint64     // notify_type
+	notifyErrs map[[2]string]uint64  // notify_type, reason
+	waits      map[string]*histogram // method
+}
+
+type histogram struct {
+	counts []uint64 // 与buckets一一对应，非累计
+	sum    float64
+	count  uint64
+}
+
+// NewCollector 初始化Collector，namespace为指标名前缀，为空时默认为tt_pay
+// buckets为空时使用DefaultBuckets
+func NewCollector(namespace string, buckets []float64) *Collector {
+	if namespace == "" {
+		namespace = "tt_pay"
+	}
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	return &Collector{
+		namespace:  namespace,
+		buckets:    sorted,
+		requests:   make(map[string]uint64),
+		latencies:  make(map[string]*histogram),
+		statuses:   make(map[[2]string]uint64),
+		bizErrors:  make(map[[3]string]uint64),
+		netErrors:  make(map[string]uint64),
+		notifies:   make(map[string]uint64),
+		notifyErrs: make(map[[2]string]uint64),
+		waits:      make(map[string]*histogram),
+	}
+}
+
+// ObserveRequest 记录一次网关调用
+func (c *Collector) ObserveRequest(method string, statusCode int, latency time.Duration, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.requests[method]++
+	c.observe(c.latencies, method, latency)
+
+	if statusCode > 0 {
+		c.statuses[[2]string{method, strconv.Itoa(statusCode)}]++
+	}
+
+	if err == nil {
+		return
+	}
+	var tpErr *util.Error
+	if errors.As(err, &tpErr) {
+		c.bizErrors[[3]string{method, tpErr.Code, tpErr.SubCode}]++
+	} else {
+		c.netErrors[method]++
+	}
+}
+
+// ObserveNotify 记录一次回调解析
+func (c *Collector) ObserveNotify(notifyType string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.notifies[notifyType]++
+	if err == nil {
+		return
+	}
+	reason := ReasonParseError
+	if errors.Is(err, util.ErrInvalidSign) {
+		reason = ReasonInvalidSign
+	}
+	c.notifyErrs[[2]string{notifyType, reason}]++
+}
+
+// ObserveLimiterWait 记录一次客户端限流等待，按method统计
+func (c *Collector) ObserveLimiterWait(merchantId, method string, wait time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.observe(c.waits, method, wait)
+}
+
+// 记录到method对应的直方图，调用方需持有锁
+func (c *Collector) observe(m map[string]*histogram, method string, d time.Duration) {
+	h, ok := m[method]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(c.buckets))}
+		m[method] = h
+	}
+	seconds := d.Seconds()
+	for i, bound := range c.buckets {
+		if seconds <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// ServeHTTP 以Prometheus文本格式输出指标
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	if _, err := c.WriteTo(w); err != nil {
+		util.Debug("metrics Collector WriteTo err: %v", err)
+	}
+}
+
+// WriteTo 以Prometheus文本格式输出指标，输出顺序固定
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var b strings.Builder
+	ns := c.namespace
+
+	writeHeader(&b, ns+"_requests_total", "counter", "Total gateway requests by method.")
+	for _, method := range sortedKeys(c.requests) {
+		writeSample(&b, ns+"_requests_total", labels("method", method), float64(c.requests[method]))
+	}
+
+	c.writeHistogram(&b, ns+"_request_duration_seconds", "Gateway request latency in seconds.", c.latencies)
+
+	writeHeader(&b, ns+"_http_responses_total", "counter", "Gateway HTTP responses by method and status code.")
+	for _, k := range sortedKeys2(c.statuses) {
+		writeSample(&b, ns+"_http_responses_total", labels("method", k[0], "status", k[1]), float64(c.statuses[k]))
+	}
+
+	writeHeader(&b, ns+"_business_errors_total", "counter", "Gateway business errors by method, code and sub_code.")
+	for _, k := range sortedKeys3(c.bizErrors) {
+		writeSample(&b, ns+"_business_errors_total",
+			labels("method", k[0], "code", k[1], "sub_code", k[2]), float64(c.bizErrors[k]))
+	}
+
+	writeHeader(&b, ns+"_transport_errors_total", "counter", "Gateway requests failed without a business response.")
+	for _, method := range sortedKeys(c.netErrors) {
+		writeSample(&b, ns+"_transport_errors_total", labels("method", method), float64(c.netErrors[method]))
+	}
+
+	writeHeader(&b, ns+"_notify_total", "counter", "Callback notifications handled by type.")
+	for _, typ := range sortedKeys(c.notifies) {
+		writeSample(&b, ns+"_notify_total", labels("type", typ), float64(c.notifies[typ]))
+	}
+
+	writeHeader(&b, ns+"_notify_failures_total", "counter", "Callback notifications rejected by type and reason.")
+	for _, k := range sortedKeys2(c.notifyErrs) {
+		writeSample(&b, ns+"_notify_failures_total", labels("type", k[0], "reason", k[1]), float64(c.notifyErrs[k]))
+	}
+
+	c.writeHistogram(&b, ns+"_limiter_wait_seconds", "Client-side rate limiter wait in seconds.", c.waits)
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func (c *Collector) writeHistogram(b *strings.Builder, name, help string, m map[string]*histogram) {
+	writeHeader(b, name, "histogram", help)
+	for _, method := range sortedKeys(m) {
+		h := m[method]
+		var cumulative uint64
+		for i, bound := range c.buckets {
+			cumulative += h.counts[i]
+			writeSample(b, name+"_bucket", labels("method", method, "le", formatFloat(bound)), float64(cumulative))
+		}
+		writeSample(b, name+"_bucket", labels("method", method, "le", "+Inf"), float64(h.count))
+		writeSample(b, name+"_sum", labels("method", method), h.sum)
+		writeSample(b, name+"_count", labels("method", method), float64(h.count))
+	}
+}
+
+func writeHeader(b *strings.Builder, name, typ, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func writeSample(b *strings.Builder, name, labels string, val float64) {
+	fmt.Fprintf(b, "%s{%s} %s\n", name, labels, formatFloat(val))
+}
+
+// labels 按 key, value 交替传入
+func labels(kv ...string) string {
+	pairs := make([]string, 0, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		pairs = append(pairs, kv[i]+`="`+escapeLabel(kv[i+1])+`"`)
+	}
+	return strings.Join(pairs, ",")
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedKeys2(m map[[2]string]uint64) [][2]string {
+	keys := make([][2]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	return keys
+}
+
+func sortedKeys3(m map[[3]string]uint64) [][3]string {
+	keys := make([][3]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		for n := 0; n < 3; n++ {
+			if keys[i][n] != keys[j][n] {
+				return keys[i][n] < keys[j][n]
+			}
+		}
+		return false
+	})
+	return keys
+}
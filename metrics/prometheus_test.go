@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/liaoxxxx/tt_pay/consts"
+	"github.com/liaoxxxx/tt_pay/util"
+)
+
+func TestCollector(t *testing.T) {
+	c := NewCollector("", []float64{0.1, 1})
+	c.ObserveRequest(consts.MethodTradeQuery, 200, 50*time.Millisecond, nil)
+	c.ObserveRequest(consts.MethodTradeQuery, 200, 500*time.Millisecond,
+		&util.Error{Code: "40004", SubCode: "TP.SYSTEM_ERROR"})
+	c.ObserveRequest(consts.MethodRefundCreate, 0, 3*time.Second, errors.New("dial tcp: timeout"))
+	c.ObserveRequest(consts.MethodRefundCreate, 502, time.Second, util.Wrap(errors.New("bad json"), "decode"))
+	c.ObserveNotify(consts.NotifyTypeTrade, nil)
+	c.ObserveNotify(consts.NotifyTypeTrade, util.ErrInvalidSign)
+	c.ObserveNotify(consts.NotifyTypeRefund, errors.New("invalid URL escape"))
+	c.ObserveLimiterWait("merchant_1", consts.MethodTradeQuery, 0)
+	c.ObserveLimiterWait("merchant_2", consts.MethodTradeQuery, 200*time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("unexpected content type %s", ct)
+	}
+	body := rec.Body.String()
+
+	for _, line := range []string{
+		`tt_pay_requests_total{method="tp.trade.query"} 2`,
+		`tt_pay_requests_total{method="tp.refund.create"} 2`,
+		`tt_pay_request_duration_seconds_bucket{method="tp.trade.query",le="0.1"} 1`,
+		`tt_pay_request_duration_seconds_bucket{method="tp.trade.query",le="1"} 2`,
+		`tt_pay_request_duration_seconds_bucket{method="tp.refund.create",le="1"} 1`,
+		`tt_pay_request_duration_seconds_bucket{method="tp.refund.create",le="+Inf"} 2`,
+		`tt_pay_request_duration_seconds_count{method="tp.trade.query"} 2`,
+		`tt_pay_http_responses_total{method="tp.trade.query",status="200"} 2`,
+		`tt_pay_http_responses_total{method="tp.refund.create",status="502"} 1`,
+		`tt_pay_business_errors_total{method="tp.trade.query",code="40004",sub_code="TP.SYSTEM_ERROR"} 1`,
+		`tt_pay_transport_errors_total{method="tp.refund.create"} 2`,
+		`tt_pay_notify_total{type="trade.notify"} 2`,
+		`tt_pay_notify_failures_total{type="trade.notify",reason="invalid_sign"} 1`,
+		`tt_pay_notify_failures_total{type="refund.notify",reason="parse_error"} 1`,
+		`# TYPE tt_pay_request_duration_seconds histogram`,
+		`tt_pay_limiter_wait_seconds_bucket{method="tp.trade.query",le="0.1"} 1`,
+		`tt_pay_limiter_wait_seconds_bucket{method="tp.trade.query",le="1"} 2`,
+		`tt_pay_limiter_wait_seconds_sum{method="tp.trade.query"} 0.2`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, body)
+		}
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	if got := labels("sub_code", "a\"b\\c\nd"); got != `sub_code="a\"b\\c\nd"` {
+		t.Errorf("got %s", got)
+	}
+}
@@ -0,0 +1,80 @@
+package tt_pay
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/liaoxxxx/tt_pay/consts"
+	"github.com/liaoxxxx/tt_pay/util"
+)
+
+type requestObservation struct {
+	method     string
+	statusCode int
+	err        error
+}
+
+type fakeMetricsHook struct {
+	mu       sync.Mutex
+	requests []requestObservation
+	notifies map[string][]error
+	waits    []time.Duration
+}
+
+func (h *fakeMetricsHook) ObserveRequest(method string, statusCode int, latency time.Duration, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.requests = append(h.requests, requestObservation{method, statusCode, err})
+}
+
+func (h *fakeMetricsHook) ObserveNotify(notifyType string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.notifies == nil {
+		h.notifies = make(map[string][]error)
+	}
+	h.notifies[notifyType] = append(h.notifies[notifyType], err)
+}
+
+func (h *fakeMetricsHook) ObserveLimiterWait(merchantId, method string, wait time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.waits = append(h.waits, wait)
+}
+
+func TestMetricsHook(t *testing.T) {
+	hook := new(fakeMetricsHook)
+	SetMetricsHook(hook)
+	defer SetMetricsHook(nil)
+
+	ts := newStubGateway(t, `{"response":{"code":"40004","msg":"Business Failed","sub_code":"TP.TRADE_NOT_EXIST"}}`)
+	req := NewTradeQueryRequest(testConfig(ts.URL))
+	req.Uid = "uid_1"
+	req.OutOrderNo = "order_1"
+	if _, err := TradeQuery(context.Background(), req); err == nil {
+		t.Fatal("expected business error")
+	}
+
+	notifyReq := new(TradeNotifyRequest)
+	notifyReq.SetParam("out_order_no=order_1&sign=bad")
+	if _, err := TradeNotify(context.Background(), notifyReq); !errors.Is(err, util.ErrInvalidSign) {
+		t.Fatalf("expected invalid sign, got %v", err)
+	}
+
+	if len(hook.requests) != 1 {
+		t.Fatalf("expected 1 request observation, got %d", len(hook.requests))
+	}
+	got := hook.requests[0]
+	if got.method != consts.MethodTradeQuery || got.statusCode != 200 {
+		t.Errorf("unexpected observation %+v", got)
+	}
+	if tpErr, ok := got.err.(*util.Error); !ok || tpErr.SubCode != "TP.TRADE_NOT_EXIST" {
+		t.Errorf("expected util.Error, got %v", got.err)
+	}
+	if errs := hook.notifies[consts.NotifyTypeTrade]; len(errs) != 1 || errs[0] != util.ErrInvalidSign {
+		t.Errorf("unexpected notify observations %v", errs)
+	}
+}
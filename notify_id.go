@@ -0,0 +1,26 @@
+package tt_pay
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sort"
+)
+
+// NotifyMessageId 返回回调消息的唯一标识，用于outbox及forwarder去重
+// 有notify_id时为typ:notify_id，否则为按键排序后全部参数的sha1，同一回调重复到达时结果相同
+func NotifyMessageId(typ string, param map[string]string) string {
+	if id := param["notify_id"]; id != "" {
+		return typ + ":" + id
+	}
+	keys := make([]string, 0, len(param))
+	for k := range param {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	h := sha1.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s=%s&", k, param[k])
+	}
+	return typ + ":" + hex.EncodeToString(h.Sum(nil))
+}
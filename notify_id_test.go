@@ -0,0 +1,21 @@
+package tt_pay
+
+import (
+	"testing"
+
+	"github.com/liaoxxxx/tt_pay/consts"
+)
+
+func TestNotifyMessageId(t *testing.T) {
+	if got := NotifyMessageId(consts.NotifyTypeTrade, map[string]string{"notify_id": "n_1", "out_order_no": "order_1"}); got != "trade.notify:n_1" {
+		t.Errorf("got %s", got)
+	}
+	a := NotifyMessageId(consts.NotifyTypeRefund, map[string]string{"out_refund_no": "r_1", "refund_amount": "100"})
+	b := NotifyMessageId(consts.NotifyTypeRefund, map[string]string{"refund_amount": "100", "out_refund_no": "r_1"})
+	if a != b || len(a) != len("refund.notify:")+40 {
+		t.Errorf("unexpected ids %s %s", a, b)
+	}
+	if c := NotifyMessageId(consts.NotifyTypeRefund, map[string]string{"out_refund_no": "r_1", "refund_amount": "200"}); c == a {
+		t.Errorf("different params must not share id %s", c)
+	}
+}
@@ -0,0 +1,44 @@
+package tt_pay
+
+import (
+	"context"
+	"log"
+	"strconv"
+
+	"github.com/liaoxxxx/tt_pay/store"
+)
+
+var orderStore store.OrderStore
+
+// SetOrderStore 设置订单存储，传nil则关闭
+// 配置后下单、查询及回调解析成功时会自动记录订单状态，实现见store包
+// 记录失败只打印日志，不影响接口返回
+func SetOrderStore(s store.OrderStore) {
+	orderStore = s
+}
+
+// 记录订单后发布对应的生命周期事件，见SetEventBus
+func recordOrder(ctx context.Context, o *store.Order, source string) {
+	if orderStore != nil && o.OutNo != "" {
+		if err := orderStore.Record(ctx, o, source); err != nil {
+			log.Printf("tt_pay: record %s order [%s] failed: %v", o.Kind, o.OutNo, err)
+		}
+	}
+	publishOrder(ctx, o, source)
+}
+
+// 返回第一个非空值
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// 财经侧返回的金额为字符串，解析失败时按未知处理
+func parseAmount(s string) int64 {
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
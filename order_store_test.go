@@ -0,0 +1,75 @@
+package tt_pay
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/liaoxxxx/tt_pay/store"
+)
+
+func TestOrderStoreHooks(t *testing.T) {
+	s := store.NewMemoryStore()
+	SetOrderStore(s)
+	defer SetOrderStore(nil)
+	ctx := context.Background()
+
+	ts := newStubGateway(t, `{"response":{"code":"10000","msg":"Success","out_order_no":"order_1",`+
+		`"out_refund_no":"refund_1","refund_no":"r_100","refund_amount":"50","refund_status":"SUCCESS"},"sign":"s"}`)
+
+	req := NewRefundCreateRequest(testConfig(ts.URL))
+	req.Uid = testUid
+	req.OutOrderNo = "order_1"
+	req.OutRefundNo = "refund_1"
+	req.RefundAmount = 50
+	req.NotifyUrl = "https://example.com/notify"
+	req.RiskInfo = `{"ip":"` + testIp + `"}`
+	if _, err := RefundCreate(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+
+	queryReq := NewRefundQueryRequest(testConfig(ts.URL))
+	queryReq.Uid = testUid
+	queryReq.RefundNo = "r_100"
+	if _, err := RefundQuery(ctx, queryReq); err != nil {
+		t.Fatal(err)
+	}
+
+	o, err := s.Get(ctx, store.KindRefund, "merchant_1", "refund_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.TradeNo != "r_100" || o.OutOrderNo != "order_1" || o.Amount != 50 || o.Status != "SUCCESS" {
+		t.Errorf("unexpected order %+v", o)
+	}
+	history, _ := s.History(ctx, store.KindRefund, "merchant_1", "refund_1")
+	if len(history) != 2 || history[0].To != store.StatusCreated || history[1].Source != store.SourceQuery {
+		t.Errorf("unexpected history %+v", history)
+	}
+}
+
+func TestOrderStoreSkipsFailedCalls(t *testing.T) {
+	s := store.NewMemoryStore()
+	SetOrderStore(s)
+	defer SetOrderStore(nil)
+
+	ts := newStubGateway(t, `{"response":{"code":"40004","msg":"Business Failed","sub_code":"TP.TRADE_NOT_EXIST"}}`)
+	req := NewTradeQueryRequest(testConfig(ts.URL))
+	req.Uid = testUid
+	req.OutOrderNo = "order_1"
+	if _, err := TradeQuery(context.Background(), req); err == nil {
+		t.Fatal("expected business error")
+	}
+	if _, err := s.Get(context.Background(), store.KindTrade, "merchant_1", "order_1"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("failed query must not be recorded, got %v", err)
+	}
+}
+
+func TestNotifyStoreOrder(t *testing.T) {
+	resp := &WithdrawNotifyResponse{MerchantId: "merchant_1", OutTradeNo: "w_1", WithdrawTradeNo: "wt_1",
+		Amount: "300", WithdrawStatus: "SUCCESS"}
+	o := resp.storeOrder()
+	if o.Kind != store.KindWithdraw || o.OutNo != "w_1" || o.TradeNo != "wt_1" || o.Amount != 300 || o.Status != "SUCCESS" {
+		t.Errorf("unexpected order %+v", o)
+	}
+}
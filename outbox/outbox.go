@@ -0,0 +1,246 @@
+// Package outbox 为回调处理提供事务性发件箱：
+// 验签通过的回调先持久化再应答财经侧，之后异步投递给业务处理函数，
+// 失败按退避重试，超过最大次数后进入死信，可在排查后重放。
+//
+// 业务处理函数可能被重复调用，需按订单号幂等处理。
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/liaoxxxx/tt_pay"
+	"github.com/liaoxxxx/tt_pay/consts"
+	"github.com/liaoxxxx/tt_pay/util"
+)
+
+const (
+	DefaultMaxAttempts   = 8                // 进入死信前的最大投递次数
+	DefaultRetryInterval = 10 * time.Second // 首次重试间隔，之后每次翻倍
+	DefaultBatchSize     = 100              // RunOnce每次处理的最大消息数
+	maxRetryInterval     = 30 * time.Minute
+)
+
+// ErrNoHandler 未设置对应类型的处理函数
+var ErrNoHandler = errors.New("outbox: no handler for notify type")
+
+// Handlers 为各类回调的业务处理函数，返回错误时稍后重试
+type Handlers struct {
+	Trade    func(ctx context.Context, resp *tt_pay.TradeNotifyResponse) error
+	Refund   func(ctx context.Context, resp *tt_pay.RefundNotifyResponse) error
+	Withdraw func(ctx context.Context, resp *tt_pay.WithdrawNotifyResponse) error
+}
+
+// Outbox 持久化回调并投递给业务处理函数
+type Outbox struct {
+	store         Store
+	handlers      Handlers
+	clock         tt_pay.Clock
+	maxAttempts   int
+	retryInterval time.Duration
+	wake          chan struct{}
+}
+
+// New 初始化Outbox
+func New(store Store, handlers Handlers) *Outbox {
+	return &Outbox{
+		store:         store,
+		handlers:      handlers,
+		clock:         clockFunc(tt_pay.Now),
+		maxAttempts:   DefaultMaxAttempts,
+		retryInterval: DefaultRetryInterval,
+		wake:          make(chan struct{}, 1),
+	}
+}
+
+type clockFunc func() time.Time
+
+func (f clockFunc) Now() time.Time { return f() }
+
+// SetClock 设置时间来源，默认与tt_pay.SetClock一致
+func (o *Outbox) SetClock(c tt_pay.Clock) {
+	o.clock = c
+}
+
+// SetRetry 设置最大投递次数及首次重试间隔
+func (o *Outbox) SetRetry(maxAttempts int, interval time.Duration) {
+	o.maxAttempts = maxAttempts
+	o.retryInterval = interval
+}
+
+// TradeNotify 验签并保存下单回调，返回nil后才可应答财经侧成功
+func (o *Outbox) TradeNotify(ctx context.Context, req *tt_pay.TradeNotifyRequest) (*tt_pay.TradeNotifyResponse, error) {
+	resp, err := tt_pay.TradeNotify(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp, o.add(ctx, consts.NotifyTypeTrade, resp.Param, req.Param)
+}
+
+// RefundNotify 验签并保存退款回调，返回nil后才可应答财经侧成功
+func (o *Outbox) RefundNotify(ctx context.Context, req *tt_pay.RefundNotifyRequest) (*tt_pay.RefundNotifyResponse, error) {
+	resp, err := tt_pay.RefundNotify(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp, o.add(ctx, consts.NotifyTypeRefund, resp.Param, req.Param)
+}
+
+// WithdrawNotify 验签并保存提现回调，返回nil后才可应答财经侧成功
+func (o *Outbox) WithdrawNotify(ctx context.Context, req *tt_pay.WithdrawNotifyRequest) (*tt_pay.WithdrawNotifyResponse, error) {
+	resp, err := tt_pay.WithdrawNotify(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp, o.add(ctx, consts.NotifyTypeWithdraw, resp.Param, req.Param)
+}
+
+// 保存消息并唤醒Run，重复到达的回调不会重复保存，标识与forwarder一致
+func (o *Outbox) add(ctx context.Context, typ string, params map[string]string, param string) error {
+	now := o.clock.Now()
+	_, err := o.store.Add(ctx, Message{
+		Id:          tt_pay.NotifyMessageId(typ, params),
+		Type:        typ,
+		Param:       param,
+		State:       StatePending,
+		NextAttempt: now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	})
+	if err != nil {
+		return util.Wrap(err, "Outbox failed when [Store.Add()]")
+	}
+	o.notify()
+	return nil
+}
+
+func (o *Outbox) notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run 每隔interval或有新消息时调用一次RunOnce，直到ctx结束，应在单独的goroutine中运行
+func (o *Outbox) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := o.RunOnce(ctx); err != nil {
+			util.Debug("Outbox RunOnce failed: err[%s]", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-o.wake:
+		}
+	}
+}
+
+// RunOnce 投递一批到期的消息，返回处理的消息数
+func (o *Outbox) RunOnce(ctx context.Context) (int, error) {
+	due, err := o.store.Due(ctx, o.clock.Now(), DefaultBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	for i, m := range due {
+		if err := ctx.Err(); err != nil {
+			return i, err
+		}
+		if err := o.deliver(ctx, m); err != nil {
+			return i, err
+		}
+	}
+	return len(due), nil
+}
+
+// 投递一条消息并更新状态，只有存储失败时返回错误
+func (o *Outbox) deliver(ctx context.Context, m Message) error {
+	err := o.handle(ctx, m)
+	now := o.clock.Now()
+	m.Attempts++
+	m.UpdatedAt = now
+	switch {
+	case err == nil:
+		m.State = StateDelivered
+		m.LastError = ""
+	case m.Attempts >= o.maxAttempts:
+		m.State = StateDead
+		m.LastError = err.Error()
+	default:
+		m.LastError = err.Error()
+		m.NextAttempt = now.Add(o.backoff(m.Attempts))
+	}
+	if err != nil {
+		util.Debug("Deliver notify [%s] failed: attempt[%d] err[%s]", m.Id, m.Attempts, err)
+	}
+	return o.store.Update(ctx, m)
+}
+
+func (o *Outbox) backoff(attempts int) time.Duration {
+	d := o.retryInterval
+	for i := 1; i < attempts && d < maxRetryInterval; i++ {
+		d *= 2
+	}
+	if d > maxRetryInterval {
+		d = maxRetryInterval
+	}
+	return d
+}
+
+// 解析已验签的参数并调用对应的处理函数
+func (o *Outbox) handle(ctx context.Context, m Message) error {
+	values, err := url.ParseQuery(m.Param)
+	if err != nil {
+		return err
+	}
+	param := make(map[string]string, len(values))
+	for key, val := range values {
+		param[key] = val[0]
+	}
+	switch {
+	case m.Type == consts.NotifyTypeTrade && o.handlers.Trade != nil:
+		resp := &tt_pay.TradeNotifyResponse{Param: param}
+		resp.Decode()
+		return o.handlers.Trade(ctx, resp)
+	case m.Type == consts.NotifyTypeRefund && o.handlers.Refund != nil:
+		resp := &tt_pay.RefundNotifyResponse{Param: param}
+		resp.Decode()
+		return o.handlers.Refund(ctx, resp)
+	case m.Type == consts.NotifyTypeWithdraw && o.handlers.Withdraw != nil:
+		resp := &tt_pay.WithdrawNotifyResponse{Param: param}
+		resp.Decode()
+		return o.handlers.Withdraw(ctx, resp)
+	}
+	return fmt.Errorf("%w: %s", ErrNoHandler, m.Type)
+}
+
+// DeadLetters 返回死信，limit<=0时返回全部
+func (o *Outbox) DeadLetters(ctx context.Context, limit int) ([]Message, error) {
+	return o.store.List(ctx, StateDead, limit)
+}
+
+// Replay 将死信重置为待投递，由下一次RunOnce重新投递
+func (o *Outbox) Replay(ctx context.Context, id string) error {
+	m, err := o.store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if m.State != StateDead {
+		return fmt.Errorf("outbox: message %s is %s, not dead", id, m.State)
+	}
+	now := o.clock.Now()
+	m.State = StatePending
+	m.Attempts = 0
+	m.NextAttempt = now
+	m.UpdatedAt = now
+	if err := o.store.Update(ctx, m); err != nil {
+		return err
+	}
+	o.notify()
+	return nil
+}
@@ -0,0 +1,253 @@
+package outbox
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"database/sql"
+	"encoding/pem"
+	"errors"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/liaoxxxx/tt_pay"
+	"github.com/liaoxxxx/tt_pay/consts"
+	"github.com/liaoxxxx/tt_pay/store"
+	"github.com/liaoxxxx/tt_pay/util"
+
+	_ "modernc.org/sqlite"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.t }
+
+func (c *fakeClock) Advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestKeyPair(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	private := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	public := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})
+	return string(private), string(public)
+}
+
+func signNotify(t *testing.T, params map[string]string, privateKey string) string {
+	t.Helper()
+	signMap := make(map[string]interface{})
+	values := url.Values{}
+	for k, v := range params {
+		signMap[k] = v
+		values.Set(k, v)
+	}
+	sign, err := util.BuildMd5WithRsa(signMap, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values.Set("sign", sign)
+	return values.Encode()
+}
+
+func openSQLiteStore(t *testing.T, path string) *SQLStore {
+	t.Helper()
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// :memory:数据库每个连接独立
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	s := NewSQLStore(db, store.DialectSQLite)
+	if err := s.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestOutboxPersistsBeforeDelivery(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "outbox.db")
+	priv, pub := newTestKeyPair(t)
+	param := signNotify(t, map[string]string{
+		"notify_id":    "n_1",
+		"merchant_id":  "merchant_1",
+		"out_order_no": "order_1",
+		"trade_status": "SUCCESS",
+	}, priv)
+
+	// 保存后未投递即退出
+	o := New(openSQLiteStore(t, path), Handlers{})
+	req := &tt_pay.TradeNotifyRequest{Param: param, PublicKey: pub}
+	if _, err := o.TradeNotify(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	// 财经侧重复通知
+	if _, err := o.TradeNotify(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	// 验签失败的回调不保存
+	bad := &tt_pay.TradeNotifyRequest{Param: param + "&extension=x", PublicKey: pub}
+	if _, err := o.TradeNotify(ctx, bad); !errors.Is(err, util.ErrInvalidSign) {
+		t.Fatalf("expected ErrInvalidSign, got %v", err)
+	}
+
+	var got []string
+	o = New(openSQLiteStore(t, path), Handlers{
+		Trade: func(ctx context.Context, resp *tt_pay.TradeNotifyResponse) error {
+			got = append(got, resp.OutOrderNo+":"+resp.TradeStatus)
+			return nil
+		},
+	})
+	if n, err := o.RunOnce(ctx); err != nil || n != 1 {
+		t.Fatalf("RunOnce = %d, %v", n, err)
+	}
+	if len(got) != 1 || got[0] != "order_1:SUCCESS" {
+		t.Fatalf("unexpected deliveries %v", got)
+	}
+	m, err := o.store.Get(ctx, "trade.notify:n_1")
+	if err != nil || m.State != StateDelivered || m.Attempts != 1 {
+		t.Fatalf("unexpected message %+v, %v", m, err)
+	}
+	if n, _ := o.RunOnce(ctx); n != 0 {
+		t.Fatalf("delivered message redelivered")
+	}
+}
+
+func TestOutboxRetryAndReplay(t *testing.T) {
+	for name, s := range map[string]Store{
+		"memory": NewMemoryStore(),
+		"sqlite": openSQLiteStore(t, ":memory:"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			testRetryAndReplay(t, s)
+		})
+	}
+}
+
+func testRetryAndReplay(t *testing.T, s Store) {
+	ctx := context.Background()
+	clock := &fakeClock{t: time.Unix(1565000000, 0)}
+	priv, pub := newTestKeyPair(t)
+	param := signNotify(t, map[string]string{
+		"notify_id":       "n_2",
+		"out_refund_no":   "refund_1",
+		"refund_status":   "SUCCESS",
+		"refund_amount":   "50",
+		"out_order_no":    "order_1",
+		"merchant_id":     "merchant_1",
+		"refund_no":       "r_100",
+		"event_code":      "refund",
+		"refund_currency": "CNY",
+	}, priv)
+
+	var attempts int
+	healthy := false
+	o := New(s, Handlers{
+		Refund: func(ctx context.Context, resp *tt_pay.RefundNotifyResponse) error {
+			attempts++
+			if !healthy {
+				return errors.New("db unavailable")
+			}
+			if resp.OutRefundNo != "refund_1" {
+				t.Errorf("unexpected response %+v", resp)
+			}
+			return nil
+		},
+	})
+	o.SetClock(clock)
+	o.SetRetry(3, time.Second)
+	if _, err := o.RefundNotify(ctx, &tt_pay.RefundNotifyRequest{Param: param, PublicKey: pub}); err != nil {
+		t.Fatal(err)
+	}
+	// 没有处理函数的类型同样重试后进入死信
+	withdraw := signNotify(t, map[string]string{"notify_id": "n_3", "out_trade_no": "w_1"}, priv)
+	if _, err := o.WithdrawNotify(ctx, &tt_pay.WithdrawNotifyRequest{Param: withdraw, PublicKey: pub}); err != nil {
+		t.Fatal(err)
+	}
+
+	o.RunOnce(ctx)
+	// 重试间隔未到
+	if n, _ := o.RunOnce(ctx); n != 0 {
+		t.Fatalf("retried too early")
+	}
+	clock.Advance(time.Second)
+	o.RunOnce(ctx)
+	clock.Advance(2 * time.Second)
+	o.RunOnce(ctx)
+	if attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d", attempts)
+	}
+
+	dead, err := o.DeadLetters(ctx, 0)
+	if err != nil || len(dead) != 2 {
+		t.Fatalf("DeadLetters = %+v, %v", dead, err)
+	}
+	if dead[0].LastError == "" || dead[0].Attempts != 3 {
+		t.Fatalf("unexpected dead letter %+v", dead[0])
+	}
+
+	healthy = true
+	if err := o.Replay(ctx, "refund.notify:n_2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Replay(ctx, "refund.notify:n_2"); err == nil {
+		t.Fatal("expected error replaying pending message")
+	}
+	if err := o.Replay(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if n, _ := o.RunOnce(ctx); n != 1 || attempts != 4 {
+		t.Fatalf("replay not delivered: n=%d attempts=%d", n, attempts)
+	}
+	dead, _ = o.DeadLetters(ctx, 0)
+	if len(dead) != 1 || dead[0].Id != "withdraw.notify:n_3" || !strings.HasPrefix(dead[0].LastError, ErrNoHandler.Error()) {
+		t.Fatalf("unexpected dead letters %+v", dead)
+	}
+}
+
+func TestSQLStoreConcurrentAdd(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.db")
+	s := openSQLiteStore(t, "file:"+path+"?_pragma=busy_timeout(5000)")
+	s.db.SetMaxOpenConns(0)
+	ctx := context.Background()
+
+	// 同一回调并发到达，只保存一次
+	var wg sync.WaitGroup
+	added := make(chan bool, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := s.Add(ctx, Message{Id: consts.NotifyTypeTrade + ":n_1", Type: consts.NotifyTypeTrade, Param: "p", State: StatePending})
+			if err != nil {
+				t.Error(err)
+			}
+			added <- ok
+		}()
+	}
+	wg.Wait()
+	close(added)
+	n := 0
+	for ok := range added {
+		if ok {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Fatalf("expected exactly one add, got %d", n)
+	}
+}
@@ -0,0 +1,136 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/liaoxxxx/tt_pay/store"
+)
+
+// 建表语句，时间字段保存为Unix纳秒
+const sqlSchema = `CREATE TABLE IF NOT EXISTS tt_pay_notify_outbox (
+	id VARCHAR(128) NOT NULL,
+	type VARCHAR(32) NOT NULL,
+	param TEXT NOT NULL,
+	state VARCHAR(16) NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL,
+	next_attempt BIGINT NOT NULL,
+	created_at BIGINT NOT NULL,
+	updated_at BIGINT NOT NULL,
+	PRIMARY KEY (id)
+)`
+
+const messageColumns = "id, type, param, state, attempts, last_error, next_attempt, created_at, updated_at"
+
+// SQLStore 为database/sql实现，单机部署时可使用SQLite文件
+type SQLStore struct {
+	db      *sql.DB
+	dialect store.Dialect
+}
+
+// NewSQLStore 初始化SQLStore，db的驱动由调用方引入
+func NewSQLStore(db *sql.DB, dialect store.Dialect) *SQLStore {
+	return &SQLStore{db: db, dialect: dialect}
+}
+
+// Migrate 创建所需的表，表已存在时不做修改
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, sqlSchema); err != nil {
+		return fmt.Errorf("outbox: migrate: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) Add(ctx context.Context, m Message) (bool, error) {
+	res, err := s.db.ExecContext(ctx, s.dialect.Rebind(s.dialect.InsertIgnore("tt_pay_notify_outbox", messageColumns, "id")),
+		m.Id, m.Type, m.Param, string(m.State), m.Attempts, m.LastError,
+		m.NextAttempt.UnixNano(), m.CreatedAt.UnixNano(), m.UpdatedAt.UnixNano())
+	if err != nil {
+		return false, fmt.Errorf("outbox: add %s: %w", m.Id, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("outbox: add %s: %w", m.Id, err)
+	}
+	return n > 0, nil
+}
+
+func (s *SQLStore) Get(ctx context.Context, id string) (Message, error) {
+	row := s.db.QueryRowContext(ctx, s.dialect.Rebind(`SELECT `+messageColumns+` FROM tt_pay_notify_outbox WHERE id = ?`), id)
+	m, err := scanMessage(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Message{}, ErrNotFound
+	}
+	if err != nil {
+		return Message{}, fmt.Errorf("outbox: get %s: %w", id, err)
+	}
+	return m, nil
+}
+
+func (s *SQLStore) Update(ctx context.Context, m Message) error {
+	res, err := s.db.ExecContext(ctx, s.dialect.Rebind(`UPDATE tt_pay_notify_outbox SET state = ?, attempts = ?, last_error = ?,
+next_attempt = ?, updated_at = ? WHERE id = ?`),
+		string(m.State), m.Attempts, m.LastError, m.NextAttempt.UnixNano(), m.UpdatedAt.UnixNano(), m.Id)
+	if err != nil {
+		return fmt.Errorf("outbox: update %s: %w", m.Id, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLStore) Due(ctx context.Context, now time.Time, limit int) ([]Message, error) {
+	return s.query(ctx, `WHERE state = ? AND next_attempt <= ? ORDER BY next_attempt, id`, limit,
+		string(StatePending), now.UnixNano())
+}
+
+func (s *SQLStore) List(ctx context.Context, state State, limit int) ([]Message, error) {
+	return s.query(ctx, `WHERE state = ? ORDER BY created_at, id`, limit, string(state))
+}
+
+func (s *SQLStore) query(ctx context.Context, where string, limit int, args ...interface{}) ([]Message, error) {
+	query := `SELECT ` + messageColumns + ` FROM tt_pay_notify_outbox ` + where
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	rows, err := s.db.QueryContext(ctx, s.dialect.Rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("outbox: query: %w", err)
+	}
+	defer rows.Close()
+	var ret []Message
+	for rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("outbox: query: %w", err)
+		}
+		ret = append(ret, m)
+	}
+	return ret, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanMessage(row scanner) (Message, error) {
+	var (
+		m                                 Message
+		state                             string
+		nextAttempt, createdAt, updatedAt int64
+	)
+	err := row.Scan(&m.Id, &m.Type, &m.Param, &state, &m.Attempts, &m.LastError, &nextAttempt, &createdAt, &updatedAt)
+	if err != nil {
+		return Message{}, err
+	}
+	m.State = State(state)
+	m.NextAttempt = time.Unix(0, nextAttempt)
+	m.CreatedAt = time.Unix(0, createdAt)
+	m.UpdatedAt = time.Unix(0, updatedAt)
+	return m, nil
+}
@@ -0,0 +1,130 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// State 为消息的投递状态
+type State string
+
+const (
+	StatePending   State = "pending"   // 待投递或等待重试
+	StateDelivered State = "delivered" // 已投递成功
+	StateDead      State = "dead"      // 超过最大投递次数，需人工处理后Replay
+)
+
+// ErrNotFound 消息不存在
+var ErrNotFound = errors.New("outbox: message not found")
+
+// Message 为一条已验签的回调
+type Message struct {
+	Id          string // 回调类型与notify_id，同一回调重复到达时只保存一次
+	Type        string // consts.NotifyTypeTrade、NotifyTypeRefund或NotifyTypeWithdraw
+	Param       string // 回调原始参数
+	State       State
+	Attempts    int       // 已投递次数
+	LastError   string    // 最近一次投递失败的原因
+	NextAttempt time.Time // 下次投递时间
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// Store 为消息的存储接口，实现需保证并发安全，Add返回前需已持久化
+type Store interface {
+	// Add 保存新消息，Id已存在时不做修改并返回false
+	Add(ctx context.Context, m Message) (bool, error)
+	// Get 按Id查询，不存在时返回ErrNotFound
+	Get(ctx context.Context, id string) (Message, error)
+	// Update 更新消息的投递状态
+	Update(ctx context.Context, m Message) error
+	// Due 按NextAttempt先后返回不晚于now的待投递消息，最多limit条
+	Due(ctx context.Context, now time.Time, limit int) ([]Message, error)
+	// List 按创建先后返回指定状态的消息，limit<=0时不限制
+	List(ctx context.Context, state State, limit int) ([]Message, error)
+}
+
+// MemoryStore 为内存实现，仅用于测试，进程重启后消息丢失
+type MemoryStore struct {
+	mu       sync.Mutex
+	messages map[string]Message
+}
+
+// NewMemoryStore 初始化MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{messages: make(map[string]Message)}
+}
+
+func (s *MemoryStore) Add(ctx context.Context, m Message) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.messages[m.Id]; ok {
+		return false, nil
+	}
+	s.messages[m.Id] = m
+	return true, nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.messages[id]
+	if !ok {
+		return Message{}, ErrNotFound
+	}
+	return m, nil
+}
+
+func (s *MemoryStore) Update(ctx context.Context, m Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cur, ok := s.messages[m.Id]
+	if !ok {
+		return ErrNotFound
+	}
+	cur.State, cur.Attempts, cur.LastError = m.State, m.Attempts, m.LastError
+	cur.NextAttempt, cur.UpdatedAt = m.NextAttempt, m.UpdatedAt
+	s.messages[m.Id] = cur
+	return nil
+}
+
+func (s *MemoryStore) Due(ctx context.Context, now time.Time, limit int) ([]Message, error) {
+	return s.filter(func(m Message) bool {
+		return m.State == StatePending && !m.NextAttempt.After(now)
+	}, func(a, b Message) bool {
+		if a.NextAttempt.Equal(b.NextAttempt) {
+			return a.Id < b.Id
+		}
+		return a.NextAttempt.Before(b.NextAttempt)
+	}, limit), nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, state State, limit int) ([]Message, error) {
+	return s.filter(func(m Message) bool {
+		return m.State == state
+	}, func(a, b Message) bool {
+		if a.CreatedAt.Equal(b.CreatedAt) {
+			return a.Id < b.Id
+		}
+		return a.CreatedAt.Before(b.CreatedAt)
+	}, limit), nil
+}
+
+func (s *MemoryStore) filter(match func(Message) bool, less func(a, b Message) bool, limit int) []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ret []Message
+	for _, m := range s.messages {
+		if match(m) {
+			ret = append(ret, m)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return less(ret[i], ret[j]) })
+	if limit > 0 && len(ret) > limit {
+		ret = ret[:limit]
+	}
+	return ret
+}
@@ -0,0 +1,115 @@
+package payout
+
+import (
+	"crypto/md5"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Recipient 为一笔待发放的提现
+type Recipient struct {
+	Key       string `json:"key"`        // 收款人在批次内的唯一标识，用于生成稳定的OutTradeNo，为空时使用Uid
+	Uid       string `json:"uid"`        // 收款人uid
+	Amount    int    `json:"amount"`     // 金额，单位分
+	TradeName string `json:"trade_name"` // 为空时使用Template.TradeName
+	TradeDesc string `json:"trade_desc"` // 为空时使用Template.TradeDesc
+}
+
+func (r Recipient) key() string {
+	if r.Key != "" {
+		return r.Key
+	}
+	return r.Uid
+}
+
+// OutTradeNo 生成稳定的提现单号：批次号_标识，超过32位时标识部分用md5代替
+// 同一批次重复运行时单号不变，已受理的提现不会被重复发放
+func OutTradeNo(batchId, key string) string {
+	no := batchId + "_" + key
+	if len(no) <= 32 {
+		return no
+	}
+	sum := md5.Sum([]byte(key))
+	return (batchId + "_" + hex.EncodeToString(sum[:]))[:32]
+}
+
+// ReadCSV 读取收款人列表，首行为表头，需包含uid、amount列，可选key、trade_name、trade_desc列
+func ReadCSV(r io.Reader) ([]Recipient, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("payout: read csv header: %w", err)
+	}
+	cols := make(map[string]int, len(header))
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"uid", "amount"} {
+		if _, ok := cols[name]; !ok {
+			return nil, fmt.Errorf("payout: csv missing column %q", name)
+		}
+	}
+	get := func(record []string, name string) string {
+		if i, ok := cols[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var ret []Recipient
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return ret, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("payout: read csv: %w", err)
+		}
+		amount, err := strconv.Atoi(get(record, "amount"))
+		if err != nil {
+			return nil, fmt.Errorf("payout: csv line %d: invalid amount %q", line, get(record, "amount"))
+		}
+		ret = append(ret, Recipient{
+			Key:       get(record, "key"),
+			Uid:       get(record, "uid"),
+			Amount:    amount,
+			TradeName: get(record, "trade_name"),
+			TradeDesc: get(record, "trade_desc"),
+		})
+	}
+}
+
+// ReadJSON 读取收款人列表，格式为Recipient的JSON数组
+func ReadJSON(r io.Reader) ([]Recipient, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var ret []Recipient
+	if err := dec.Decode(&ret); err != nil {
+		return nil, fmt.Errorf("payout: read json: %w", err)
+	}
+	return ret, nil
+}
+
+// 查验收款人，标识重复或金额非正时返回错误
+func checkRecipients(recipients []Recipient) error {
+	seen := make(map[string]int, len(recipients))
+	for i, r := range recipients {
+		if r.Uid == "" {
+			return fmt.Errorf("payout: recipient %d: uid is empty", i)
+		}
+		if r.Amount <= 0 {
+			return fmt.Errorf("payout: recipient %d: amount must be positive", i)
+		}
+		if j, ok := seen[r.key()]; ok {
+			return fmt.Errorf("payout: recipient %d: duplicate key %q with recipient %d", i, r.key(), j)
+		}
+		seen[r.key()] = i
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package payout
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Outcome 为单笔提现的结果
+type Outcome string
+
+const (
+	OutcomePending   Outcome = "pending"   // 未执行，如ctx已取消
+	OutcomeCreated   Outcome = "created"   // 已受理，等待提现结果
+	OutcomeRejected  Outcome = "rejected"  // 下单被拒绝，未发放，修正后可重新Run
+	OutcomeUnknown   Outcome = "unknown"   // 下单结果未知，重新Run时会先查询确认
+	OutcomeSucceeded Outcome = "succeeded" // 对账确认提现成功
+	OutcomeFailed    Outcome = "failed"    // 对账确认提现失败
+)
+
+// 汇总时的输出顺序
+var outcomes = []Outcome{OutcomeSucceeded, OutcomeCreated, OutcomeFailed, OutcomeRejected, OutcomeUnknown, OutcomePending}
+
+// Item 为单笔提现的结果
+type Item struct {
+	Recipient
+	OutTradeNo      string
+	WithdrawTradeNo string
+	Status          string // 对账查询到的提现状态
+	Outcome         Outcome
+	Err             error
+}
+
+// Report 为一个批次的结果，Items与输入的收款人顺序一致
+type Report struct {
+	BatchId string
+	Items   []Item
+}
+
+// Count 返回结果为o的笔数
+func (r *Report) Count(o Outcome) int {
+	n := 0
+	for _, item := range r.Items {
+		if item.Outcome == o {
+			n++
+		}
+	}
+	return n
+}
+
+// Amount 返回结果为o的金额合计，单位分
+func (r *Report) Amount(o Outcome) int64 {
+	var sum int64
+	for _, item := range r.Items {
+		if item.Outcome == o {
+			sum += int64(item.Amount)
+		}
+	}
+	return sum
+}
+
+// Summary 返回按结果汇总的笔数与金额
+func (r *Report) Summary() string {
+	var total int64
+	for _, item := range r.Items {
+		total += int64(item.Amount)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "batch %s: %d recipients, amount %d", r.BatchId, len(r.Items), total)
+	for _, o := range outcomes {
+		if n := r.Count(o); n > 0 {
+			fmt.Fprintf(&b, "; %s %d, amount %d", o, n, r.Amount(o))
+		}
+	}
+	return b.String()
+}
+
+// WriteCSV 输出每笔提现的明细
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"key", "uid", "amount", "out_trade_no", "withdraw_trade_no", "status", "outcome", "error"})
+	for _, item := range r.Items {
+		var errMsg string
+		if item.Err != nil {
+			errMsg = item.Err.Error()
+		}
+		cw.Write([]string{item.key(), item.Uid, strconv.Itoa(item.Amount), item.OutTradeNo,
+			item.WithdrawTradeNo, item.Status, string(item.Outcome), errMsg})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,195 @@
+// Package payout 批量提现（如红包发放），支持并发执行、断点续跑与对账
+//
+// 每笔提现的单号由批次号和收款人标识生成，请求经idempotency.Guard发出，记录保存在checkpoint文件中：
+// 已受理的提现重新运行时直接返回之前的结果；结果未知的提现先查询确认，确认未受理才重新下单，避免重复发放。
+// 限流使用tt_pay.SetRateLimit对consts.MethodWithdrawCreate设置。
+package payout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/liaoxxxx/tt_pay"
+	"github.com/liaoxxxx/tt_pay/config"
+	"github.com/liaoxxxx/tt_pay/consts"
+	"github.com/liaoxxxx/tt_pay/idempotency"
+	"github.com/liaoxxxx/tt_pay/util"
+)
+
+// 批次号的最大长度，保证生成的单号中收款人标识部分足够区分
+const maxBatchIdLen = 16
+
+// Template 为每笔提现共用的参数
+type Template struct {
+	Config      config.Config
+	Currency    string
+	TradeName   string
+	TradeDesc   string
+	PaymentType string
+	ValidTime   time.Duration // 有效时长
+	NotifyUrl   string
+	RiskInfo    string
+}
+
+// Runner 执行一个批次的提现
+type Runner struct {
+	batchId     string
+	template    Template
+	concurrency int
+	store       *idempotency.FileStore
+	guard       *idempotency.Guard
+}
+
+// NewRunner 打开批次的checkpoint文件，文件不存在时创建
+// 同一批次应使用同一个checkpoint文件，且不能同时运行；所需的sub_code未收录时返回util.ErrSubCodeNotRegistered
+func NewRunner(batchId string, template Template, checkpoint string) (*Runner, error) {
+	if batchId == "" || len(batchId) > maxBatchIdLen {
+		return nil, fmt.Errorf("payout: batch id must be 1-%d characters", maxBatchIdLen)
+	}
+	store, err := idempotency.OpenFileStore(checkpoint)
+	if err != nil {
+		return nil, err
+	}
+	guard, err := idempotency.NewGuard(store)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	return &Runner{
+		batchId:     batchId,
+		template:    template,
+		concurrency: tt_pay.DefaultBatchConcurrency,
+		store:       store,
+		guard:       guard,
+	}, nil
+}
+
+// SetConcurrency 设置并发数，<=0时使用tt_pay.DefaultBatchConcurrency
+func (r *Runner) SetConcurrency(n int) {
+	if n <= 0 {
+		n = tt_pay.DefaultBatchConcurrency
+	}
+	r.concurrency = n
+}
+
+// Close 关闭checkpoint文件
+func (r *Runner) Close() error {
+	return r.store.Close()
+}
+
+// Run 对recipients逐笔提现下单，返回各笔的下单结果
+// 收款人标识重复或金额非正时不发起任何请求；ctx取消后尚未发出的提现保持OutcomePending
+func (r *Runner) Run(ctx context.Context, recipients []Recipient) (*Report, error) {
+	if err := checkRecipients(recipients); err != nil {
+		return nil, err
+	}
+	report := &Report{BatchId: r.batchId, Items: make([]Item, len(recipients))}
+	for i, rc := range recipients {
+		report.Items[i] = Item{Recipient: rc, OutTradeNo: OutTradeNo(r.batchId, rc.key()), Outcome: OutcomePending}
+	}
+	r.each(ctx, len(recipients), func(i int) {
+		item := &report.Items[i]
+		resp, err := r.guard.WithdrawCreate(ctx, r.request(item))
+		switch {
+		case err == nil:
+			item.Outcome = OutcomeCreated
+			item.WithdrawTradeNo = resp.WithdrawTradeNo
+			item.Err = nil
+		case errors.Is(err, idempotency.ErrAmbiguous), errors.Is(err, idempotency.ErrInFlight), ctx.Err() != nil:
+			item.Outcome = OutcomeUnknown
+			item.Err = err
+		default:
+			item.Outcome = OutcomeRejected
+			item.Err = err
+		}
+	})
+	return report, nil
+}
+
+// Reconcile 查询已受理及结果未知的提现，更新为最终结果
+// 查询确认不存在的提现保持OutcomeUnknown，可重新Run发放
+func (r *Runner) Reconcile(ctx context.Context, report *Report) {
+	var (
+		index []int
+		keys  []tt_pay.QueryKey
+	)
+	for i, item := range report.Items {
+		if item.Outcome == OutcomeCreated || item.Outcome == OutcomeUnknown {
+			index = append(index, i)
+			keys = append(keys, tt_pay.QueryKey{OutNo: item.OutTradeNo})
+		}
+	}
+	results := tt_pay.BatchWithdrawQuery(ctx, r.template.Config, keys, tt_pay.BatchOptions{Concurrency: r.concurrency})
+	for j, res := range results {
+		item := &report.Items[index[j]]
+		if res.Err != nil {
+			if !errors.Is(res.Err, util.ErrOrderNotExist) || item.Outcome != OutcomeUnknown {
+				item.Err = res.Err
+			}
+			continue
+		}
+		item.Err = nil
+		item.WithdrawTradeNo = res.Resp.WithdrawTradeNo
+		item.Status = res.Resp.Status
+		switch res.Resp.Status {
+		case consts.WithdrawStatusSuccess:
+			item.Outcome = OutcomeSucceeded
+		case consts.WithdrawStatusFail:
+			item.Outcome = OutcomeFailed
+		default:
+			item.Outcome = OutcomeCreated
+		}
+	}
+}
+
+func (r *Runner) request(item *Item) *tt_pay.WithdrawCreateRequest {
+	t := r.template
+	req := tt_pay.NewWithdrawCreateRequest(t.Config)
+	req.OutTradeNo = item.OutTradeNo
+	req.Uid = item.Uid
+	req.TotalAmount = item.Amount
+	req.Currency = t.Currency
+	req.TradeName = t.TradeName
+	if item.TradeName != "" {
+		req.TradeName = item.TradeName
+	}
+	req.TradeDesc = t.TradeDesc
+	if item.TradeDesc != "" {
+		req.TradeDesc = item.TradeDesc
+	}
+	req.ProductCode = "withdraw"
+	req.PaymentType = t.PaymentType
+	req.TradeTime = tt_pay.Now()
+	req.ValidTime = t.ValidTime
+	req.NotifyUrl = t.NotifyUrl
+	req.RiskInfo = t.RiskInfo
+	return req
+}
+
+// 以r.concurrency的并发对0..n-1调用f，ctx取消后不再调用
+func (r *Runner) each(ctx context.Context, n int, f func(i int)) {
+	items := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < r.concurrency && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range items {
+				f(i)
+			}
+		}()
+	}
+feed:
+	for i := 0; i < n; i++ {
+		select {
+		case items <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(items)
+	wg.Wait()
+}
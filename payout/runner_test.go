@@ -0,0 +1,193 @@
+package payout
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/liaoxxxx/tt_pay/config"
+	"github.com/liaoxxxx/tt_pay/consts"
+	"github.com/liaoxxxx/tt_pay/util"
+)
+
+// 本地网关桩：按uid决定下单结果，记录每个out_trade_no的下单次数
+type stubGateway struct {
+	mu       sync.Mutex
+	creates  map[string]int
+	accepted map[string]bool
+	flaky    map[string]bool // 首次下单返回系统错误但实际已受理的uid
+}
+
+func newStubGateway(t *testing.T) (*stubGateway, string) {
+	t.Helper()
+	g := &stubGateway{creates: make(map[string]int), accepted: make(map[string]bool), flaky: map[string]bool{"u_flaky": true}}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var biz map[string]interface{}
+		json.Unmarshal([]byte(r.FormValue("biz_content")), &biz)
+		no, _ := biz["out_trade_no"].(string)
+		uid, _ := biz["uid"].(string)
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		switch r.FormValue("method") {
+		case consts.MethodWithdrawCreate:
+			g.creates[no]++
+			if uid == "u_bad" {
+				w.Write([]byte(`{"response":{"code":"40004","msg":"Business Failed","sub_code":"TP.ACCOUNT_FROZEN"}}`))
+				return
+			}
+			g.accepted[no] = true
+			if g.flaky[uid] && g.creates[no] == 1 {
+				w.Write([]byte(`{"response":{"code":"20000","msg":"Service Currently Unavailable","sub_code":"TP.SYSTEM_ERROR"}}`))
+				return
+			}
+			w.Write([]byte(`{"response":{"code":"10000","msg":"Success","withdraw_trade_no":"wt_` + no + `"}}`))
+		case consts.MethodWithdrawQuery:
+			if !g.accepted[no] {
+				w.Write([]byte(`{"response":{"code":"40004","msg":"Business Failed","sub_code":"TP.WITHDRAW_NOT_EXIST"}}`))
+				return
+			}
+			w.Write([]byte(`{"response":{"code":"10000","msg":"Success","out_trade_no":"` + no +
+				`","withdraw_trade_no":"wt_` + no + `","status":"SUCCESS"}}`))
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return g, ts.URL
+}
+
+func testTemplate(domain string) Template {
+	return Template{
+		Config: config.Config{
+			AppId:             "app_1",
+			AppSecret:         "test-app-secret-0123456789",
+			MerchantId:        "merchant_1",
+			TPDomain:          domain,
+			TPClientTimeoutMs: 3000,
+		},
+		Currency:    "CNY",
+		TradeName:   "red packet",
+		TradeDesc:   "red packet",
+		PaymentType: "direct",
+		ValidTime:   5 * time.Minute,
+		NotifyUrl:   "https://example.com/notify",
+		RiskInfo:    `{"ip":"127.0.0.1"}`,
+	}
+}
+
+func TestRunnerResume(t *testing.T) {
+	registerTestSubCodes(t)
+	g, domain := newStubGateway(t)
+	checkpoint := filepath.Join(t.TempDir(), "batch.jsonl")
+	recipients, err := ReadCSV(strings.NewReader("uid,amount,key\nu_1,100,\nu_2,200,\nu_bad,300,\nu_flaky,400,k_4\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runner, err := NewRunner("b20240101", testTemplate(domain), checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := runner.Run(context.Background(), recipients)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner.Close()
+	if report.Count(OutcomeCreated) != 2 || report.Count(OutcomeRejected) != 1 || report.Count(OutcomeUnknown) != 1 {
+		t.Fatalf("unexpected report %s", report.Summary())
+	}
+	if item := report.Items[3]; item.OutTradeNo != "b20240101_k_4" || item.Outcome != OutcomeUnknown {
+		t.Fatalf("unexpected item %+v", item)
+	}
+
+	// 重新运行：已受理的不再下单，结果未知的查询确认已受理后不再下单
+	runner, err = NewRunner("b20240101", testTemplate(domain), checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	report, err = runner.Run(context.Background(), recipients)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Count(OutcomeCreated) != 3 || report.Count(OutcomeRejected) != 1 {
+		t.Fatalf("unexpected report after resume %s", report.Summary())
+	}
+	for no, n := range g.creates {
+		if want := map[bool]int{true: 2, false: 1}[strings.HasSuffix(no, "u_bad")]; n != want {
+			t.Errorf("%s created %d times, want %d", no, n, want)
+		}
+	}
+
+	runner.Reconcile(context.Background(), report)
+	if report.Count(OutcomeSucceeded) != 3 || report.Amount(OutcomeSucceeded) != 700 {
+		t.Fatalf("unexpected report after reconcile %s", report.Summary())
+	}
+	want := "batch b20240101: 4 recipients, amount 1000; succeeded 3, amount 700; rejected 1, amount 300"
+	if got := report.Summary(); got != want {
+		t.Errorf("Summary() = %q, want %q", got, want)
+	}
+	var buf bytes.Buffer
+	if err := report.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "k_4,u_flaky,400,b20240101_k_4,wt_b20240101_k_4,SUCCESS,succeeded,") {
+		t.Errorf("unexpected csv:\n%s", buf.String())
+	}
+}
+
+func TestRunnerRejectsInvalidRecipients(t *testing.T) {
+	// 默认码表下无法确认结果未知的提现，拒绝创建
+	if _, err := NewRunner("b1", testTemplate(""), filepath.Join(t.TempDir(), "b1.jsonl")); !errors.Is(err, util.ErrSubCodeNotRegistered) {
+		t.Fatalf("expected ErrSubCodeNotRegistered, got %v", err)
+	}
+	registerTestSubCodes(t)
+	runner, err := NewRunner("b1", testTemplate("http://127.0.0.1:0"), filepath.Join(t.TempDir(), "b1.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	recipients, err := ReadJSON(strings.NewReader(`[{"uid":"u_1","amount":100},{"uid":"u_1","amount":200}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runner.Run(context.Background(), recipients); err == nil || !strings.Contains(err.Error(), "duplicate") {
+		t.Fatalf("expected duplicate key error, got %v", err)
+	}
+	if _, err := NewRunner("batch_id_longer_than_16", testTemplate(""), filepath.Join(t.TempDir(), "x")); err == nil {
+		t.Fatal("expected batch id error")
+	}
+}
+
+func TestOutTradeNo(t *testing.T) {
+	if got := OutTradeNo("b1", "u_1"); got != "b1_u_1" {
+		t.Errorf("OutTradeNo = %q", got)
+	}
+	long := OutTradeNo("b1", strings.Repeat("x", 40))
+	if len(long) != 32 || !strings.HasPrefix(long, "b1_") || long != OutTradeNo("b1", strings.Repeat("x", 40)) {
+		t.Errorf("unexpected long OutTradeNo %q", long)
+	}
+}
+
+// 测试桩使用的sub_code，实际值以财经侧接口文档为准，由接入方通过util.RegisterSubCode收录
+func registerTestSubCodes(t *testing.T) {
+	t.Helper()
+	codes := map[string]util.Category{
+		"TP.WITHDRAW_NOT_EXIST": util.CategoryOrderNotExist,
+		"TP.ORDER_EXISTS":       util.CategoryDuplicateOrder,
+	}
+	for code, c := range codes {
+		util.RegisterSubCode(code, c)
+	}
+	t.Cleanup(func() {
+		for code := range codes {
+			util.UnregisterSubCode(code)
+		}
+	})
+}
@@ -0,0 +1,152 @@
+package tt_pay
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimit 为令牌桶限流参数
+type RateLimit struct {
+	QPS   float64 // 每秒补充的令牌数，<=0表示不限制
+	Burst int     // 桶容量，<=0时取QPS向上取整
+}
+
+type rateLimitKey struct {
+	merchantId string
+	method     string
+}
+
+var (
+	rateLimitLock sync.Mutex
+	rateLimits    = make(map[rateLimitKey]RateLimit)
+	rateBuckets   = make(map[rateLimitKey]*tokenBucket)
+)
+
+// SetRateLimit 设置客户端限流，Execute发出请求前会等待令牌，等待时长上报给MetricsHook（需实现ObserveLimiterWait）
+// method为空表示商户级限流，该商户所有方法共享一个令牌桶；否则为商户+方法级限流
+// merchantId为空表示默认规则，对未单独设置的商户生效，每个商户仍各自使用独立的令牌桶
+// 一次请求需同时通过商户级及方法级限流；limit.QPS<=0时删除该规则
+func SetRateLimit(merchantId, method string, limit RateLimit) {
+	rateLimitLock.Lock()
+	defer rateLimitLock.Unlock()
+	key := rateLimitKey{merchantId, method}
+	if limit.QPS <= 0 {
+		delete(rateLimits, key)
+	} else {
+		rateLimits[key] = limit
+	}
+	// 规则变化后重新创建令牌桶
+	rateBuckets = make(map[rateLimitKey]*tokenBucket)
+}
+
+// 限流等待观测接口，MetricsHook可选实现
+type limiterObserver interface {
+	ObserveLimiterWait(merchantId, method string, wait time.Duration)
+}
+
+// 等待merchantId、method对应的令牌，未配置限流时直接返回
+func waitRateLimit(ctx context.Context, merchantId, method string) error {
+	buckets := matchBuckets(merchantId, method)
+	if len(buckets) == 0 {
+		return nil
+	}
+	now := time.Now()
+	var wait time.Duration
+	for _, b := range buckets {
+		if d := b.reserve(now); d > wait {
+			wait = d
+		}
+	}
+	if observer, ok := metricsHook.(limiterObserver); ok {
+		observer.ObserveLimiterWait(merchantId, method, wait)
+	}
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		// 未发出的请求归还令牌
+		for _, b := range buckets {
+			b.cancel()
+		}
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// 返回请求需通过的令牌桶：商户级、商户+方法级
+func matchBuckets(merchantId, method string) []*tokenBucket {
+	rateLimitLock.Lock()
+	defer rateLimitLock.Unlock()
+	if len(rateLimits) == 0 {
+		return nil
+	}
+	methods := []string{""}
+	if method != "" {
+		methods = append(methods, method)
+	}
+	var ret []*tokenBucket
+	for _, m := range methods {
+		limit, ok := rateLimits[rateLimitKey{merchantId, m}]
+		if !ok {
+			limit, ok = rateLimits[rateLimitKey{"", m}]
+		}
+		if !ok {
+			continue
+		}
+		key := rateLimitKey{merchantId, m}
+		b, ok := rateBuckets[key]
+		if !ok {
+			b = newTokenBucket(limit)
+			rateBuckets[key] = b
+		}
+		ret = append(ret, b)
+	}
+	return ret
+}
+
+// 令牌桶，令牌数可以为负，表示已被预占的未来令牌
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit RateLimit) *tokenBucket {
+	burst := float64(limit.Burst)
+	if burst <= 0 {
+		burst = math.Ceil(limit.QPS)
+	}
+	return &tokenBucket{rate: limit.QPS, burst: burst, tokens: burst}
+}
+
+// 预占一个令牌，返回需要等待的时长
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.last.IsZero() && now.After(b.last) {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	if now.After(b.last) {
+		b.last = now
+	}
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// 归还预占的令牌
+func (b *tokenBucket) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Min(b.burst, b.tokens+1)
+}
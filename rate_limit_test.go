@@ -0,0 +1,80 @@
+package tt_pay
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/liaoxxxx/tt_pay/consts"
+)
+
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(RateLimit{QPS: 10, Burst: 2})
+	t0 := time.Unix(100, 0)
+	for i, want := range []time.Duration{0, 0, 100 * time.Millisecond, 200 * time.Millisecond} {
+		if got := b.reserve(t0); got != want {
+			t.Errorf("reserve %d: got %v, want %v", i, got, want)
+		}
+	}
+	b.cancel()
+	b.cancel()
+	// 300ms后补充3个令牌，归还2个后余额为1
+	if got := b.reserve(t0.Add(300 * time.Millisecond)); got != 0 {
+		t.Errorf("got %v", got)
+	}
+	if got := b.reserve(t0.Add(300 * time.Millisecond)); got != 0 {
+		t.Errorf("got %v", got)
+	}
+	if got := b.reserve(t0.Add(300 * time.Millisecond)); got != 100*time.Millisecond {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	hook := new(fakeMetricsHook)
+	SetMetricsHook(hook)
+	defer SetMetricsHook(nil)
+	SetRateLimit("", consts.MethodTradeQuery, RateLimit{QPS: 20, Burst: 1})
+	defer SetRateLimit("", consts.MethodTradeQuery, RateLimit{})
+
+	ts := newStubGateway(t, `{"response":{"code":"10000","msg":"Success","out_order_no":"order_1"}}`)
+	query := func(ctx context.Context, merchantId string) error {
+		config := testConfig(ts.URL)
+		config.MerchantId = merchantId
+		req := NewTradeQueryRequest(config)
+		req.Uid = testUid
+		req.OutOrderNo = "order_1"
+		_, err := TradeQuery(ctx, req)
+		return err
+	}
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := query(context.Background(), "merchant_1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("rate limit not applied, took %v", elapsed)
+	}
+	// 每个商户使用独立的令牌桶
+	if err := query(context.Background(), "merchant_2"); err != nil {
+		t.Fatal(err)
+	}
+	if len(hook.waits) != 4 || hook.waits[0] != 0 || hook.waits[1] <= 0 || hook.waits[3] != 0 {
+		t.Errorf("unexpected waits %v", hook.waits)
+	}
+
+	// 等待令牌时取消，请求不发出
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	query(context.Background(), "merchant_3")
+	requests := len(hook.requests)
+	if err := query(ctx, "merchant_3"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected DeadlineExceeded, got %v", err)
+	}
+	if len(hook.requests) != requests {
+		t.Errorf("canceled request must not be observed")
+	}
+}
@@ -2,24 +2,35 @@ package tt_pay
 
 import (
 	"context"
-	"errors"
 	"net/url"
 
 	"github.com/liaoxxxx/tt_pay/consts"
+	"github.com/liaoxxxx/tt_pay/store"
 	"github.com/liaoxxxx/tt_pay/util"
 )
 
 // 退款回调请求
 type RefundNotifyRequest struct {
-	Param string
+	Param     string
+	PublicKey string // 验签公钥，为空时使用consts.TtPayPublicKey
 }
 
 // 退款回调接口
 func RefundNotify(ctx context.Context, req *RefundNotifyRequest) (*RefundNotifyResponse, error) {
+	ctx, span := tracer.Start(ctx, spanNotify)
+	resp, err := refundNotify(ctx, req)
+	if err == nil {
+		recordOrder(ctx, resp.storeOrder(), store.SourceNotify)
+	}
+	finishNotify(span, consts.NotifyTypeRefund, resp, err)
+	return resp, err
+}
+
+func refundNotify(ctx context.Context, req *RefundNotifyRequest) (*RefundNotifyResponse, error) {
 	params, err := url.ParseQuery(req.Param)
 
 	if err != nil {
-		util.Debug("RefundNotify failed: params: [%s] err: [%s]", req.Param, err)
+		util.Debug("RefundNotify failed: params: [%s] err: [%s]", util.RedactForm(req.Param), err)
 		return nil, util.Wrap(err, "RefundNotify failed when [ParseQuery()]")
 	}
 
@@ -36,8 +47,8 @@ func RefundNotify(ctx context.Context, req *RefundNotifyRequest) (*RefundNotifyR
 
 	sign := resp.Get("sign")
 
-	if valid := util.VerifyMd5WithRsa(signMap, sign, consts.TtPayPublicKey); !valid {
-		return nil, errors.New("Invalid sign")
+	if valid := util.VerifyMd5WithRsa(signMap, sign, notifyPublicKey(req.PublicKey)); !valid {
+		return nil, util.ErrInvalidSign
 	}
 
 	return resp, nil
@@ -59,7 +70,7 @@ type RefundNotifyResponse struct {
 	OutRefundNo  string
 	RefundNo     string
 	RefundAmount string
-	RefundTime   string
+	RefundTime   GatewayTime
 	MerchantId   string
 	RefundStatus string
 }
@@ -74,7 +85,8 @@ func (resp *RefundNotifyResponse) Decode() {
 	resp.OutRefundNo = resp.Get("out_refund_no")
 	resp.RefundNo = resp.Get("refund_no")
 	resp.RefundAmount = resp.Get("refund_amount")
-	resp.RefundTime = resp.Get("refund_time")
+	// 格式无法识别时为零值，原始值可通过Get获取
+	resp.RefundTime, _ = ParseGatewayTime(resp.Get("refund_time"))
 	resp.MerchantId = resp.Get("merchant_id")
 	resp.RefundStatus = resp.Get("refund_status")
 }
@@ -83,3 +95,22 @@ func (resp *RefundNotifyResponse) Decode() {
 func (resp *RefundNotifyResponse) Get(key string) string {
 	return resp.Param[key]
 }
+
+// 订单号，用于链路追踪
+func (resp *RefundNotifyResponse) orderAttributes() map[string]string {
+	return map[string]string{
+		"out_refund_no": resp.OutRefundNo,
+	}
+}
+
+// 订单存储记录
+func (resp *RefundNotifyResponse) storeOrder() *store.Order {
+	return &store.Order{
+		Kind:       store.KindRefund,
+		MerchantId: resp.MerchantId,
+		OutNo:      resp.OutRefundNo,
+		TradeNo:    resp.RefundNo,
+		Amount:     parseAmount(resp.RefundAmount),
+		Status:     resp.RefundStatus,
+	}
+}
@@ -0,0 +1,262 @@
+package tt_pay
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/bitly/go-simplejson"
+
+	"github.com/liaoxxxx/tt_pay/config"
+	"github.com/liaoxxxx/tt_pay/consts"
+	"github.com/liaoxxxx/tt_pay/store"
+	"github.com/liaoxxxx/tt_pay/util"
+)
+
+// ErrRefundAmountExceed 退款金额超过订单可退余额
+var ErrRefundAmountExceed = errors.New("tt_pay: refund amount exceeds refundable balance")
+
+// ErrRefundsUnknown 既无法从存储列出已有退款、也未传入out_refund_no时返回
+// 注意未返回该错误不代表退款列表完整：存储只含经本SDK记录的退款，其他途径发起的退款需由调用方传入
+var ErrRefundsUnknown = errors.New("tt_pay: prior refunds cannot be listed")
+
+// ErrTradeNotPaid 订单未支付成功，不能退款
+var ErrTradeNotPaid = errors.New("tt_pay: trade is not paid")
+
+// RefundRecord 为订单已有的一笔退款
+type RefundRecord struct {
+	OutRefundNo string
+	RefundNo    string
+	Amount      int64
+	Status      string
+}
+
+// RefundBalance 为订单的退款余额
+type RefundBalance struct {
+	OutOrderNo  string
+	TradeNo     string
+	TradeStatus string
+	TotalAmount int64
+	RealAmount  int64 // 实付金额，为可退上限
+	Refunded    int64 // 已成功退款金额
+	Pending     int64 // 处理中的退款金额，计入已占用
+	Refunds     []RefundRecord
+}
+
+// Refundable 返回剩余可退金额
+func (b *RefundBalance) Refundable() int64 {
+	n := b.RealAmount - b.Refunded - b.Pending
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// RefundPlanner 在本地计算订单的可退余额，拒绝超额退款，并按单笔上限拆分退款
+// 已有退款来自调用方传入的out_refund_no，以及SetOrderStore配置的存储（需实现store.RefundLister）
+// 存储按原订单号列出退款：按trade_no申请的退款在RefundCreate时通过TradeQuery补全原订单号，补全失败则列不出；
+// 未经本SDK发起的退款（如商户后台退款）存储中没有，需调用方通过out_refund_no传入，否则可退余额偏大
+type RefundPlanner struct {
+	config          config.Config
+	maxRefundAmount int64
+	outRefundNo     func(outOrderNo string, seq int) string
+}
+
+// NewRefundPlanner 初始化RefundPlanner，退款不存在的sub_code未收录时返回util.ErrSubCodeNotRegistered
+// 否则不存在的退款会被当作查询失败
+func NewRefundPlanner(config config.Config) (*RefundPlanner, error) {
+	if err := util.RequireCategories(util.CategoryOrderNotExist); err != nil {
+		return nil, util.Wrap(err, "NewRefundPlanner failed when [RequireCategories()]")
+	}
+	return &RefundPlanner{
+		config:      config,
+		outRefundNo: defaultOutRefundNo,
+	}, nil
+}
+
+// SetMaxRefundAmount 设置单笔退款上限，超过时拆分为多笔，0表示不拆分
+func (p *RefundPlanner) SetMaxRefundAmount(n int64) {
+	p.maxRefundAmount = n
+}
+
+// SetOutRefundNoFunc 设置拆分退款时out_refund_no的生成方式，seq从1开始，生成结果需满足out_refund_no的格式
+func (p *RefundPlanner) SetOutRefundNoFunc(f func(outOrderNo string, seq int) string) {
+	p.outRefundNo = f
+}
+
+// 默认为原订单号加序号，超长时用原订单号的md5代替
+func defaultOutRefundNo(outOrderNo string, seq int) string {
+	suffix := fmt.Sprintf("R%d", seq)
+	if len(outOrderNo)+len(suffix) <= 32 {
+		return outOrderNo + suffix
+	}
+	sum := md5.Sum([]byte(outOrderNo))
+	return hex.EncodeToString(sum[:])[:32-len(suffix)] + suffix
+}
+
+// Balance 查询订单及其已有退款，计算可退余额
+// 订单通过TradeQuery查询；退款优先使用存储中的终态，其余通过RefundQuery确认，不存在的退款不计入
+// 存储未实现store.RefundLister且未传入outRefundNos时无法得知已有退款，返回ErrRefundsUnknown；
+// 其他情况下结果只包含存储与outRefundNos中的退款，完整性由调用方保证
+func (p *RefundPlanner) Balance(ctx context.Context, uid, outOrderNo string, outRefundNos ...string) (*RefundBalance, error) {
+	lister, ok := orderStore.(store.RefundLister)
+	if !ok && len(outRefundNos) == 0 {
+		return nil, ErrRefundsUnknown
+	}
+	tradeReq := NewTradeQueryRequest(p.config)
+	tradeReq.Uid = uid
+	tradeReq.OutOrderNo = outOrderNo
+	trade, err := TradeQuery(ctx, tradeReq)
+	if err != nil {
+		return nil, err
+	}
+	b := &RefundBalance{
+		OutOrderNo:  firstNonEmpty(trade.OutOrderNo, outOrderNo),
+		TradeNo:     trade.TradeNo,
+		TradeStatus: trade.TradeStatus,
+		TotalAmount: parseAmount(trade.TotalAmount),
+		RealAmount:  parseAmount(trade.RealAmount),
+	}
+	if b.RealAmount == 0 {
+		b.RealAmount = b.TotalAmount
+	}
+
+	known := make(map[string]*store.Order)
+	var order []string
+	if lister != nil {
+		refunds, err := lister.Refunds(ctx, p.config.MerchantId, b.OutOrderNo)
+		if err != nil {
+			return nil, util.Wrap(err, "RefundPlanner.Balance failed when [RefundLister.Refunds()]")
+		}
+		for _, o := range refunds {
+			known[o.OutNo] = o
+			order = append(order, o.OutNo)
+		}
+	}
+	for _, no := range outRefundNos {
+		if _, ok := known[no]; !ok {
+			order = append(order, no)
+		}
+		// 调用方显式传入的退款总是重新查询
+		known[no] = nil
+	}
+
+	for _, no := range order {
+		r, err := p.refund(ctx, uid, no, known[no])
+		if err != nil {
+			return nil, err
+		}
+		if r == nil {
+			continue
+		}
+		switch r.Status {
+		case consts.RefundStatusSuccess:
+			b.Refunded += r.Amount
+		case consts.RefundStatusFail:
+		default:
+			b.Pending += r.Amount
+		}
+		b.Refunds = append(b.Refunds, *r)
+	}
+	return b, nil
+}
+
+// 查询一笔退款，存储中已是终态时直接使用，退款不存在时返回nil
+func (p *RefundPlanner) refund(ctx context.Context, uid, outRefundNo string, stored *store.Order) (*RefundRecord, error) {
+	if stored != nil && (stored.Status == consts.RefundStatusSuccess || stored.Status == consts.RefundStatusFail) {
+		return &RefundRecord{OutRefundNo: stored.OutNo, RefundNo: stored.TradeNo, Amount: stored.Amount, Status: stored.Status}, nil
+	}
+	req := NewRefundQueryRequest(p.config)
+	req.Uid = uid
+	req.OutRefundNo = outRefundNo
+	resp, err := RefundQuery(ctx, req)
+	if errors.Is(err, util.ErrOrderNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &RefundRecord{
+		OutRefundNo: firstNonEmpty(resp.OutRefundNo, outRefundNo),
+		RefundNo:    resp.RefundNo,
+		Amount:      parseAmount(resp.RefundAmount),
+		Status:      resp.RefundStatus,
+	}, nil
+}
+
+// Plan 校验订单已支付成功且req.RefundAmount不超过可退余额，并按单笔上限拆分为多笔退款申请
+// req为模板，需设置Uid、OutOrderNo、RefundAmount及NotifyUrl、RiskInfo等参数；
+// 不拆分且设置了OutRefundNo时沿用，否则按SetOutRefundNoFunc生成并跳过已有的单号
+// 返回的请求依次调用RefundCreate即可，建议配合idempotency包使用
+func (p *RefundPlanner) Plan(ctx context.Context, req *RefundCreateRequest, outRefundNos ...string) ([]*RefundCreateRequest, *RefundBalance, error) {
+	if err := util.CheckRefundAmount(req.RefundAmount); err != nil {
+		return nil, nil, err
+	}
+	b, err := p.Balance(ctx, req.Uid, req.OutOrderNo, outRefundNos...)
+	if err != nil {
+		return nil, nil, err
+	}
+	if b.TradeStatus != consts.TradeStatusSuccess {
+		return nil, b, fmt.Errorf("%w: trade_status %s", ErrTradeNotPaid, b.TradeStatus)
+	}
+	amount := int64(req.RefundAmount)
+	if refundable := b.Refundable(); amount > refundable {
+		return nil, b, fmt.Errorf("%w: requested %d, refundable %d", ErrRefundAmountExceed, amount, refundable)
+	}
+
+	amounts := splitAmount(amount, p.maxRefundAmount)
+	if len(amounts) == 1 && req.OutRefundNo != "" {
+		return []*RefundCreateRequest{req.withAmount(req.OutRefundNo, amount)}, b, nil
+	}
+	used := make(map[string]bool, len(b.Refunds)+len(outRefundNos))
+	for _, r := range b.Refunds {
+		used[r.OutRefundNo] = true
+	}
+	for _, no := range outRefundNos {
+		used[no] = true
+	}
+	ret := make([]*RefundCreateRequest, 0, len(amounts))
+	seq := len(b.Refunds)
+	for _, n := range amounts {
+		var no string
+		for {
+			seq++
+			if no = p.outRefundNo(b.OutOrderNo, seq); !used[no] {
+				break
+			}
+		}
+		used[no] = true
+		ret = append(ret, req.withAmount(no, n))
+	}
+	return ret, b, nil
+}
+
+// 按单笔上限拆分金额，max为0时不拆分
+func splitAmount(amount, max int64) []int64 {
+	if max <= 0 || amount <= max {
+		return []int64{amount}
+	}
+	ret := make([]int64, 0, (amount+max-1)/max)
+	for amount > max {
+		ret = append(ret, max)
+		amount -= max
+	}
+	return append(ret, amount)
+}
+
+// 复制请求并设置单号与金额，bizContent单独复制以免互相影响
+func (req *RefundCreateRequest) withAmount(outRefundNo string, amount int64) *RefundCreateRequest {
+	ret := *req
+	ret.OutRefundNo = outRefundNo
+	ret.RefundAmount = int(amount)
+	ret.Timestamp = fmt.Sprintf("%d", Now().Unix())
+	ret.bizContent = simplejson.New()
+	if m, err := req.bizContent.Map(); err == nil {
+		for k, v := range m {
+			ret.bizContent.Set(k, v)
+		}
+	}
+	return &ret
+}
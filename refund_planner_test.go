@@ -0,0 +1,214 @@
+package tt_pay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/liaoxxxx/tt_pay/consts"
+	"github.com/liaoxxxx/tt_pay/store"
+	"github.com/liaoxxxx/tt_pay/util"
+)
+
+const refundNotExistBody = `{"response":{"code":"40004","msg":"Business Failed","sub_code":"TP.REFUND_NOT_EXIST"}}`
+
+// 启动本地网关桩，按"method:单号"返回body，未配置的退款单返回不存在
+func newRoutedGateway(t *testing.T, bodies map[string]string) (*httptest.Server, map[string]int) {
+	t.Helper()
+	calls := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var biz map[string]interface{}
+		json.Unmarshal([]byte(r.FormValue("biz_content")), &biz)
+		no, _ := biz["out_refund_no"].(string)
+		if no == "" {
+			no, _ = biz["out_order_no"].(string)
+		}
+		if no == "" {
+			no, _ = biz["out_trade_no"].(string)
+		}
+		if no == "" {
+			no, _ = biz["trade_no"].(string)
+		}
+		key := r.FormValue("method") + ":" + no
+		calls[key]++
+		body, ok := bodies[key]
+		if !ok {
+			body = refundNotExistBody
+		}
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(ts.Close)
+	return ts, calls
+}
+
+func newPlannerGateway(t *testing.T) (*httptest.Server, map[string]int) {
+	return newRoutedGateway(t, map[string]string{
+		consts.MethodTradeQuery + ":order_1": `{"response":{"code":"10000","msg":"Success","out_order_no":"order_1",` +
+			`"trade_no":"t_1","total_amount":"1000","real_amount":"900","trade_status":"SUCCESS"}}`,
+		consts.MethodRefundQuery + ":order_1R1": `{"response":{"code":"10000","msg":"Success","out_refund_no":"order_1R1",` +
+			`"refund_no":"r_1","refund_amount":"300","refund_status":"PROCESSING"}}`,
+	})
+}
+
+func newTestPlanner(t *testing.T, domain string) *RefundPlanner {
+	t.Helper()
+	registerTestSubCodes(t)
+	p, err := NewRefundPlanner(testConfig(domain))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func testRefundTemplate(domain string, amount int) *RefundCreateRequest {
+	req := NewRefundCreateRequest(testConfig(domain))
+	req.Uid = testUid
+	req.OutOrderNo = "order_1"
+	req.RefundAmount = amount
+	req.NotifyUrl = "https://example.com/notify"
+	req.RiskInfo = `{"ip":"` + testIp + `"}`
+	return req
+}
+
+func TestRefundPlannerBalance(t *testing.T) {
+	registerTestSubCodes(t)
+	s := store.NewMemoryStore()
+	SetOrderStore(s)
+	defer SetOrderStore(nil)
+	ctx := context.Background()
+	// 存储中的终态退款不再查询
+	s.Record(ctx, &store.Order{Kind: store.KindRefund, MerchantId: "merchant_1", OutNo: "refund_0",
+		OutOrderNo: "order_1", Amount: 200, Status: consts.RefundStatusSuccess}, store.SourceNotify)
+	s.Record(ctx, &store.Order{Kind: store.KindRefund, MerchantId: "merchant_1", OutNo: "refund_x",
+		OutOrderNo: "order_1", Amount: 500, Status: consts.RefundStatusFail}, store.SourceNotify)
+
+	ts, calls := newPlannerGateway(t)
+	b, err := newTestPlanner(t, ts.URL).Balance(ctx, testUid, "order_1", "order_1R1", "refund_lost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.RealAmount != 900 || b.Refunded != 200 || b.Pending != 300 || b.Refundable() != 400 || len(b.Refunds) != 3 {
+		t.Errorf("unexpected balance %+v", b)
+	}
+	if calls[consts.MethodRefundQuery+":refund_0"] != 0 || calls[consts.MethodRefundQuery+":refund_lost"] != 1 {
+		t.Errorf("unexpected calls %v", calls)
+	}
+}
+
+func TestRefundPlannerBalanceByTradeNo(t *testing.T) {
+	registerTestSubCodes(t)
+	ts, calls := newRoutedGateway(t, map[string]string{
+		consts.MethodRefundCreate + ":refund_t": `{"response":{"code":"10000","msg":"Success","out_refund_no":"refund_t","refund_no":"r_t"}}`,
+		consts.MethodTradeQuery + ":t_1": `{"response":{"code":"10000","msg":"Success","out_order_no":"order_1",` +
+			`"trade_no":"t_1","total_amount":"1000","real_amount":"900","trade_status":"SUCCESS"}}`,
+		consts.MethodTradeQuery + ":order_1": `{"response":{"code":"10000","msg":"Success","out_order_no":"order_1",` +
+			`"trade_no":"t_1","total_amount":"1000","real_amount":"900","trade_status":"SUCCESS"}}`,
+		consts.MethodRefundQuery + ":refund_t": `{"response":{"code":"10000","msg":"Success","out_refund_no":"refund_t",` +
+			`"refund_no":"r_t","refund_amount":"300","refund_status":"SUCCESS"}}`,
+	})
+	SetOrderStore(store.NewMemoryStore())
+	defer SetOrderStore(nil)
+	ctx := context.Background()
+
+	// 按trade_no申请的退款补全原订单号后可被列出
+	req := testRefundTemplate(ts.URL, 300)
+	req.OutOrderNo = ""
+	req.TradeNo = "t_1"
+	req.OutRefundNo = "refund_t"
+	if _, err := RefundCreate(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	b, err := newTestPlanner(t, ts.URL).Balance(ctx, testUid, "order_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Refunded != 300 || b.Refundable() != 600 || len(b.Refunds) != 1 {
+		t.Errorf("unexpected balance %+v", b)
+	}
+	if calls[consts.MethodTradeQuery+":t_1"] != 1 {
+		t.Errorf("unexpected calls %v", calls)
+	}
+}
+
+func TestRefundPlannerPlan(t *testing.T) {
+	ts, _ := newPlannerGateway(t)
+	ctx := context.Background()
+	p := newTestPlanner(t, ts.URL)
+
+	if _, _, err := p.Plan(ctx, testRefundTemplate(ts.URL, 601), "order_1R1"); !errors.Is(err, ErrRefundAmountExceed) {
+		t.Fatalf("expected ErrRefundAmountExceed, got %v", err)
+	}
+
+	p.SetMaxRefundAmount(250)
+	tmpl := testRefundTemplate(ts.URL, 600)
+	tmpl.SetBizContentKV("extra", "v")
+	reqs, b, err := p.Plan(ctx, tmpl, "order_1R1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Refundable() != 600 {
+		t.Errorf("unexpected refundable %d", b.Refundable())
+	}
+	want := []struct {
+		outRefundNo string
+		amount      int
+	}{{"order_1R2", 250}, {"order_1R3", 250}, {"order_1R4", 100}}
+	if len(reqs) != len(want) {
+		t.Fatalf("expected %d requests, got %d", len(want), len(reqs))
+	}
+	for i, w := range want {
+		if reqs[i].OutRefundNo != w.outRefundNo || reqs[i].RefundAmount != w.amount {
+			t.Errorf("request %d: got %s %d", i, reqs[i].OutRefundNo, reqs[i].RefundAmount)
+		}
+		if err := reqs[i].checkParams(); err != nil {
+			t.Errorf("request %d: %v", i, err)
+		}
+		if reqs[i].bizContent == tmpl.bizContent || reqs[i].bizContent.Get("extra").MustString() != "v" {
+			t.Errorf("request %d: bizContent must be copied", i)
+		}
+	}
+}
+
+func TestDefaultOutRefundNo(t *testing.T) {
+	if got := defaultOutRefundNo("order_1", 2); got != "order_1R2" {
+		t.Errorf("got %s", got)
+	}
+	long := "o1234567890123456789012345678901"
+	if got := defaultOutRefundNo(long, 12); len(got) != 32 || got == defaultOutRefundNo(long+"x", 12) {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestRefundPlannerRefusals(t *testing.T) {
+	ts, calls := newRoutedGateway(t, map[string]string{
+		consts.MethodTradeQuery + ":order_2": `{"response":{"code":"10000","msg":"Success","out_order_no":"order_2",` +
+			`"trade_no":"t_2","total_amount":"1000","trade_status":"PROCESSING"}}`,
+	})
+	ctx := context.Background()
+	p := newTestPlanner(t, ts.URL)
+
+	// 无法列出已有退款且未显式传入时拒绝计算
+	if _, err := p.Balance(ctx, testUid, "order_2"); !errors.Is(err, ErrRefundsUnknown) {
+		t.Fatalf("expected ErrRefundsUnknown, got %v", err)
+	}
+	if calls[consts.MethodTradeQuery+":order_2"] != 0 {
+		t.Errorf("unexpected calls %v", calls)
+	}
+
+	SetOrderStore(store.NewMemoryStore())
+	defer SetOrderStore(nil)
+	tmpl := testRefundTemplate(ts.URL, 100)
+	tmpl.OutOrderNo = "order_2"
+	if _, _, err := p.Plan(ctx, tmpl); !errors.Is(err, ErrTradeNotPaid) {
+		t.Fatalf("expected ErrTradeNotPaid, got %v", err)
+	}
+}
+
+func TestNewRefundPlannerRequiresSubCodes(t *testing.T) {
+	if _, err := NewRefundPlanner(testConfig("")); !errors.Is(err, util.ErrSubCodeNotRegistered) {
+		t.Fatalf("expected ErrSubCodeNotRegistered, got %v", err)
+	}
+}
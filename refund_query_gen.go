@@ -0,0 +1,192 @@
+// Code generated by ttpaygen from schema/tp.refund.query.json. DO NOT EDIT.
+
+package tt_pay
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/bitly/go-simplejson"
+
+	"github.com/liaoxxxx/tt_pay/config"
+	"github.com/liaoxxxx/tt_pay/consts"
+	"github.com/liaoxxxx/tt_pay/util"
+)
+
+// 退款查询Request
+type RefundQueryRequest struct {
+	config.Config
+	Method      string           `ttpay:"eq=tp.refund.query"`
+	Format      string           `ttpay:"eq=JSON"`
+	Charset     string           `ttpay:"eq=utf-8"`
+	SignType    string           `ttpay:"eq=MD5"`
+	Timestamp   string           `ttpay:"number"`
+	Version     string           `ttpay:"version"`
+	bizContent  *simplejson.Json `ttpay:"nonnil"`
+	path        string
+	Uid         string `ttpay:"id,max=32"`
+	OutRefundNo string `ttpay:"oneof=OutRefundNo|RefundNo,omitempty,id,max=32"`
+	RefundNo    string `ttpay:"omitempty,id,max=64"`
+}
+
+// New函数内赋默认值，目前含默认值（或仅支持一个值的）参数包括：
+// Version = "1.0"
+// SignType = "MD5"
+// Format = "JSON"
+// Charset = "utf-8"
+// Path = "gateway"，可通过SetPath改为"gateway-u"
+// Config.TPDomain = "https://tp-pay.snssdk.com"（未配置TPDomains时）
+// Method = "tp.refund.query"
+// Timestamp 自动设置为当前Unix时间戳，时间来源可通过SetClock替换
+// 另外，注意初始化bizContent，以免出现nil指针错误
+func NewRefundQueryRequest(config config.Config) *RefundQueryRequest {
+	ret := new(RefundQueryRequest)
+	ret.Config = config
+	ret.Version = "1.0"
+	ret.SignType = "MD5"
+	ret.Format = "JSON"
+	ret.Charset = "utf-8"
+	ret.path = consts.TPPath
+	if len(ret.Config.TPDomain) == 0 && len(ret.Config.TPDomains) == 0 {
+		ret.Config.TPDomain = consts.TPDomain
+	}
+	ret.Method = consts.MethodRefundQuery
+	ret.Timestamp = fmt.Sprintf("%d", Now().Unix())
+	ret.bizContent = simplejson.New()
+	return ret
+}
+
+// 将Request编码成POST请求的Body
+func (req *RefundQueryRequest) Encode() (string, error) {
+	bizContent, err := req.encodeBizContent()
+	if err != nil {
+		return "", err
+	}
+	return encodeGatewayForm(req.gatewayParams(), bizContent), nil
+}
+
+// 编码biz_content
+func (req *RefundQueryRequest) encodeBizContent() (string, error) {
+	req.bizContent.Set("out_refund_no", req.OutRefundNo)
+	req.bizContent.Set("refund_no", req.RefundNo)
+	req.bizContent.Set("merchant_id", req.MerchantId)
+	req.bizContent.Set("uid", req.Uid)
+
+	bizContentBytes, err := req.bizContent.Encode()
+	if err != nil {
+		util.Debug("RefundQueryRequest Encode bizContent.Encode err: %s, bizContent %v\n", err, util.RedactMap(req.bizContent.MustMap()))
+		return "", util.Wrap(err, "RefundQueryRequest Encode failed when [bizContent.Encode()]")
+	}
+
+	return string(bizContentBytes), nil
+}
+
+// 网关公共参数
+func (req *RefundQueryRequest) gatewayParams() gatewayParams {
+	return gatewayParams{
+		AppId:     req.Config.AppId,
+		AppSecret: req.Config.AppSecret,
+		Method:    req.Method,
+		Format:    req.Format,
+		Charset:   req.Charset,
+		SignType:  req.SignType,
+		Timestamp: req.Timestamp,
+		Version:   req.Version,
+	}
+}
+
+// 生成该次请求logid
+// OutRefundNo、RefundNo哪个不空用哪个，都不空时优先用靠前的
+func (req *RefundQueryRequest) GetLogId() string {
+	id := req.OutRefundNo
+	if len(id) == 0 {
+		id = req.RefundNo
+	}
+	return fmt.Sprintf("%s_%s_%s_%s", req.Config.AppId, req.Config.MerchantId, id, req.Timestamp)
+}
+
+// 获取请求url地址，配置多个域名时使用当前可用的域名
+func (req *RefundQueryRequest) GetUrl() string {
+	return ActiveDomain(req.Config) + "/" + req.path
+}
+
+// 获取请求路径，切换域名时与各域名拼接
+func (req *RefundQueryRequest) GetPath() string {
+	return req.path
+}
+
+// 设置请求路径，可选consts.TPPath（默认）或consts.TPPathU
+// 两者加签方式相同，响应的解析见Decode
+func (req *RefundQueryRequest) SetPath(path string) {
+	req.path = path
+}
+
+// 获取接口方法名
+func (req *RefundQueryRequest) GetMethod() string {
+	return req.Method
+}
+
+// 订单号，用于链路追踪
+func (req *RefundQueryRequest) orderAttributes() map[string]string {
+	return map[string]string{
+		"out_refund_no": req.OutRefundNo,
+	}
+}
+
+// 输出请求参数，AppSecret已脱敏
+func (req *RefundQueryRequest) String() string {
+	return formatRequest(req)
+}
+
+// 用于%#v输出，AppSecret已脱敏
+func (req *RefundQueryRequest) GoString() string {
+	return formatRequest(req)
+}
+
+// 提供该接口，方便业务方设置可选参数，比如product_code、payment_type等
+func (req *RefundQueryRequest) SetBizContentKV(key string, val interface{}) {
+	req.bizContent.Set(key, val)
+}
+
+// 退款查询响应
+type RefundQueryResponse struct {
+	Data         *simplejson.Json
+	OutRefundNo  string `json:"out_refund_no"`
+	RefundNo     string `json:"refund_no"`
+	TradeNo      string `json:"trade_no"`
+	RefundAmount string `json:"refund_amount"`
+	RefundStatus string `json:"refund_status"`
+	ChannelExt   string `json:"channel_ext"`
+}
+
+// 初始化退款查询响应
+func NewRefundQueryResponse() *RefundQueryResponse {
+	ret := new(RefundQueryResponse)
+	ret.Data = simplejson.New()
+	return ret
+}
+
+// 将响应json数据反序列化为对应接口
+func (resp *RefundQueryResponse) Decode() error {
+	var respBytes []byte
+	var err error
+	// 走网关的接口拿到的参数在response里，否则（如gateway-u）在data里
+	switch resp.Data.Get("response").Interface() {
+	case nil:
+		respBytes, err = resp.Data.Get("data").Encode()
+	default:
+		respBytes, err = resp.Data.Get("response").Encode()
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(respBytes, resp); err != nil {
+		return err
+	}
+	return nil
+}
+
+// 设置原始响应
+func (resp *RefundQueryResponse) SetData(data *simplejson.Json) {
+	resp.Data = data
+}
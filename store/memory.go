@@ -0,0 +1,102 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+type orderKey struct {
+	kind       Kind
+	merchantId string
+	outNo      string
+}
+
+// MemoryStore 为内存实现，进程重启后数据丢失，适用于测试及单机场景
+type MemoryStore struct {
+	mu      sync.RWMutex
+	orders  map[orderKey]*Order
+	history map[orderKey][]Transition
+	now     func() time.Time
+}
+
+// NewMemoryStore 初始化MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		orders:  make(map[orderKey]*Order),
+		history: make(map[orderKey][]Transition),
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryStore) Record(ctx context.Context, o *Order, source string) error {
+	if err := checkKey(o); err != nil {
+		return err
+	}
+	key := orderKey{o.Kind, o.MerchantId, o.OutNo}
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cur, ok := s.orders[key]
+	if !ok {
+		cur = &Order{Kind: o.Kind, MerchantId: o.MerchantId, OutNo: o.OutNo, CreatedAt: now}
+		s.orders[key] = cur
+	}
+	from := cur.Status
+	if merge(cur, o) {
+		s.history[key] = append(s.history[key], Transition{
+			Kind:       o.Kind,
+			MerchantId: o.MerchantId,
+			OutNo:      o.OutNo,
+			From:       from,
+			To:         cur.Status,
+			Source:     source,
+			At:         now,
+		})
+	}
+	cur.UpdatedAt = now
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, kind Kind, merchantId, outNo string) (*Order, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cur, ok := s.orders[orderKey{kind, merchantId, outNo}]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	ret := *cur
+	return &ret, nil
+}
+
+func (s *MemoryStore) History(ctx context.Context, kind Kind, merchantId, outNo string) ([]Transition, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key := orderKey{kind, merchantId, outNo}
+	if _, ok := s.orders[key]; !ok {
+		return nil, ErrNotFound
+	}
+	return append([]Transition(nil), s.history[key]...), nil
+}
+
+func (s *MemoryStore) Refunds(ctx context.Context, merchantId, outOrderNo string) ([]*Order, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var ret []*Order
+	for key, cur := range s.orders {
+		if key.kind != KindRefund || key.merchantId != merchantId || cur.OutOrderNo != outOrderNo {
+			continue
+		}
+		o := *cur
+		ret = append(ret, &o)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if !ret[i].CreatedAt.Equal(ret[j].CreatedAt) {
+			return ret[i].CreatedAt.Before(ret[j].CreatedAt)
+		}
+		return ret[i].OutNo < ret[j].OutNo
+	})
+	return ret, nil
+}
@@ -0,0 +1,267 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Dialect 为数据库方言，目前只影响占位符
+type Dialect string
+
+const (
+	DialectMySQL    Dialect = "mysql"
+	DialectSQLite   Dialect = "sqlite"
+	DialectPostgres Dialect = "postgres"
+)
+
+// 建表语句，也可以由DBA按需调整后手动执行
+// 时间字段保存为Unix纳秒
+var sqlSchema = []string{
+	`CREATE TABLE IF NOT EXISTS tt_pay_orders (
+	kind VARCHAR(16) NOT NULL,
+	merchant_id VARCHAR(64) NOT NULL,
+	out_no VARCHAR(64) NOT NULL,
+	trade_no VARCHAR(64) NOT NULL DEFAULT '',
+	out_order_no VARCHAR(64) NOT NULL DEFAULT '',
+	uid VARCHAR(64) NOT NULL DEFAULT '',
+	amount BIGINT NOT NULL DEFAULT 0,
+	currency VARCHAR(16) NOT NULL DEFAULT '',
+	status VARCHAR(32) NOT NULL DEFAULT '',
+	created_at BIGINT NOT NULL,
+	updated_at BIGINT NOT NULL,
+	PRIMARY KEY (kind, merchant_id, out_no)
+)`,
+	`CREATE TABLE IF NOT EXISTS tt_pay_order_history (
+	kind VARCHAR(16) NOT NULL,
+	merchant_id VARCHAR(64) NOT NULL,
+	out_no VARCHAR(64) NOT NULL,
+	seq INTEGER NOT NULL,
+	from_status VARCHAR(32) NOT NULL DEFAULT '',
+	to_status VARCHAR(32) NOT NULL,
+	source VARCHAR(16) NOT NULL DEFAULT '',
+	created_at BIGINT NOT NULL,
+	PRIMARY KEY (kind, merchant_id, out_no, seq)
+)`,
+}
+
+// SQLStore 为database/sql实现，表结构见Migrate
+type SQLStore struct {
+	db      *sql.DB
+	dialect Dialect
+	now     func() time.Time
+}
+
+// NewSQLStore 初始化SQLStore，db的驱动由调用方引入
+func NewSQLStore(db *sql.DB, dialect Dialect) *SQLStore {
+	return &SQLStore{db: db, dialect: dialect, now: time.Now}
+}
+
+// Migrate 创建所需的表，表已存在时不做修改
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	for _, stmt := range sqlSchema {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("store: migrate: %w", err)
+		}
+	}
+	return nil
+}
+
+// Rebind 将?替换为该方言的占位符
+func (d Dialect) Rebind(query string) string {
+	if d != DialectPostgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// InsertIgnore 返回主键冲突时不做修改的INSERT语句，占位符为?，需再经Rebind
+// columns为逗号分隔的列名，pk为主键列，可通过RowsAffected判断是否写入
+func (d Dialect) InsertIgnore(table, columns, pk string) string {
+	values := strings.TrimSuffix(strings.Repeat("?, ", strings.Count(columns, ",")+1), ", ")
+	if d == DialectMySQL {
+		return "INSERT IGNORE INTO " + table + " (" + columns + ") VALUES (" + values + ")"
+	}
+	return "INSERT INTO " + table + " (" + columns + ") VALUES (" + values + ") ON CONFLICT (" + pk + ") DO NOTHING"
+}
+
+// 行锁后缀，SQLite写事务本身互斥，不需要
+func (d Dialect) forUpdate() string {
+	if d == DialectSQLite {
+		return ""
+	}
+	return " FOR UPDATE"
+}
+
+const orderColumns = "kind, merchant_id, out_no, trade_no, out_order_no, uid, amount, currency, status, created_at, updated_at"
+
+// 并发冲突（如SQLite的busy）时整个事务的最大尝试次数
+const maxRecordAttempts = 3
+
+func (s *SQLStore) Record(ctx context.Context, o *Order, source string) error {
+	if err := checkKey(o); err != nil {
+		return err
+	}
+	for attempt := 1; ; attempt++ {
+		err := s.record(ctx, o, source)
+		if err == nil || attempt >= maxRecordAttempts || ctx.Err() != nil {
+			return err
+		}
+	}
+}
+
+// 先插入空记录占位并锁定该行，并发的首次写入及状态变化按顺序执行
+func (s *SQLStore) record(ctx context.Context, o *Order, source string) (err error) {
+	now := s.now()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("store: begin: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.ExecContext(ctx, s.dialect.Rebind(s.dialect.InsertIgnore("tt_pay_orders", orderColumns, "kind, merchant_id, out_no")),
+		string(o.Kind), o.MerchantId, o.OutNo, "", "", "", 0, "", "", now.UnixNano(), now.UnixNano())
+	if err != nil {
+		return fmt.Errorf("store: save order: %w", err)
+	}
+	cur, err := s.get(ctx, tx, o.Kind, o.MerchantId, o.OutNo, true)
+	if err != nil {
+		return err
+	}
+	from := cur.Status
+	changed := merge(cur, o)
+	cur.UpdatedAt = now
+
+	_, err = tx.ExecContext(ctx, s.dialect.Rebind(`UPDATE tt_pay_orders SET trade_no = ?, out_order_no = ?, uid = ?,
+amount = ?, currency = ?, status = ?, updated_at = ? WHERE kind = ? AND merchant_id = ? AND out_no = ?`),
+		cur.TradeNo, cur.OutOrderNo, cur.Uid, cur.Amount, cur.Currency, cur.Status, now.UnixNano(),
+		string(cur.Kind), cur.MerchantId, cur.OutNo)
+	if err != nil {
+		return fmt.Errorf("store: save order: %w", err)
+	}
+
+	if changed {
+		var seq int
+		row := tx.QueryRowContext(ctx, s.dialect.Rebind(`SELECT COALESCE(MAX(seq), 0) FROM tt_pay_order_history
+WHERE kind = ? AND merchant_id = ? AND out_no = ?`), string(cur.Kind), cur.MerchantId, cur.OutNo)
+		if err = row.Scan(&seq); err != nil {
+			return fmt.Errorf("store: query history seq: %w", err)
+		}
+		_, err = tx.ExecContext(ctx, s.dialect.Rebind(`INSERT INTO tt_pay_order_history
+(kind, merchant_id, out_no, seq, from_status, to_status, source, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`),
+			string(cur.Kind), cur.MerchantId, cur.OutNo, seq+1, from, cur.Status, source, now.UnixNano())
+		if err != nil {
+			return fmt.Errorf("store: save history: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("store: commit: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) Get(ctx context.Context, kind Kind, merchantId, outNo string) (*Order, error) {
+	return s.get(ctx, s.db, kind, merchantId, outNo, false)
+}
+
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// lock为true时锁定该行，需在事务中调用
+func (s *SQLStore) get(ctx context.Context, q queryer, kind Kind, merchantId, outNo string, lock bool) (*Order, error) {
+	query := `SELECT ` + orderColumns + ` FROM tt_pay_orders WHERE kind = ? AND merchant_id = ? AND out_no = ?`
+	if lock {
+		query += s.dialect.forUpdate()
+	}
+	row := q.QueryRowContext(ctx, s.dialect.Rebind(query), string(kind), merchantId, outNo)
+	o, err := scanOrder(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("store: get order: %w", err)
+	}
+	return o, nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// 按orderColumns的顺序读取一行
+func scanOrder(row scanner) (*Order, error) {
+	o := new(Order)
+	var k string
+	var createdAt, updatedAt int64
+	err := row.Scan(&k, &o.MerchantId, &o.OutNo, &o.TradeNo, &o.OutOrderNo, &o.Uid, &o.Amount,
+		&o.Currency, &o.Status, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	o.Kind = Kind(k)
+	o.CreatedAt = time.Unix(0, createdAt)
+	o.UpdatedAt = time.Unix(0, updatedAt)
+	return o, nil
+}
+
+func (s *SQLStore) Refunds(ctx context.Context, merchantId, outOrderNo string) ([]*Order, error) {
+	rows, err := s.db.QueryContext(ctx, s.dialect.Rebind(`SELECT `+orderColumns+` FROM tt_pay_orders
+WHERE kind = ? AND merchant_id = ? AND out_order_no = ? ORDER BY created_at, out_no`),
+		string(KindRefund), merchantId, outOrderNo)
+	if err != nil {
+		return nil, fmt.Errorf("store: query refunds: %w", err)
+	}
+	defer rows.Close()
+	var ret []*Order
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("store: scan refund: %w", err)
+		}
+		ret = append(ret, o)
+	}
+	return ret, rows.Err()
+}
+
+func (s *SQLStore) History(ctx context.Context, kind Kind, merchantId, outNo string) ([]Transition, error) {
+	if _, err := s.Get(ctx, kind, merchantId, outNo); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(ctx, s.dialect.Rebind(`SELECT from_status, to_status, source, created_at
+FROM tt_pay_order_history WHERE kind = ? AND merchant_id = ? AND out_no = ? ORDER BY seq`),
+		string(kind), merchantId, outNo)
+	if err != nil {
+		return nil, fmt.Errorf("store: query history: %w", err)
+	}
+	defer rows.Close()
+	var ret []Transition
+	for rows.Next() {
+		t := Transition{Kind: kind, MerchantId: merchantId, OutNo: outNo}
+		var at int64
+		if err := rows.Scan(&t.From, &t.To, &t.Source, &at); err != nil {
+			return nil, fmt.Errorf("store: scan history: %w", err)
+		}
+		t.At = time.Unix(0, at)
+		ret = append(ret, t)
+	}
+	return ret, rows.Err()
+}
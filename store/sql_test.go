@@ -0,0 +1,95 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func newSQLiteStore(t *testing.T) *SQLStore {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// :memory:数据库每个连接独立
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	s := NewSQLStore(db, DialectSQLite)
+	if err := s.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSQLStore(t *testing.T) {
+	testOrderStore(t, newSQLiteStore(t))
+}
+
+func TestSQLStoreMigrateTwice(t *testing.T) {
+	s := newSQLiteStore(t)
+	if err := s.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDialect(t *testing.T) {
+	if got := DialectPostgres.Rebind("a = ? AND b = ?"); got != "a = $1 AND b = $2" {
+		t.Errorf("got %s", got)
+	}
+	if got := DialectMySQL.Rebind("a = ?"); got != "a = ?" {
+		t.Errorf("got %s", got)
+	}
+	if got := DialectMySQL.InsertIgnore("t", "a, b", "a"); got != "INSERT IGNORE INTO t (a, b) VALUES (?, ?)" {
+		t.Errorf("got %s", got)
+	}
+	if got := DialectSQLite.InsertIgnore("t", "a, b", "a"); got != "INSERT INTO t (a, b) VALUES (?, ?) ON CONFLICT (a) DO NOTHING" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestSQLStoreConcurrentRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "orders.db")
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	s := NewSQLStore(db, DialectSQLite)
+	ctx := context.Background()
+	if err := s.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 回调与下单同时首次写入同一订单
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- s.Record(ctx, &Order{Kind: KindTrade, MerchantId: "m_1", OutNo: "o_1", Status: fmt.Sprintf("S%d", i)}, SourceNotify)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	history, err := s.History(ctx, KindTrade, "m_1", "o_1")
+	if err != nil || len(history) != 8 {
+		t.Fatalf("History = %d, %v", len(history), err)
+	}
+	for i := 1; i < len(history); i++ {
+		if history[i].From != history[i-1].To {
+			t.Fatalf("broken history chain %+v", history)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Package store 为可选的订单持久化层
+//
+// SDK本身是无状态的，通过tt_pay.SetOrderStore配置OrderStore后，
+// 下单、查询及回调解析会自动记录订单的单号映射、金额及状态变化。
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/liaoxxxx/tt_pay/consts"
+)
+
+// Kind 为订单类型
+type Kind string
+
+const (
+	KindTrade    Kind = "trade"
+	KindRefund   Kind = "refund"
+	KindWithdraw Kind = "withdraw"
+)
+
+// 状态来源
+const (
+	SourceCreate = "create"
+	SourceQuery  = "query"
+	SourceNotify = "notify"
+)
+
+// StatusCreated 为下单成功后的初始状态，其余状态直接使用财经侧返回的值，如SUCCESS
+const StatusCreated = "CREATED"
+
+// ErrNotFound 订单不存在
+var ErrNotFound = errors.New("store: order not found")
+
+// Order 为一笔交易、退款或提现
+type Order struct {
+	Kind       Kind
+	MerchantId string
+	OutNo      string // 商户单号：out_order_no、out_refund_no或out_trade_no
+	TradeNo    string // 财经侧单号：trade_no、refund_no或withdraw_trade_no
+	OutOrderNo string // 退款对应的原订单号，其他类型为空
+	Uid        string
+	Amount     int64 // 单位为分，0表示未知
+	Currency   string
+	Status     string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// Transition 为一次状态变化
+type Transition struct {
+	Kind       Kind
+	MerchantId string
+	OutNo      string
+	From       string // 首次记录时为空
+	To         string
+	Source     string
+	At         time.Time
+}
+
+// OrderStore 为订单存储接口，Kind、MerchantId、OutNo唯一确定一笔订单
+// 实现需保证并发安全
+type OrderStore interface {
+	// Record 记录订单，不存在时创建，存在时用o中的非零值字段更新
+	// o.Status不为空且与当前状态不同时，追加一条状态历史；当前为终态时忽略非终态的o.Status
+	Record(ctx context.Context, o *Order, source string) error
+	// Get 查询订单，不存在时返回ErrNotFound
+	Get(ctx context.Context, kind Kind, merchantId, outNo string) (*Order, error)
+	// History 按发生顺序返回订单的状态历史
+	History(ctx context.Context, kind Kind, merchantId, outNo string) ([]Transition, error)
+}
+
+// RefundLister 为OrderStore的可选接口，按原订单号列出退款，MemoryStore与SQLStore均已实现
+type RefundLister interface {
+	// Refunds 按创建顺序返回原订单的所有退款，没有时返回空
+	Refunds(ctx context.Context, merchantId, outOrderNo string) ([]*Order, error)
+}
+
+// 用update中的非零值字段更新cur，返回状态是否变化
+// 终态不会被非终态覆盖，以免乱序到达的查询结果或重复的下单记录回退状态
+func merge(cur, update *Order) bool {
+	if update.TradeNo != "" {
+		cur.TradeNo = update.TradeNo
+	}
+	if update.OutOrderNo != "" {
+		cur.OutOrderNo = update.OutOrderNo
+	}
+	if update.Uid != "" {
+		cur.Uid = update.Uid
+	}
+	if update.Amount != 0 {
+		cur.Amount = update.Amount
+	}
+	if update.Currency != "" {
+		cur.Currency = update.Currency
+	}
+	if update.Status == "" || update.Status == cur.Status {
+		return false
+	}
+	if isFinal(cur.Kind, cur.Status) && !isFinal(cur.Kind, update.Status) {
+		return false
+	}
+	cur.Status = update.Status
+	return true
+}
+
+// 是否为终态
+func isFinal(kind Kind, status string) bool {
+	switch kind {
+	case KindTrade:
+		return status == consts.TradeStatusSuccess || status == consts.TradeStatusFail || status == consts.TradeStatusTimeout
+	case KindRefund:
+		return status == consts.RefundStatusSuccess || status == consts.RefundStatusFail
+	case KindWithdraw:
+		return status == consts.WithdrawStatusSuccess || status == consts.WithdrawStatusFail
+	}
+	return false
+}
+
+func checkKey(o *Order) error {
+	if o.Kind == "" || o.OutNo == "" {
+		return errors.New("store: Kind and OutNo are required")
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// 所有OrderStore实现共用的测试
+func testOrderStore(t *testing.T, s OrderStore) {
+	ctx := context.Background()
+
+	if _, err := s.Get(ctx, KindTrade, "m_1", "order_1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if err := s.Record(ctx, &Order{Kind: KindTrade, MerchantId: "m_1"}, SourceCreate); err == nil {
+		t.Fatal("expected error for empty OutNo")
+	}
+
+	steps := []struct {
+		order  Order
+		source string
+	}{
+		{Order{Uid: "uid_1", Amount: 100, Currency: "CNY", Status: StatusCreated}, SourceCreate},
+		{Order{TradeNo: "trade_1", Status: "PROCESSING"}, SourceQuery},
+		{Order{Status: "PROCESSING"}, SourceQuery},
+		{Order{Status: "SUCCESS"}, SourceNotify},
+		// 终态不被乱序到达的非终态覆盖
+		{Order{Status: "PROCESSING"}, SourceQuery},
+		{Order{Status: StatusCreated}, SourceCreate},
+	}
+	for _, step := range steps {
+		o := step.order
+		o.Kind, o.MerchantId, o.OutNo = KindTrade, "m_1", "order_1"
+		if err := s.Record(ctx, &o, step.source); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := s.Get(ctx, KindTrade, "m_1", "order_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.TradeNo != "trade_1" || got.Uid != "uid_1" || got.Amount != 100 || got.Currency != "CNY" || got.Status != "SUCCESS" {
+		t.Errorf("unexpected order %+v", got)
+	}
+	if got.CreatedAt.IsZero() || got.UpdatedAt.Before(got.CreatedAt) {
+		t.Errorf("unexpected timestamps %v %v", got.CreatedAt, got.UpdatedAt)
+	}
+
+	history, err := s.History(ctx, KindTrade, "m_1", "order_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Transition{
+		{From: "", To: StatusCreated, Source: SourceCreate},
+		{From: StatusCreated, To: "PROCESSING", Source: SourceQuery},
+		{From: "PROCESSING", To: "SUCCESS", Source: SourceNotify},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("expected %d transitions, got %+v", len(want), history)
+	}
+	for i, w := range want {
+		h := history[i]
+		if h.From != w.From || h.To != w.To || h.Source != w.Source || h.OutNo != "order_1" || h.At.IsZero() {
+			t.Errorf("transition %d: got %+v, want %+v", i, h, w)
+		}
+	}
+
+	// 同一单号的不同类型、不同商户互不影响
+	if _, err := s.Get(ctx, KindRefund, "m_1", "order_1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for refund, got %v", err)
+	}
+	if _, err := s.History(ctx, KindTrade, "m_2", "order_1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for other merchant, got %v", err)
+	}
+
+	lister, ok := s.(RefundLister)
+	if !ok {
+		return
+	}
+	for _, no := range []string{"refund_1", "refund_2"} {
+		s.Record(ctx, &Order{Kind: KindRefund, MerchantId: "m_1", OutNo: no, OutOrderNo: "order_1", Amount: 10}, SourceCreate)
+	}
+	s.Record(ctx, &Order{Kind: KindRefund, MerchantId: "m_1", OutNo: "refund_3", OutOrderNo: "order_2"}, SourceCreate)
+	refunds, err := lister.Refunds(ctx, "m_1", "order_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refunds) != 2 || refunds[0].OutNo != "refund_1" || refunds[1].OutNo != "refund_2" {
+		t.Errorf("unexpected refunds %+v", refunds)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testOrderStore(t, NewMemoryStore())
+}
+
+func TestMemoryStoreReturnsCopy(t *testing.T) {
+	s := NewMemoryStore()
+	s.now = func() time.Time { return time.Unix(100, 0) }
+	ctx := context.Background()
+	s.Record(ctx, &Order{Kind: KindRefund, OutNo: "r_1", Status: StatusCreated}, SourceCreate)
+	o, _ := s.Get(ctx, KindRefund, "", "r_1")
+	o.Status = "SUCCESS"
+	if o2, _ := s.Get(ctx, KindRefund, "", "r_1"); o2.Status != StatusCreated || !o2.CreatedAt.Equal(time.Unix(100, 0)) {
+		t.Errorf("stored order modified through Get: %+v", o2)
+	}
+}
@@ -0,0 +1,121 @@
+package tt_pay
+
+import (
+	"context"
+	"time"
+
+	"github.com/liaoxxxx/tt_pay/tracing"
+	"github.com/liaoxxxx/tt_pay/util"
+)
+
+const (
+	spanExecute = "tt_pay.Execute"
+	spanEncode  = "tt_pay.encode"
+	spanSign    = "tt_pay.sign"
+	spanHttp    = "tt_pay.http"
+	spanDecode  = "tt_pay.decode"
+	spanNotify  = "tt_pay.notify"
+)
+
+var tracer tracing.Tracer = tracing.NopTracer{}
+
+// SetTracer 设置链路追踪实现，传nil则关闭追踪
+func SetTracer(t tracing.Tracer) {
+	if t == nil {
+		t = tracing.NopTracer{}
+	}
+	tracer = t
+}
+
+// 实现该接口的Request/Response会将订单号写入Span属性
+// key为biz_content中的字段名，如out_order_no
+type orderAttributer interface {
+	orderAttributes() map[string]string
+}
+
+// 写入订单号属性，被脱敏策略命中的字段不写入
+func setOrderAttributes(span tracing.Span, v interface{}) {
+	attributer, ok := v.(orderAttributer)
+	if !ok {
+		return
+	}
+	policy := util.GetRedactPolicy()
+	for key, val := range attributer.orderAttributes() {
+		if val == "" || policy.IsSensitive(key) {
+			continue
+		}
+		span.SetAttribute("tt_pay."+key, val)
+	}
+}
+
+// 透传trace id的请求头，为空时不透传
+var traceHeader string
+
+// SetTraceHeader 设置透传trace id的请求头，默认不透传
+// 财经侧未约定该请求头，仅在网关或代理需要关联链路时开启
+func SetTraceHeader(name string) {
+	traceHeader = name
+}
+
+type traceIdCtxKey struct{}
+
+func contextWithTraceId(ctx context.Context, traceId string) context.Context {
+	if traceId == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, traceIdCtxKey{}, traceId)
+}
+
+func traceIdFromContext(ctx context.Context) string {
+	traceId, _ := ctx.Value(traceIdCtxKey{}).(string)
+	return traceId
+}
+
+// 保留ctx中的值但不随其取消，Execute发出的请求只受timeout限制
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+func (detachedContext) Done() <-chan struct{} { return nil }
+
+func (detachedContext) Err() error { return nil }
+
+func detachContext(ctx context.Context) context.Context {
+	return detachedContext{ctx}
+}
+
+// 编码请求，分阶段编码的Request会分别记录编码与加签Span
+func encodeRequest(ctx context.Context, req TPRequest) (string, error) {
+	_, encodeSpan := tracer.Start(ctx, spanEncode)
+	staged, ok := req.(stagedRequest)
+	if !ok {
+		body, err := req.Encode()
+		encodeSpan.RecordError(err)
+		encodeSpan.End()
+		return body, err
+	}
+	bizContent, err := staged.encodeBizContent()
+	encodeSpan.RecordError(err)
+	encodeSpan.End()
+	if err != nil {
+		return "", err
+	}
+
+	_, signSpan := tracer.Start(ctx, spanSign)
+	body := encodeGatewayForm(staged.gatewayParams(), bizContent)
+	signSpan.End()
+	return body, nil
+}
+
+// 回调解析的统一收尾：记录监控及追踪信息
+func finishNotify(span tracing.Span, notifyType string, resp interface{}, err error) {
+	span.SetAttribute(tracing.AttrNotifyType, notifyType)
+	if err == nil {
+		setOrderAttributes(span, resp)
+	}
+	span.RecordError(err)
+	span.End()
+	metricsHook.ObserveNotify(notifyType, err)
+}
@@ -0,0 +1,132 @@
+package tt_pay
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/liaoxxxx/tt_pay/consts"
+	"github.com/liaoxxxx/tt_pay/tracing"
+	"github.com/liaoxxxx/tt_pay/util"
+)
+
+func useInMemoryTracer(t *testing.T) *tracing.InMemoryExporter {
+	t.Helper()
+	exporter := tracing.NewInMemoryExporter()
+	SetTracer(tracing.NewRecorder(exporter))
+	t.Cleanup(func() { SetTracer(nil) })
+	return exporter
+}
+
+func TestExecuteTracing(t *testing.T) {
+	exporter := useInMemoryTracer(t)
+	SetTraceHeader("X-Trace-Id")
+	defer SetTraceHeader("")
+
+	var gotLogId, gotTraceId string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotLogId = r.Header.Get("X-Tt-Logid")
+		gotTraceId = r.Header.Get("X-Trace-Id")
+		w.Write([]byte(`{"response":{"code":"10000","msg":"Success","out_order_no":"order_1","trade_no":"t_1"}}`))
+	}))
+	defer ts.Close()
+
+	req := NewTradeQueryRequest(testConfig(ts.URL))
+	req.Uid = "uid_1"
+	req.OutOrderNo = "order_1"
+	if _, err := TradeQuery(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+
+	root := exporter.Find(spanExecute)
+	if root == nil {
+		t.Fatal("missing Execute span")
+	}
+	for _, name := range []string{spanEncode, spanSign, spanHttp, spanDecode} {
+		span := exporter.Find(name)
+		if span == nil {
+			t.Fatalf("missing %s span", name)
+		}
+		if span.TraceId != root.TraceId || span.ParentSpanId != root.SpanId {
+			t.Errorf("%s should be a child of Execute", name)
+		}
+	}
+	if root.Attributes[tracing.AttrMethod] != consts.MethodTradeQuery ||
+		root.Attributes[tracing.AttrOutOrderNo] != "order_1" ||
+		root.Attributes[tracing.AttrStatusCode] != "200" {
+		t.Errorf("unexpected attributes %v", root.Attributes)
+	}
+	if root.Attributes[tracing.AttrLogId] != gotLogId || gotLogId != req.GetLogId() {
+		t.Errorf("log id not correlated: span %q header %q", root.Attributes[tracing.AttrLogId], gotLogId)
+	}
+	if gotTraceId != root.TraceId {
+		t.Errorf("trace id header %q, want %q", gotTraceId, root.TraceId)
+	}
+}
+
+func TestExecuteTracingRedactedOrderNo(t *testing.T) {
+	exporter := useInMemoryTracer(t)
+	old := util.GetRedactPolicy()
+	defer util.SetRedactPolicy(old)
+	policy := util.DefaultRedactPolicy()
+	policy.Keys = append(policy.Keys, "out_order_no")
+	util.SetRedactPolicy(policy)
+
+	ts := newStubGateway(t, `{"response":{"code":"40004","sub_code":"TP.SYSTEM_ERROR"}}`)
+	req := NewTradeQueryRequest(testConfig(ts.URL))
+	req.Uid = "uid_1"
+	req.OutOrderNo = "order_1"
+	if _, err := TradeQuery(context.Background(), req); err == nil {
+		t.Fatal("expected error")
+	}
+
+	root := exporter.Find(spanExecute)
+	if _, ok := root.Attributes[tracing.AttrOutOrderNo]; ok {
+		t.Errorf("redacted out_order_no must not be recorded: %v", root.Attributes)
+	}
+	if root.Err == nil || exporter.Find(spanDecode).Err == nil {
+		t.Error("business error should be recorded on spans")
+	}
+}
+
+func TestNotifyTracing(t *testing.T) {
+	exporter := useInMemoryTracer(t)
+
+	req := new(RefundNotifyRequest)
+	req.SetParam("out_refund_no=refund_1&sign=bad")
+	if _, err := RefundNotify(context.Background(), req); err == nil {
+		t.Fatal("expected invalid sign")
+	}
+	span := exporter.Find(spanNotify)
+	if span == nil || span.Err == nil || span.Attributes[tracing.AttrNotifyType] != consts.NotifyTypeRefund {
+		t.Errorf("unexpected notify span %+v", span)
+	}
+}
+
+func TestExecuteDefaults(t *testing.T) {
+	useInMemoryTracer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var headers http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		// 请求发出后调用方取消不影响本次请求
+		cancel()
+		w.Write([]byte(`{"response":{"code":"10000","msg":"Success","out_order_no":"order_1","trade_no":"t_1"}}`))
+	}))
+	defer ts.Close()
+
+	req := NewTradeQueryRequest(testConfig(ts.URL))
+	req.Uid = "uid_1"
+	req.OutOrderNo = "order_1"
+	if _, err := TradeQuery(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	for key := range headers {
+		if strings.Contains(strings.ToLower(key), "trace") {
+			t.Errorf("unexpected trace header %s", key)
+		}
+	}
+}
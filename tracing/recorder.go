@@ -0,0 +1,160 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// SpanData 为结束后的Span快照
+type SpanData struct {
+	TraceId      string
+	SpanId       string
+	ParentSpanId string
+	Name         string
+	StartTime    time.Time
+	EndTime      time.Time
+	Attributes   map[string]string
+	Err          error
+}
+
+// Exporter 接收结束的Span
+type Exporter interface {
+	ExportSpan(span *SpanData)
+}
+
+// Recorder 为Tracer的简单实现，生成W3C格式的trace id/span id，Span结束时交给Exporter
+type Recorder struct {
+	exporter Exporter
+}
+
+// NewRecorder 初始化Recorder
+func NewRecorder(exporter Exporter) *Recorder {
+	return &Recorder{exporter: exporter}
+}
+
+type spanCtxKey struct{}
+
+// Start 开启Span，ctx中已有Span时作为其子节点
+func (r *Recorder) Start(ctx context.Context, name string) (context.Context, Span) {
+	span := &recordedSpan{
+		recorder: r,
+		data: SpanData{
+			SpanId:     randomHex(8),
+			Name:       name,
+			StartTime:  time.Now(),
+			Attributes: make(map[string]string),
+		},
+	}
+	if parent, ok := ctx.Value(spanCtxKey{}).(*recordedSpan); ok {
+		span.data.TraceId = parent.data.TraceId
+		span.data.ParentSpanId = parent.data.SpanId
+	} else {
+		span.data.TraceId = randomHex(16)
+	}
+	return context.WithValue(ctx, spanCtxKey{}, span), span
+}
+
+type recordedSpan struct {
+	recorder *Recorder
+	mu       sync.Mutex
+	data     SpanData
+	ended    bool
+}
+
+func (s *recordedSpan) SetAttribute(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Attributes[key] = value
+}
+
+func (s *recordedSpan) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Err = err
+}
+
+// End 结束Span，重复调用只导出一次
+func (s *recordedSpan) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.EndTime = time.Now()
+	data := s.data
+	data.Attributes = make(map[string]string, len(s.data.Attributes))
+	for k, v := range s.data.Attributes {
+		data.Attributes[k] = v
+	}
+	s.mu.Unlock()
+
+	if s.recorder.exporter != nil {
+		s.recorder.exporter.ExportSpan(&data)
+	}
+}
+
+func (s *recordedSpan) TraceId() string {
+	return s.data.TraceId
+}
+
+// InMemoryExporter 将Span保存在内存中，用于测试
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []*SpanData
+}
+
+// NewInMemoryExporter 初始化InMemoryExporter
+func NewInMemoryExporter() *InMemoryExporter {
+	return new(InMemoryExporter)
+}
+
+func (e *InMemoryExporter) ExportSpan(span *SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+// Spans 按结束顺序返回所有Span
+func (e *InMemoryExporter) Spans() []*SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*SpanData(nil), e.spans...)
+}
+
+// Find 返回第一个名为name的Span，不存在时返回nil
+func (e *InMemoryExporter) Find(name string) *SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, span := range e.spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	return nil
+}
+
+// Reset 清空已保存的Span
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand读取失败时退化为时间戳，仅影响id唯一性
+		ts := time.Now().UnixNano()
+		for i := range b {
+			b[i] = byte(ts >> (8 * (i % 8)))
+		}
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,43 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	recorder := NewRecorder(exporter)
+
+	ctx, parent := recorder.Start(context.Background(), "parent")
+	parent.SetAttribute(AttrMethod, "tp.trade.query")
+	_, child := recorder.Start(ctx, "child")
+	child.RecordError(errors.New("boom"))
+	child.End()
+	parent.End()
+	parent.End()
+
+	spans := exporter.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	c, p := exporter.Find("child"), exporter.Find("parent")
+	if c.TraceId != p.TraceId || len(p.TraceId) != 32 {
+		t.Errorf("child should share trace id %q, got %q", p.TraceId, c.TraceId)
+	}
+	if c.ParentSpanId != p.SpanId || p.ParentSpanId != "" {
+		t.Errorf("unexpected parent span ids: %+v %+v", c, p)
+	}
+	if c.Err == nil || p.Attributes[AttrMethod] != "tp.trade.query" {
+		t.Errorf("unexpected span data: %+v %+v", c, p)
+	}
+	if parent.TraceId() != p.TraceId {
+		t.Errorf("TraceId() mismatch")
+	}
+
+	exporter.Reset()
+	if len(exporter.Spans()) != 0 {
+		t.Error("Reset should clear spans")
+	}
+}
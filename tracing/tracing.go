@@ -0,0 +1,50 @@
+// Package tracing 定义SDK使用的链路追踪接口
+// 接口与OpenTelemetry的Tracer/Span语义保持一致，业务方可自行适配任意实现，
+// SDK本身不依赖任何exporter；Recorder为内置的简单实现，主要用于测试
+package tracing
+
+import (
+	"context"
+)
+
+// 常用的Span属性名
+const (
+	AttrMethod      = "tt_pay.method"
+	AttrLogId       = "tt_pay.log_id"
+	AttrOutOrderNo  = "tt_pay.out_order_no"
+	AttrOutRefundNo = "tt_pay.out_refund_no"
+	AttrOutTradeNo  = "tt_pay.out_trade_no"
+	AttrStatusCode  = "http.status_code"
+	AttrNotifyType  = "tt_pay.notify_type"
+)
+
+// Tracer 开启Span，返回的ctx需携带新Span，以便后续Span以其为父节点
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span 单个追踪节点
+// TraceId 返回所属链路的trace id，用于与X-Tt-Logid等日志标识关联
+type Span interface {
+	SetAttribute(key, value string)
+	RecordError(err error)
+	End()
+	TraceId() string
+}
+
+// NopTracer 不做任何记录的Tracer，为SDK默认值
+type NopTracer struct{}
+
+func (NopTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+type nopSpan struct{}
+
+func (nopSpan) SetAttribute(key, value string) {}
+
+func (nopSpan) RecordError(err error) {}
+
+func (nopSpan) End() {}
+
+func (nopSpan) TraceId() string { return "" }
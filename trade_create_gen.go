@@ -0,0 +1,221 @@
+// Code generated by ttpaygen from schema/tp.trade.create.json. DO NOT EDIT.
+
+package tt_pay
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bitly/go-simplejson"
+
+	"github.com/liaoxxxx/tt_pay/config"
+	"github.com/liaoxxxx/tt_pay/consts"
+	"github.com/liaoxxxx/tt_pay/util"
+)
+
+// 预下单Request
+type TradeCreateRequest struct {
+	config.Config
+	Method         string
+	Format         string           `ttpay:"eq=JSON"`
+	Charset        string           `ttpay:"eq=utf-8"`
+	SignType       string           `ttpay:"eq=MD5"`
+	Timestamp      string           `ttpay:"number"`
+	Version        string           `ttpay:"version"`
+	bizContent     *simplejson.Json `ttpay:"nonnil"`
+	Path           string
+	AppletVersion  string
+	OutOrderNo     string `ttpay:"id,max=32"`
+	Uid            string `ttpay:"id,max=32"`
+	UidType        string
+	TotalAmount    int    `ttpay:"positive"`
+	Currency       string `ttpay:"required"`
+	TradeType      string `ttpay:"v2:required"`
+	Subject        string `ttpay:"required"`
+	Body           string `ttpay:"required"`
+	ProductCode    string `ttpay:"v2:required"`
+	PaymentType    string `ttpay:"v2:required"`
+	PaymentType1_0 string
+	TradeTime      time.Time     `ttpay:"required"`    // 交易时间，编码为Unix时间戳
+	ValidTime      time.Duration `ttpay:"v2:positive"` // 订单有效时长，编码为秒数
+	NotifyUrl      string        `ttpay:"url"`
+	RiskInfo       string        `ttpay:"json"`
+	Params         string
+	ProductId      string
+	PayChannel     string
+	PayDiscount    string
+	ServiceFee     string
+	LimitPay       string
+	AlipayUrl      string
+	WxUrl          string
+	WxType         string
+	ExtParam       string
+}
+
+// New函数内赋默认值，目前含默认值（或仅支持一个值的）参数包括：
+// Version = "1.0"
+// SignType = "MD5"
+// Format = "JSON"
+// Charset = "utf-8"
+// Path = "gateway"，可通过SetPath改为"gateway-u"
+// Config.TPDomain = "https://tp-pay.snssdk.com"（未配置TPDomains时）
+// Method = "tp.trade.create"
+// Timestamp 自动设置为当前Unix时间戳，时间来源可通过SetClock替换
+// 另外，注意初始化bizContent，以免出现nil指针错误
+func NewTradeCreateRequest(config config.Config) *TradeCreateRequest {
+	ret := new(TradeCreateRequest)
+	ret.Config = config
+	ret.Version = "1.0"
+	ret.SignType = "MD5"
+	ret.Format = "JSON"
+	ret.Charset = "utf-8"
+	ret.Path = consts.TPPath
+	if len(ret.Config.TPDomain) == 0 && len(ret.Config.TPDomains) == 0 {
+		ret.Config.TPDomain = consts.TPDomain
+	}
+	ret.Method = consts.MethodTradeCreate
+	ret.Timestamp = fmt.Sprintf("%d", Now().Unix())
+	ret.bizContent = simplejson.New()
+	return ret
+}
+
+// 将Request编码成POST请求的Body
+func (req *TradeCreateRequest) Encode() (string, error) {
+	bizContent, err := req.encodeBizContent()
+	if err != nil {
+		return "", err
+	}
+	return encodeGatewayForm(req.gatewayParams(), bizContent), nil
+}
+
+// 编码biz_content
+func (req *TradeCreateRequest) encodeBizContent() (string, error) {
+	req.bizContent.Set("out_order_no", req.OutOrderNo)
+	req.bizContent.Set("uid", req.Uid)
+	req.bizContent.Set("uid_type", req.UidType)
+	req.bizContent.Set("merchant_id", req.MerchantId)
+	req.bizContent.Set("total_amount", req.TotalAmount)
+	req.bizContent.Set("currency", req.Currency)
+	req.bizContent.Set("subject", req.Subject)
+	req.bizContent.Set("body", req.Body)
+	req.bizContent.Set("product_code", req.ProductCode)
+	req.bizContent.Set("payment_type", req.PaymentType)
+	req.bizContent.Set("trade_time", formatUnixTime(req.TradeTime))
+	req.bizContent.Set("valid_time", formatSeconds(req.ValidTime))
+	req.bizContent.Set("notify_url", req.NotifyUrl)
+	req.bizContent.Set("service_fee", req.ServiceFee)
+	req.bizContent.Set("risk_info", req.RiskInfo)
+
+	bizContentBytes, err := req.bizContent.Encode()
+	if err != nil {
+		util.Debug("TradeCreateRequest Encode bizContent.Encode err: %s, bizContent %v\n", err, util.RedactMap(req.bizContent.MustMap()))
+		return "", util.Wrap(err, "TradeCreateRequest Encode failed when [bizContent.Encode()]")
+	}
+
+	return string(bizContentBytes), nil
+}
+
+// 网关公共参数
+func (req *TradeCreateRequest) gatewayParams() gatewayParams {
+	return gatewayParams{
+		AppId:     req.Config.AppId,
+		AppSecret: req.Config.AppSecret,
+		Method:    req.Method,
+		Format:    req.Format,
+		Charset:   req.Charset,
+		SignType:  req.SignType,
+		Timestamp: req.Timestamp,
+		Version:   req.Version,
+	}
+}
+
+// 生成该次请求logid
+func (req *TradeCreateRequest) GetLogId() string {
+	id := req.OutOrderNo
+	return fmt.Sprintf("%s_%s_%s_%s", req.Config.AppId, req.Config.MerchantId, id, req.Timestamp)
+}
+
+// 获取请求url地址，配置多个域名时使用当前可用的域名
+func (req *TradeCreateRequest) GetUrl() string {
+	return ActiveDomain(req.Config) + "/" + req.Path
+}
+
+// 获取请求路径，切换域名时与各域名拼接
+func (req *TradeCreateRequest) GetPath() string {
+	return req.Path
+}
+
+// 设置请求路径，可选consts.TPPath（默认）或consts.TPPathU
+// 两者加签方式相同，响应的解析见Decode
+func (req *TradeCreateRequest) SetPath(path string) {
+	req.Path = path
+}
+
+// 获取接口方法名
+func (req *TradeCreateRequest) GetMethod() string {
+	return req.Method
+}
+
+// 订单号，用于链路追踪
+func (req *TradeCreateRequest) orderAttributes() map[string]string {
+	return map[string]string{
+		"out_order_no": req.OutOrderNo,
+	}
+}
+
+// 输出请求参数，AppSecret已脱敏
+func (req *TradeCreateRequest) String() string {
+	return formatRequest(req)
+}
+
+// 用于%#v输出，AppSecret已脱敏
+func (req *TradeCreateRequest) GoString() string {
+	return formatRequest(req)
+}
+
+// 提供该接口，方便业务方设置可选参数，比如product_code、payment_type等
+func (req *TradeCreateRequest) SetBizContentKV(key string, val interface{}) {
+	req.bizContent.Set(key, val)
+}
+
+// 预下单响应
+type TradeCreateResponse struct {
+	Data    *simplejson.Json
+	TradeNo string              `json:"trade_no"`
+	URL     string              `json:"url"`
+	req     *TradeCreateRequest // 包含拉起收银台所需参数
+}
+
+// 初始化预下单响应
+func NewTradeCreateResponse(req *TradeCreateRequest) *TradeCreateResponse {
+	ret := new(TradeCreateResponse)
+	ret.Data = simplejson.New()
+	ret.req = req
+	return ret
+}
+
+// 将响应json数据反序列化为对应接口
+func (resp *TradeCreateResponse) Decode() error {
+	var respBytes []byte
+	var err error
+	// 走网关的接口拿到的参数在response里，否则（如gateway-u）在data里
+	switch resp.Data.Get("response").Interface() {
+	case nil:
+		respBytes, err = resp.Data.Get("data").Encode()
+	default:
+		respBytes, err = resp.Data.Get("response").Encode()
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(respBytes, resp); err != nil {
+		return err
+	}
+	return nil
+}
+
+// 设置原始响应
+func (resp *TradeCreateResponse) SetData(data *simplejson.Json) {
+	resp.Data = data
+}
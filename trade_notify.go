@@ -2,24 +2,35 @@ package tt_pay
 
 import (
 	"context"
-	"errors"
 	"net/url"
 
 	"github.com/liaoxxxx/tt_pay/consts"
+	"github.com/liaoxxxx/tt_pay/store"
 	"github.com/liaoxxxx/tt_pay/util"
 )
 
 // 下单回调请求
 type TradeNotifyRequest struct {
-	Param string
+	Param     string
+	PublicKey string // 验签公钥，为空时使用consts.TtPayPublicKey
 }
 
 // 下单回调接口
 func TradeNotify(ctx context.Context, req *TradeNotifyRequest) (*TradeNotifyResponse, error) {
+	ctx, span := tracer.Start(ctx, spanNotify)
+	resp, err := tradeNotify(ctx, req)
+	if err == nil {
+		recordOrder(ctx, resp.storeOrder(), store.SourceNotify)
+	}
+	finishNotify(span, consts.NotifyTypeTrade, resp, err)
+	return resp, err
+}
+
+func tradeNotify(ctx context.Context, req *TradeNotifyRequest) (*TradeNotifyResponse, error) {
 	// 解析回调参数
 	params, err := url.ParseQuery(req.Param)
 	if err != nil {
-		util.Debug("TradeNotify failed: params: [%s] err: [%s]", req.Param, err)
+		util.Debug("TradeNotify failed: params: [%s] err: [%s]", util.RedactForm(req.Param), err)
 		return nil, util.Wrap(err, "TradeNotify failed when [ParseQuery()]")
 	}
 
@@ -33,8 +44,8 @@ func TradeNotify(ctx context.Context, req *TradeNotifyRequest) (*TradeNotifyResp
 
 	sign := resp.Get("sign")
 
-	if valid := util.VerifyMd5WithRsa(signMap, sign, consts.TtPayPublicKey); !valid {
-		return nil, errors.New("Invalid sign")
+	if valid := util.VerifyMd5WithRsa(signMap, sign, notifyPublicKey(req.PublicKey)); !valid {
+		return nil, util.ErrInvalidSign
 	}
 
 	resp.Decode()
@@ -60,7 +71,7 @@ type TradeNotifyResponse struct {
 	TradeNo     string
 	TotalAmount string
 	PayChannel  string
-	PayTime     string
+	PayTime     GatewayTime
 	PayType     string
 	TradeStatus string
 	TradeMsg    string
@@ -79,7 +90,8 @@ func (resp *TradeNotifyResponse) Decode() {
 	resp.TotalAmount = resp.Get("total_amount")
 	resp.PayChannel = resp.Get("pay_channel")
 	resp.MerchantId = resp.Get("merchant_id")
-	resp.PayTime = resp.Get("pay_time")
+	// 格式无法识别时为零值，原始值可通过Get获取
+	resp.PayTime, _ = ParseGatewayTime(resp.Get("pay_time"))
 	resp.PayType = resp.Get("pay_type")
 	resp.TradeStatus = resp.Get("trade_status")
 	resp.TradeMsg = resp.Get("trade_msg")
@@ -90,3 +102,30 @@ func (resp *TradeNotifyResponse) Decode() {
 func (resp *TradeNotifyResponse) Get(key string) string {
 	return resp.Param[key]
 }
+
+// 订单号，用于链路追踪
+func (resp *TradeNotifyResponse) orderAttributes() map[string]string {
+	return map[string]string{
+		"out_order_no": resp.OutOrderNo,
+	}
+}
+
+// 订单存储记录
+func (resp *TradeNotifyResponse) storeOrder() *store.Order {
+	return &store.Order{
+		Kind:       store.KindTrade,
+		MerchantId: resp.MerchantId,
+		OutNo:      resp.OutOrderNo,
+		TradeNo:    resp.TradeNo,
+		Amount:     parseAmount(resp.TotalAmount),
+		Status:     resp.TradeStatus,
+	}
+}
+
+// 回调验签公钥，未指定时使用财经侧默认公钥
+func notifyPublicKey(key string) string {
+	if key == "" {
+		return consts.TtPayPublicKey
+	}
+	return key
+}
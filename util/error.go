@@ -1,6 +1,8 @@
 package util
 
 import (
+	"context"
+	"errors"
 	"fmt"
 )
 
@@ -8,6 +10,46 @@ const (
 	ErrorPattern = `{"code": "%s", "msg": "%s", "sub_code": "%s", "sub_msg": "%s", "detail": "%s"}`
 )
 
+// 错误分类，配合errors.Is使用，例如：
+//
+//	if errors.Is(err, util.ErrRetryable) { ... }
+var (
+	ErrNetwork             = errors.New("tt_pay: network error")
+	ErrBusiness            = errors.New("tt_pay: business error")
+	ErrRetryable           = errors.New("tt_pay: retryable error")
+	ErrPermanent           = errors.New("tt_pay: permanent error")
+	ErrSignature           = errors.New("tt_pay: signature error")
+	ErrAuth                = errors.New("tt_pay: auth error")
+	ErrInvalidParam        = errors.New("tt_pay: invalid param")
+	ErrDuplicateOrder      = errors.New("tt_pay: duplicate order")
+	ErrInsufficientBalance = errors.New("tt_pay: insufficient balance")
+	ErrOrderNotExist       = errors.New("tt_pay: order not exist")
+	ErrNotSent             = errors.New("tt_pay: request not sent") // 请求未发出（限流等待取消、熔断等），财经侧一定未受理
+)
+
+// 回调验签失败
+var ErrInvalidSign error = &categorizedError{
+	msg:        "Invalid sign",
+	categories: []error{ErrSignature, ErrPermanent},
+}
+
+// 带分类的错误，errors.Is可匹配到其所属的所有分类
+type categorizedError struct {
+	msg        string
+	categories []error
+}
+
+func (e *categorizedError) Error() string { return e.msg }
+
+func (e *categorizedError) Is(target error) bool {
+	for _, c := range e.categories {
+		if c == target {
+			return true
+		}
+	}
+	return false
+}
+
 // Error为请求失败错误
 // 当出现此Error时，意味着网络连接建立成功，但请求失败
 // 典型的情况是请求参数设置错误
@@ -26,6 +68,75 @@ func (e *Error) Error() string {
 	return fmt.Sprintf(ErrorPattern, e.Code, e.Msg, e.SubCode, e.SubMsg, e.Detail)
 }
 
+// Category 根据code和sub_code查询错误分类
+func (e *Error) Category() Category {
+	return LookupCategory(e.Code, e.SubCode)
+}
+
+// Is 使errors.Is可以按分类匹配，所有Error都属于ErrBusiness
+func (e *Error) Is(target error) bool {
+	return target == ErrBusiness || e.Category().Matches(target)
+}
+
+// NetworkError 为网络错误，此时无法确定请求是否已被财经后端受理
+// 包括连接失败、超时、读取响应失败以及响应体无法解析的5xx响应
+type NetworkError struct {
+	StatusCode int // 收到5xx响应时为HTTP状态码，否则为0
+	cause      error
+}
+
+// NewNetworkError 包装网络错误
+func NewNetworkError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &NetworkError{cause: err}
+}
+
+// NewStatusError 由异常的HTTP状态码生成网络错误
+func NewStatusError(statusCode int) error {
+	return &NetworkError{
+		StatusCode: statusCode,
+		cause:      fmt.Errorf("unexpected http status %d", statusCode),
+	}
+}
+
+func (e *NetworkError) Error() string { return e.cause.Error() }
+
+func (e *NetworkError) Unwrap() error { return e.cause }
+
+// Is 调用方取消（context.Canceled）不属于可重试错误
+func (e *NetworkError) Is(target error) bool {
+	if target == ErrRetryable {
+		return !errors.Is(e.cause, context.Canceled)
+	}
+	return target == ErrNetwork
+}
+
+// NotSent 标记请求发出前的错误，errors.Is可匹配ErrNotSent及原错误
+func NotSent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &notSentError{cause: err}
+}
+
+type notSentError struct {
+	cause error
+}
+
+func (e *notSentError) Error() string { return e.cause.Error() }
+
+func (e *notSentError) Unwrap() error { return e.cause }
+
+func (e *notSentError) Is(target error) bool { return target == ErrNotSent }
+
+// IsRetryable 判断错误是否可以重试
+// 注意：网络错误可重试，但创建类接口重试前应先查询确认结果
+func IsRetryable(err error) bool {
+	return errors.Is(err, ErrRetryable)
+}
+
 // Wrap用来包装error，以提供trace信息帮助使用者debug
 // 该方法借鉴了github.com/pkg/errors 包
 func Wrap(err error, message string) error {
@@ -48,3 +159,6 @@ func (w *WithMessage) Error() string { return w.msg + ": " + w.cause.Error() }
 
 // Cause函数用来提取原生error
 func (w *WithMessage) Cause() error { return w.cause }
+
+// Unwrap 支持标准库errors.Is/errors.As
+func (w *WithMessage) Unwrap() error { return w.cause }
@@ -0,0 +1,160 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Category 为请求失败错误的分类
+type Category int
+
+const (
+	CategoryUnknown             Category = iota // 未收录的错误码，按不可重试处理
+	CategorySystem                              // 财经后端系统错误，可重试
+	CategoryInvalidParam                        // 参数错误
+	CategoryAuth                                // 权限不足、app_id/merchant_id无效等
+	CategorySignature                           // 签名错误
+	CategoryDuplicateOrder                      // 重复下单/重复退款
+	CategoryInsufficientBalance                 // 余额不足（提现）
+	CategoryBusiness                            // 其他业务失败
+	CategoryOrderNotExist                       // 订单/退款单/提现单不存在
+)
+
+func (c Category) String() string {
+	switch c {
+	case CategorySystem:
+		return "system"
+	case CategoryInvalidParam:
+		return "invalid_param"
+	case CategoryAuth:
+		return "auth"
+	case CategorySignature:
+		return "signature"
+	case CategoryDuplicateOrder:
+		return "duplicate_order"
+	case CategoryInsufficientBalance:
+		return "insufficient_balance"
+	case CategoryBusiness:
+		return "business"
+	case CategoryOrderNotExist:
+		return "order_not_exist"
+	}
+	return "unknown"
+}
+
+// Retryable 判断该分类的错误是否可以重试
+func (c Category) Retryable() bool {
+	return c == CategorySystem
+}
+
+// Matches 判断target是否为该分类对应的哨兵错误，用于实现errors.Is
+func (c Category) Matches(target error) bool {
+	for _, s := range c.sentinels() {
+		if s == target {
+			return true
+		}
+	}
+	return false
+}
+
+// 分类对应的哨兵错误，用于errors.Is
+func (c Category) sentinels() []error {
+	ret := make([]error, 0, 2)
+	switch c {
+	case CategoryInvalidParam:
+		ret = append(ret, ErrInvalidParam)
+	case CategoryAuth:
+		ret = append(ret, ErrAuth)
+	case CategorySignature:
+		ret = append(ret, ErrSignature)
+	case CategoryDuplicateOrder:
+		ret = append(ret, ErrDuplicateOrder)
+	case CategoryInsufficientBalance:
+		ret = append(ret, ErrInsufficientBalance)
+	case CategoryOrderNotExist:
+		ret = append(ret, ErrOrderNotExist)
+	}
+	if c.Retryable() {
+		ret = append(ret, ErrRetryable)
+	} else {
+		ret = append(ret, ErrPermanent)
+	}
+	return ret
+}
+
+var (
+	codeTableLock sync.RWMutex
+
+	// 网关公共返回码
+	codeTable = map[string]Category{
+		"20000": CategorySystem,       // 服务不可用
+		"20001": CategoryAuth,         // 授权权限不足
+		"40001": CategoryInvalidParam, // 缺少必选参数
+		"40002": CategoryInvalidParam, // 非法的参数
+		"40004": CategoryBusiness,     // 业务处理失败，具体原因见sub_code
+		"40006": CategoryAuth,         // 权限不足
+	}
+
+	// 已知的业务返回码，优先级高于公共返回码
+	// 只预置有文档依据的sub_code（见client.go中success的响应示例），
+	// 其余如订单不存在、重复下单等sub_code以财经侧接口文档为准，由接入方通过RegisterSubCode收录；
+	// 依赖这些分类的组件（idempotency、payout、RefundPlanner、expiry）在初始化时通过RequireCategories检查
+	subCodeTable = map[string]Category{
+		"TP.SYSTEM_ERROR": CategorySystem,
+	}
+)
+
+// LookupCategory 查询错误码对应的分类，sub_code未收录时按code查询
+func LookupCategory(code, subCode string) Category {
+	codeTableLock.RLock()
+	defer codeTableLock.RUnlock()
+	if c, ok := subCodeTable[subCode]; ok {
+		return c
+	}
+	if c, ok := codeTable[code]; ok {
+		return c
+	}
+	return CategoryUnknown
+}
+
+// RegisterSubCode 收录新的sub_code，已存在时覆盖
+func RegisterSubCode(subCode string, c Category) {
+	codeTableLock.Lock()
+	defer codeTableLock.Unlock()
+	subCodeTable[subCode] = c
+}
+
+// UnregisterSubCode 移除已收录的sub_code
+func UnregisterSubCode(subCode string) {
+	codeTableLock.Lock()
+	defer codeTableLock.Unlock()
+	delete(subCodeTable, subCode)
+}
+
+// ErrSubCodeNotRegistered 所需分类没有收录任何sub_code
+var ErrSubCodeNotRegistered = errors.New("tt_pay: sub_code not registered")
+
+// RequireCategories 检查每个分类都至少收录了一个sub_code，缺少时返回ErrSubCodeNotRegistered
+// 用于依赖ErrOrderNotExist、ErrDuplicateOrder等哨兵错误的组件在初始化时提前报错
+func RequireCategories(cs ...Category) error {
+	codeTableLock.RLock()
+	defer codeTableLock.RUnlock()
+	var missing []string
+	for _, c := range cs {
+		found := false
+		for _, sc := range subCodeTable {
+			if sc == c {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, c.String())
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %v, register them with util.RegisterSubCode", ErrSubCodeNotRegistered, missing)
+	}
+	return nil
+}
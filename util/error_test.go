@@ -0,0 +1,175 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestErrorCategories(t *testing.T) {
+	// 样例sub_code，实际值以财经侧接口文档为准
+	samples := map[string]Category{
+		"TP.ORDER_EXISTS":       CategoryDuplicateOrder,
+		"TP.BALANCE_NOT_ENOUGH": CategoryInsufficientBalance,
+		"TP.REFUND_NOT_EXIST":   CategoryOrderNotExist,
+	}
+	for code, c := range samples {
+		RegisterSubCode(code, c)
+	}
+	t.Cleanup(func() {
+		for code := range samples {
+			UnregisterSubCode(code)
+		}
+	})
+	cases := []struct {
+		name  string
+		err   error
+		is    []error
+		isNot []error
+	}{
+		{
+			name:  "system error",
+			err:   &Error{Code: "20000", SubCode: "TP.SYSTEM_ERROR"},
+			is:    []error{ErrBusiness, ErrRetryable},
+			isNot: []error{ErrPermanent, ErrNetwork},
+		},
+		{
+			name:  "invalid param by code",
+			err:   &Error{Code: "40002", SubCode: "TP.SOMETHING_NEW"},
+			is:    []error{ErrBusiness, ErrInvalidParam, ErrPermanent},
+			isNot: []error{ErrRetryable},
+		},
+		{
+			name: "duplicate order",
+			err:  Wrap(&Error{Code: "40004", SubCode: "TP.ORDER_EXISTS"}, "RefundCreate failed"),
+			is:   []error{ErrBusiness, ErrDuplicateOrder, ErrPermanent},
+		},
+		{
+			name: "insufficient balance",
+			err:  &Error{Code: "40004", SubCode: "TP.BALANCE_NOT_ENOUGH"},
+			is:   []error{ErrInsufficientBalance},
+		},
+		{
+			name:  "order not exist",
+			err:   &Error{Code: "40004", SubCode: "TP.REFUND_NOT_EXIST"},
+			is:    []error{ErrBusiness, ErrOrderNotExist, ErrPermanent},
+			isNot: []error{ErrDuplicateOrder},
+		},
+		{
+			name: "auth",
+			err:  &Error{Code: "40006"},
+			is:   []error{ErrAuth, ErrPermanent},
+		},
+		{
+			name:  "unknown code",
+			err:   &Error{Code: "99999"},
+			is:    []error{ErrBusiness, ErrPermanent},
+			isNot: []error{ErrRetryable, ErrInvalidParam},
+		},
+		{
+			name:  "network",
+			err:   Wrap(Wrap(NewNetworkError(context.DeadlineExceeded), "HttpPost failed"), "Execute failed"),
+			is:    []error{ErrNetwork, ErrRetryable, context.DeadlineExceeded},
+			isNot: []error{ErrBusiness, ErrPermanent},
+		},
+		{
+			name:  "canceled",
+			err:   Wrap(NewNetworkError(context.Canceled), "HttpPost failed"),
+			is:    []error{ErrNetwork, context.Canceled},
+			isNot: []error{ErrRetryable},
+		},
+		{
+			name:  "not sent",
+			err:   Wrap(NotSent(context.DeadlineExceeded), "Execute failed"),
+			is:    []error{ErrNotSent, context.DeadlineExceeded},
+			isNot: []error{ErrNetwork, ErrRetryable},
+		},
+		{
+			name:  "sent then timed out",
+			err:   Wrap(NewNetworkError(context.DeadlineExceeded), "HttpPost failed"),
+			is:    []error{ErrNetwork, ErrRetryable, context.DeadlineExceeded},
+			isNot: []error{ErrNotSent},
+		},
+		{
+			name: "5xx",
+			err:  NewStatusError(502),
+			is:   []error{ErrNetwork, ErrRetryable},
+		},
+		{
+			name:  "invalid sign",
+			err:   Wrap(ErrInvalidSign, "TradeNotify failed"),
+			is:    []error{ErrSignature, ErrPermanent},
+			isNot: []error{ErrBusiness},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			for _, target := range c.is {
+				if !errors.Is(c.err, target) {
+					t.Errorf("errors.Is(%v, %v) = false", c.err, target)
+				}
+			}
+			for _, target := range c.isNot {
+				if errors.Is(c.err, target) {
+					t.Errorf("errors.Is(%v, %v) = true", c.err, target)
+				}
+			}
+		})
+	}
+}
+
+func TestErrorsAs(t *testing.T) {
+	err := Wrap(&Error{Code: "40004", SubCode: "TP.TRADE_NOT_EXIST"}, "TradeQuery failed")
+	var tpErr *Error
+	if !errors.As(err, &tpErr) || tpErr.SubCode != "TP.TRADE_NOT_EXIST" {
+		t.Fatalf("errors.As failed: %v", err)
+	}
+	var netErr *NetworkError
+	if !errors.As(Wrap(NewStatusError(503), "Execute failed"), &netErr) || netErr.StatusCode != 503 {
+		t.Fatalf("errors.As NetworkError failed")
+	}
+}
+
+func TestRegisterSubCode(t *testing.T) {
+	err := &Error{Code: "40004", SubCode: "TP.CUSTOM_RETRY"}
+	if IsRetryable(err) {
+		t.Fatal("unregistered sub_code should not be retryable")
+	}
+	RegisterSubCode("TP.CUSTOM_RETRY", CategorySystem)
+	t.Cleanup(func() { UnregisterSubCode("TP.CUSTOM_RETRY") })
+	if !IsRetryable(err) || err.Category().String() != "system" {
+		t.Fatal("registered sub_code should be retryable")
+	}
+}
+
+func TestDefaultCodeTable(t *testing.T) {
+	// 默认码表：公共返回码与有文档依据的TP.SYSTEM_ERROR
+	if err := (&Error{Code: "20000", SubCode: "TP.SYSTEM_ERROR"}); !IsRetryable(err) || !errors.Is(err, ErrBusiness) {
+		t.Errorf("TP.SYSTEM_ERROR should be retryable")
+	}
+	notExist := &Error{Code: "40004", SubCode: "TP.REFUND_NOT_EXIST"}
+	if !errors.Is(notExist, ErrPermanent) || errors.Is(notExist, ErrOrderNotExist) || notExist.Category() != CategoryBusiness {
+		t.Errorf("unregistered sub_code should fall back to code: %s", notExist.Category())
+	}
+	if c := LookupCategory("40002", ""); c != CategoryInvalidParam {
+		t.Errorf("40002 = %s", c)
+	}
+	if c := LookupCategory("99999", "TP.UNKNOWN"); c != CategoryUnknown {
+		t.Errorf("unknown code = %s", c)
+	}
+
+	if err := RequireCategories(CategorySystem); err != nil {
+		t.Fatal(err)
+	}
+	err := RequireCategories(CategoryOrderNotExist, CategoryDuplicateOrder)
+	if !errors.Is(err, ErrSubCodeNotRegistered) || !strings.Contains(err.Error(), "order_not_exist") || !strings.Contains(err.Error(), "duplicate_order") {
+		t.Fatalf("expected both categories missing, got %v", err)
+	}
+	RegisterSubCode("TP.REFUND_NOT_EXIST", CategoryOrderNotExist)
+	t.Cleanup(func() { UnregisterSubCode("TP.REFUND_NOT_EXIST") })
+	err = RequireCategories(CategoryOrderNotExist, CategoryDuplicateOrder)
+	if !errors.Is(err, ErrSubCodeNotRegistered) || strings.Contains(err.Error(), "order_not_exist") {
+		t.Fatalf("expected only duplicate_order missing, got %v", err)
+	}
+}
@@ -1,8 +1,6 @@
 package util
 
 import (
-	"errors"
-	"fmt"
 	"github.com/bitly/go-simplejson"
 	"regexp"
 )
@@ -73,7 +71,7 @@ func init() {
 // 检查小程序版本，枚举值："1.0", "2.0", "2.0+"
 func CheckAppletVersion(version string) error {
 	if version != "1.0" && version != "2.0" && version != "2.0+" {
-		return fmt.Errorf(ErrorFormat, "AppletVersion", "AppletVersion can only be '1.0', '2.0' or '2.0+'")
+		return NewFieldError("AppletVersion", RuleEnum, "AppletVersion can only be '1.0', '2.0' or '2.0+'")
 	}
 	return nil
 }
@@ -82,7 +80,7 @@ func CheckAppletVersion(version string) error {
 func CheckAppId(appId string) error {
 	isMatch := appIdRegexp.MatchString(appId)
 	if !isMatch {
-		return fmt.Errorf(ErrorFormat, "AppId", MsgId)
+		return NewFieldError("AppId", RuleId, MsgId)
 	}
 	return nil
 }
@@ -90,14 +88,14 @@ func CheckAppId(appId string) error {
 func CheckMerchantId(merchantId string) error {
 	isMatch := merchantIdRegexp.MatchString(merchantId)
 	if !isMatch {
-		return fmt.Errorf(ErrorFormat, "MerchantId", MsgId)
+		return NewFieldError("MerchantId", RuleId, MsgId)
 	}
 	return nil
 }
 
 func CheckAppSecret(appSecret string) error {
 	if len(appSecret) == 0 {
-		return fmt.Errorf(ErrorFormat, "AppSecret", MsgRequired)
+		return NewFieldError("AppSecret", RuleRequired, MsgRequired)
 	}
 	return nil
 }
@@ -105,14 +103,14 @@ func CheckAppSecret(appSecret string) error {
 func CheckUid(uid string) error {
 	isMatch := uidRegExp.MatchString(uid)
 	if !isMatch {
-		return fmt.Errorf(ErrorFormat, "Uid", MsgId)
+		return NewFieldError("Uid", RuleId, MsgId)
 	}
 	return nil
 }
 
 func CheckBizContent(bizContent *simplejson.Json) error {
 	if bizContent == nil {
-		return fmt.Errorf(ErrorFormat, "bizContent", MsgNonnil)
+		return NewFieldError("bizContent", RuleNonnil, MsgNonnil)
 
 	}
 	return nil
@@ -120,21 +118,21 @@ func CheckBizContent(bizContent *simplejson.Json) error {
 
 func CheckSignType(signType string) error {
 	if signType != "MD5" {
-		return fmt.Errorf(ErrorFormat, "SignType", "Only MD5 is supported in current version")
+		return NewFieldError("SignType", RuleEq, "Only MD5 is supported in current version")
 	}
 	return nil
 }
 
 func CheckFormat(format string) error {
 	if format != "JSON" {
-		return fmt.Errorf(ErrorFormat, "Format", "Only JSON is supported in current verison")
+		return NewFieldError("Format", RuleEq, "Only JSON is supported in current verison")
 	}
 	return nil
 }
 
 func CheckCharset(charset string) error {
 	if charset != "utf-8" {
-		return fmt.Errorf(ErrorFormat, "Charset", "Only utf-8 is supported in current verison")
+		return NewFieldError("Charset", RuleEq, "Only utf-8 is supported in current verison")
 	}
 	return nil
 }
@@ -142,7 +140,7 @@ func CheckCharset(charset string) error {
 func CheckVersion(version string) error {
 	isMatch := versionRegExp.MatchString(version)
 	if !isMatch {
-		return fmt.Errorf(ErrorFormat, "Version", MsgVersion)
+		return NewFieldError("Version", RuleVersion, MsgVersion)
 	}
 	return nil
 }
@@ -150,7 +148,7 @@ func CheckVersion(version string) error {
 func CheckTimeStamp(timestamp string) error {
 	isMatch := timeStampRegExp.MatchString(timestamp)
 	if !isMatch {
-		return fmt.Errorf(ErrorFormat, "Timestamp", MsgNumber)
+		return NewFieldError("Timestamp", RuleNumber, MsgNumber)
 	}
 	return nil
 }
@@ -158,7 +156,7 @@ func CheckTimeStamp(timestamp string) error {
 func CheckTradeTime(tradeTime string) error {
 	isMatch := timeStampRegExp.MatchString(tradeTime)
 	if !isMatch {
-		return fmt.Errorf(ErrorFormat, "TradeTime", MsgNumber)
+		return NewFieldError("TradeTime", RuleNumber, MsgNumber)
 	}
 	return nil
 }
@@ -166,7 +164,7 @@ func CheckTradeTime(tradeTime string) error {
 func CheckValidTime(validTime string) error {
 	isMatch := timeStampRegExp.MatchString(validTime)
 	if !isMatch {
-		return fmt.Errorf(ErrorFormat, "ValidTime", MsgNumber)
+		return NewFieldError("ValidTime", RuleNumber, MsgNumber)
 	}
 	return nil
 }
@@ -174,7 +172,7 @@ func CheckValidTime(validTime string) error {
 func CheckOutRefundNo(outRefundNo string) error {
 	isMatch := outRefundNoRegExp.MatchString(outRefundNo)
 	if !isMatch {
-		return fmt.Errorf(ErrorFormat, "OutRefundNo", MsgId)
+		return NewFieldError("OutRefundNo", RuleId, MsgId)
 	}
 	return nil
 }
@@ -182,7 +180,7 @@ func CheckOutRefundNo(outRefundNo string) error {
 func CheckRefundNo(refundNo string) error {
 	isMatch := refundNoRegExp.MatchString(refundNo)
 	if !isMatch {
-		return fmt.Errorf(ErrorFormat, "RefundNo", MsgId)
+		return NewFieldError("RefundNo", RuleId, MsgId)
 	}
 	return nil
 }
@@ -190,7 +188,7 @@ func CheckRefundNo(refundNo string) error {
 func CheckNotifyUrl(url string) error {
 	isMatch := urlRegExp.MatchString(url)
 	if !isMatch {
-		return fmt.Errorf(ErrorFormat, "NotifyUrl", MsgUrl)
+		return NewFieldError("NotifyUrl", RuleUrl, MsgUrl)
 	}
 	return nil
 }
@@ -198,14 +196,14 @@ func CheckNotifyUrl(url string) error {
 func CheckReturnUrl(returnUrl string) error {
 	isMatch := urlRegExp.MatchString(returnUrl)
 	if !isMatch {
-		return fmt.Errorf(ErrorFormat, "ReturnUrl", MsgUrl)
+		return NewFieldError("ReturnUrl", RuleUrl, MsgUrl)
 	}
 	return nil
 }
 
 func CheckRefundAmount(num int) error {
 	if num <= 0 {
-		return fmt.Errorf(ErrorFormat, "RefundAmount", MsgInteger)
+		return NewFieldError("RefundAmount", RulePositive, MsgInteger)
 	}
 	return nil
 }
@@ -213,7 +211,7 @@ func CheckRefundAmount(num int) error {
 func CheckRiskInfo(riskInfo string) error {
 	isMatch := jsonRegExp.MatchString(riskInfo)
 	if !isMatch {
-		return fmt.Errorf(ErrorFormat, "RiskInfo", MsgJson)
+		return NewFieldError("RiskInfo", RuleJson, MsgJson)
 	}
 	return nil
 }
@@ -221,7 +219,7 @@ func CheckRiskInfo(riskInfo string) error {
 func CheckExtParam(extParam string) error {
 	isMatch := jsonRegExp.MatchString(extParam)
 	if !isMatch {
-		return fmt.Errorf(ErrorFormat, "ExtParam", MsgJson)
+		return NewFieldError("ExtParam", RuleJson, MsgJson)
 	}
 	return nil
 }
@@ -229,7 +227,7 @@ func CheckExtParam(extParam string) error {
 func CheckExt(ext string) error {
 	isMatch := jsonRegExp.MatchString(ext)
 	if !isMatch {
-		return fmt.Errorf(ErrorFormat, "Ext", MsgJson)
+		return NewFieldError("Ext", RuleJson, MsgJson)
 	}
 	return nil
 }
@@ -237,7 +235,7 @@ func CheckExt(ext string) error {
 func CheckSettlementExt(settlementExt string) error {
 	isMatch := jsonRegExp.MatchString(settlementExt)
 	if !isMatch {
-		return fmt.Errorf(ErrorFormat, "SettlementExt", MsgJson)
+		return NewFieldError("SettlementExt", RuleJson, MsgJson)
 	}
 	return nil
 }
@@ -245,7 +243,7 @@ func CheckSettlementExt(settlementExt string) error {
 func CheckParamsForApplet(params string) error {
 	isMatch := jsonRegExp.MatchString(params)
 	if !isMatch {
-		return fmt.Errorf(ErrorFormat, "Params", MsgJson)
+		return NewFieldError("Params", RuleJson, MsgJson)
 	}
 	return nil
 }
@@ -253,7 +251,7 @@ func CheckParamsForApplet(params string) error {
 func CheckLimitPay(limitPay string) error {
 	isMatch := jsonRegExp.MatchString(limitPay)
 	if !isMatch {
-		return fmt.Errorf(ErrorFormat, "LimitPay", MsgJson)
+		return NewFieldError("LimitPay", RuleJson, MsgJson)
 	}
 	return nil
 }
@@ -261,7 +259,7 @@ func CheckLimitPay(limitPay string) error {
 func CheckCashdeskExts(cashdeskExts string) error {
 	isMatch := jsonRegExp.MatchString(cashdeskExts)
 	if !isMatch {
-		return fmt.Errorf(ErrorFormat, "CashdeskExts", MsgJson)
+		return NewFieldError("CashdeskExts", RuleJson, MsgJson)
 	}
 	return nil
 }
@@ -269,7 +267,7 @@ func CheckCashdeskExts(cashdeskExts string) error {
 func CheckOutOrderNo(outOrderNo string) error {
 	isMatch := outOrderNoRegExp.MatchString(outOrderNo)
 	if !isMatch {
-		return fmt.Errorf(ErrorFormat, "OutOrderNo", MsgId)
+		return NewFieldError("OutOrderNo", RuleId, MsgId)
 	}
 	return nil
 }
@@ -277,133 +275,133 @@ func CheckOutOrderNo(outOrderNo string) error {
 func CheckTradeNo(tradeNo string) error {
 	isMatch := tradeNoRegExp.MatchString(tradeNo)
 	if !isMatch {
-		return fmt.Errorf(ErrorFormat, "TradeNo", MsgId)
+		return NewFieldError("TradeNo", RuleId, MsgId)
 	}
 	return nil
 }
 
 func CheckTotalAmount(totalAmount int) error {
 	if totalAmount <= 0 {
-		return fmt.Errorf(ErrorFormat, "TotalAmount", MsgInteger)
+		return NewFieldError("TotalAmount", RulePositive, MsgInteger)
 	}
 	return nil
 }
 
 func CheckUidType(uidType string) error {
 	if len(uidType) == 0 {
-		return errors.New("invalid param uidType")
+		return NewFieldError("UidType", RuleRequired, MsgRequired)
 	}
 	return nil
 }
 
 func CheckCurrency(currency string) error {
 	if currency == "" {
-		return fmt.Errorf(ErrorFormat, "Currency", MsgRequired)
+		return NewFieldError("Currency", RuleRequired, MsgRequired)
 	}
 	return nil
 }
 
 func CheckSubject(subject string) error {
 	if subject == "" {
-		return fmt.Errorf(ErrorFormat, "Subject", MsgRequired)
+		return NewFieldError("Subject", RuleRequired, MsgRequired)
 	}
 	return nil
 }
 
 func CheckBody(body string) error {
 	if body == "" {
-		return fmt.Errorf(ErrorFormat, "Body", MsgRequired)
+		return NewFieldError("Body", RuleRequired, MsgRequired)
 	}
 	return nil
 }
 
 func CheckProductCode(productCode string) error {
 	if len(productCode) == 0 {
-		return errors.New("invalid param: ProductCode")
+		return NewFieldError("ProductCode", RuleRequired, MsgRequired)
 	}
 	return nil
 }
 
 func CheckPaymentType(paymentType string) error {
 	if len(paymentType) == 0 {
-		return errors.New("invalid param： PaymentType")
+		return NewFieldError("PaymentType", RuleRequired, MsgRequired)
 	}
 	return nil
 }
 
 func CheckServiceFee(serviceFee string) error {
 	if len(serviceFee) == 0 {
-		return errors.New("invalid param: ServiceFee")
+		return NewFieldError("ServiceFee", RuleRequired, MsgRequired)
 	}
 	return nil
 }
 
 func CheckSettlementProductCode(settlementProductCode string) error {
 	if len(settlementProductCode) == 0 {
-		return errors.New("invalid param SettlementProductCode")
+		return NewFieldError("SettlementProductCode", RuleRequired, MsgRequired)
 	}
 	return nil
 }
 
 func CheckSellerMerchantId(sellerMerchantId string) error {
 	if len(sellerMerchantId) == 0 {
-		return errors.New("invalid param SellerMerchantId")
+		return NewFieldError("SellerMerchantId", RuleRequired, MsgRequired)
 	}
 	return nil
 }
 
 func CheckRoyaltyParameters(royaltyParameters string) error {
 	if len(royaltyParameters) == 0 {
-		return errors.New("invalid param: RoyaltyParameters")
+		return NewFieldError("RoyaltyParameters", RuleRequired, MsgRequired)
 	}
 	return nil
 }
 
 func CheckTransCode(transCode string) error {
 	if len(transCode) == 0 {
-		return errors.New("invalid param: TransCode")
+		return NewFieldError("TransCode", RuleRequired, MsgRequired)
 	}
 	return nil
 }
 
 func CheckCashDeskTradeType(tradeType string) error {
 	if len(tradeType) == 0 {
-		return errors.New("invalid param: CashDeskTradeType")
+		return NewFieldError("CashDeskTradeType", RuleRequired, MsgRequired)
 	}
 	return nil
 }
 
 func CheckPayChannel(payChannel string) error {
 	if len(payChannel) == 0 {
-		return errors.New("invalid param: PayChannel")
+		return NewFieldError("PayChannel", RuleRequired, MsgRequired)
 	}
 	return nil
 }
 
 func CheckPayType(payType string) error {
 	if len(payType) == 0 {
-		return errors.New("invalid param: PayType")
+		return NewFieldError("PayType", RuleRequired, MsgRequired)
 	}
 	return nil
 }
 
 func CheckOutTradeNo(outTradeNo string) error {
 	if len(outTradeNo) == 0 {
-		return errors.New("invalid patam: OutTradeNo")
+		return NewFieldError("OutTradeNo", RuleRequired, MsgRequired)
 	}
 	return nil
 }
 
 func CheckTradeName(tradeName string) error {
 	if len(tradeName) == 0 {
-		return errors.New("invalid patam: TradeName")
+		return NewFieldError("TradeName", RuleRequired, MsgRequired)
 	}
 	return nil
 }
 
 func CheckTradeDesc(tradeDesc string) error {
 	if len(tradeDesc) == 0 {
-		return errors.New("invalid patam: TradeDesc")
+		return NewFieldError("TradeDesc", RuleRequired, MsgRequired)
 	}
 	return nil
 }
@@ -0,0 +1,237 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// 整体脱敏时使用的掩码
+	RedactMask = "******"
+)
+
+// RedactPolicy 为Debug日志的脱敏策略
+// Keys中的字段在form参数、biz_content、响应json中都会被脱敏
+// RiskInfoKeys中的字段只在risk_info内脱敏
+// AppSecret、私钥等密钥信息不受策略控制，任何情况下都不会输出
+type RedactPolicy struct {
+	Keys         []string
+	RiskInfoKeys []string
+	// 脱敏后保留的明文前后缀长度，均为0时整体替换为RedactMask
+	KeepPrefix int
+	KeepSuffix int
+}
+
+var (
+	redactPolicyLock sync.RWMutex
+	redactPolicy     = DefaultRedactPolicy()
+)
+
+// DefaultRedactPolicy 返回默认脱敏策略
+func DefaultRedactPolicy() RedactPolicy {
+	return RedactPolicy{
+		Keys:         []string{"sign", "uid", "account", "name", "app_secret"},
+		RiskInfoKeys: []string{"ip", "client_ip", "device_id", "device", "imei", "idfa", "mac"},
+	}
+}
+
+// SetRedactPolicy 自定义脱敏策略，可与日志输出并发调用
+func SetRedactPolicy(p RedactPolicy) {
+	p.Keys = append([]string(nil), p.Keys...)
+	p.RiskInfoKeys = append([]string(nil), p.RiskInfoKeys...)
+	redactPolicyLock.Lock()
+	defer redactPolicyLock.Unlock()
+	redactPolicy = p
+}
+
+// GetRedactPolicy 返回当前脱敏策略
+func GetRedactPolicy() RedactPolicy {
+	redactPolicyLock.RLock()
+	defer redactPolicyLock.RUnlock()
+	return redactPolicy
+}
+
+// IsSensitive 判断字段是否需要脱敏
+func (p RedactPolicy) IsSensitive(key string) bool {
+	return containsKey(p.Keys, key)
+}
+
+// Mask 按策略对字段值脱敏
+// 值过短时不保留明文，避免前后缀拼出原值
+func (p RedactPolicy) Mask(val string) string {
+	if val == "" {
+		return ""
+	}
+	if p.KeepPrefix <= 0 && p.KeepSuffix <= 0 {
+		return RedactMask
+	}
+	runes := []rune(val)
+	if len(runes) <= 2*(p.KeepPrefix+p.KeepSuffix) {
+		return RedactMask
+	}
+	return string(runes[:p.KeepPrefix]) + RedactMask + string(runes[len(runes)-p.KeepSuffix:])
+}
+
+// MaskSecret 对密钥类信息脱敏，不保留任何明文及长度信息
+func MaskSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return RedactMask
+}
+
+// Sensitive 为账号、姓名等敏感信息，String、GoString及MarshalJSON按脱敏策略输出
+// 原值通过string(s)获取
+type Sensitive string
+
+func (s Sensitive) String() string {
+	return GetRedactPolicy().Mask(string(s))
+}
+
+func (s Sensitive) GoString() string {
+	return fmt.Sprintf("%q", s.String())
+}
+
+func (s Sensitive) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// RedactValue 按字段名对单个值脱敏
+// biz_content、risk_info等json字符串会递归脱敏
+func RedactValue(key, val string) string {
+	return GetRedactPolicy().redactValue(key, val)
+}
+
+// RedactMap 对加签参数等map脱敏，返回新的map，不修改入参
+func RedactMap(m map[string]interface{}) map[string]interface{} {
+	p := GetRedactPolicy()
+	ret := make(map[string]interface{}, len(m))
+	for key, val := range m {
+		if s, ok := val.(string); ok {
+			ret[key] = p.redactValue(key, s)
+			continue
+		}
+		if p.IsSensitive(key) {
+			ret[key] = p.Mask(fmt.Sprintf("%v", val))
+			continue
+		}
+		ret[key] = val
+	}
+	return ret
+}
+
+// RedactForm 对urlencoded格式的请求体脱敏
+// 无法解析时不输出原文
+func RedactForm(body string) string {
+	values, err := url.ParseQuery(body)
+	if err != nil {
+		return fmt.Sprintf("[unparseable form, %d bytes]", len(body))
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	p := GetRedactPolicy()
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		for _, val := range values[key] {
+			pairs = append(pairs, key+"="+p.redactValue(key, val))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// RedactJSON 对json格式的数据脱敏
+// 无法解析时不输出原文
+func RedactJSON(data []byte) string {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Sprintf("[unparseable json, %d bytes]", len(data))
+	}
+	p := GetRedactPolicy()
+	ret, err := json.Marshal(p.redactJSONValue("", v, p.Keys))
+	if err != nil {
+		return fmt.Sprintf("[unparseable json, %d bytes]", len(data))
+	}
+	return string(ret)
+}
+
+func (p RedactPolicy) redactValue(key, val string) string {
+	switch {
+	case p.IsSensitive(key):
+		return p.Mask(val)
+	case key == "risk_info":
+		return p.redactJSONString(val, p.RiskInfoKeys)
+	case strings.HasPrefix(strings.TrimSpace(val), "{"):
+		return p.redactJSONString(val, p.Keys)
+	}
+	return val
+}
+
+func (p RedactPolicy) redactJSONString(val string, keys []string) string {
+	var v interface{}
+	if err := json.Unmarshal([]byte(val), &v); err != nil {
+		// 无法解析的risk_info不能确定其中是否含设备信息，整体脱敏
+		if len(keys) > 0 && strings.TrimSpace(val) != "" {
+			return RedactMask
+		}
+		return val
+	}
+	ret, err := json.Marshal(p.redactJSONValue("", v, keys))
+	if err != nil {
+		return RedactMask
+	}
+	return string(ret)
+}
+
+func (p RedactPolicy) redactJSONValue(key string, v interface{}, keys []string) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		ret := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			ret[k] = p.redactJSONValue(k, item, keys)
+		}
+		return ret
+	case []interface{}:
+		ret := make([]interface{}, len(val))
+		for i, item := range val {
+			ret[i] = p.redactJSONValue(key, item, keys)
+		}
+		return ret
+	case string:
+		if containsKey(keys, key) {
+			return p.Mask(val)
+		}
+		if key == "risk_info" {
+			return p.redactJSONString(val, p.RiskInfoKeys)
+		}
+		if strings.HasPrefix(strings.TrimSpace(val), "{") {
+			return p.redactJSONString(val, keys)
+		}
+		return val
+	case nil:
+		return nil
+	default:
+		if containsKey(keys, key) {
+			return p.Mask(fmt.Sprintf("%v", val))
+		}
+		return val
+	}
+}
+
+func containsKey(keys []string, key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
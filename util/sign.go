@@ -22,7 +22,7 @@ func BuildMd5WithRsa(signMap map[string]interface{}, privateKey string) (string,
 
 	rsaSign, err := RsaSign(signStr, privateKey)
 	if err != nil {
-		Debug("BuildMd5WithRsa RsaSign sign str[%s] err[%s]\n", signStr, err)
+		Debug("BuildMd5WithRsa RsaSign sign map[%v] err[%s]\n", RedactMap(signMap), err)
 		return "", err
 	}
 
@@ -59,13 +59,13 @@ func RsaVerify(target, sign, publicKey string) bool {
 	targetHash := md5.Sum([]byte(target))
 	signByte, err := base64.StdEncoding.DecodeString(sign)
 	if err != nil {
-		Debug("RsaVerify base64 decode sign[%s] err[%s]\n", sign, err)
+		Debug("RsaVerify base64 decode sign[%s] err[%s]\n", RedactValue("sign", sign), err)
 		return false
 	}
 
 	err = rsa.VerifyPKCS1v15(pubRsaKey, crypto.MD5, targetHash[:], signByte)
 	if err != nil {
-		Debug("RsaVerify target[%s] sign[%s] public key[%s] failed\n", target, sign, publicKey)
+		Debug("RsaVerify sign[%s] public key[%s] failed\n", RedactValue("sign", sign), publicKey)
 		return false
 	}
 
@@ -76,7 +76,7 @@ func RsaVerify(target, sign, publicKey string) bool {
 func RsaSign(target, privateKey string) (string, error) {
 	block, _ := pem.Decode([]byte(privateKey))
 	if block == nil || block.Type != "RSA PRIVATE KEY" {
-		Debug("RsaSign got invalid private key[%s]\n", privateKey)
+		Debug("RsaSign got invalid private key[%s]\n", MaskSecret(privateKey))
 		Debug("pem decode private block is nil[%v]\n", block == nil)
 		if block != nil {
 			Debug("pem decode private block type[%s] not RSA PRIVATE KEY\n", block.Type)
@@ -86,7 +86,7 @@ func RsaSign(target, privateKey string) (string, error) {
 
 	priKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
 	if err != nil {
-		Debug("RsaSign x509.ParsePKCS1PrivateKey privateKey[%s] err[%s]\n", privateKey, err)
+		Debug("RsaSign x509.ParsePKCS1PrivateKey privateKey[%s] err[%s]\n", MaskSecret(privateKey), err)
 		return "", err
 	}
 
@@ -94,12 +94,12 @@ func RsaSign(target, privateKey string) (string, error) {
 
 	signed, err := rsa.SignPKCS1v15(rand.Reader, priKey, crypto.MD5, targetHash[:])
 	if err != nil {
-		Debug("RsaSign target[%s] private key[%s] failed\n", target, privateKey)
+		Debug("RsaSign private key[%s] failed\n", MaskSecret(privateKey))
 		return "", err
 	}
 
 	base64Sign := base64.StdEncoding.EncodeToString(signed)
-	Debug("RsaSign target[%s] privateKey[%s] to signed[%s]\n", target, privateKey, base64Sign)
+	Debug("RsaSign privateKey[%s] to signed[%s]\n", MaskSecret(privateKey), RedactValue("sign", base64Sign))
 	return base64Sign, nil
 }
 
@@ -107,8 +107,8 @@ func BuildMd5WithSalt(signMap map[string]interface{}, salt string) string {
 	signStr := GenSignStr(signMap)
 	finStr := signStr + salt
 	sign := fmt.Sprintf("%x", md5.Sum([]byte(finStr)))
-	Debug("BuildMd5WithSalt get sign[%s] from sign map[%#v] salt[%s] sign str[%s]\n",
-		sign, signMap, salt, finStr)
+	Debug("BuildMd5WithSalt get sign[%s] from sign map[%v] salt[%s]\n",
+		RedactValue("sign", sign), RedactMap(signMap), MaskSecret(salt))
 	return sign
 }
 
@@ -116,8 +116,8 @@ func BuildMd5WithSaltCtx(ctx context.Context, signMap map[string]interface{}, sa
 	signStr := GenSignStr(signMap)
 	finStr := signStr + salt
 	sign := fmt.Sprintf("%x", md5.Sum([]byte(finStr)))
-	Debug("Context: [%s], BuildMd5WithSalt get sign[%s] from sign map[%#v] salt[%s] sign str[%s]\n",
-		ctx, sign, signMap, salt, finStr)
+	Debug("Context: [%s], BuildMd5WithSalt get sign[%s] from sign map[%v] salt[%s]\n",
+		ctx, RedactValue("sign", sign), RedactMap(signMap), MaskSecret(salt))
 	return sign
 }
 
@@ -125,8 +125,8 @@ func BuildSha1WithSalt(signMap map[string]interface{}, salt string) string {
 	signStr := GenSignStr(signMap)
 	finStr := signStr + salt
 	sign := fmt.Sprintf("%x", sha1.Sum([]byte(finStr)))
-	Debug("BuildSha1WithSalt get sign[%s] from sign map[%#v] salt[%s] sign str[%s]\n",
-		sign, signMap, salt, finStr)
+	Debug("BuildSha1WithSalt get sign[%s] from sign map[%v] salt[%s]\n",
+		RedactValue("sign", sign), RedactMap(signMap), MaskSecret(salt))
 	return sign
 }
 
@@ -148,7 +148,7 @@ func GenSignStr(signMap map[string]interface{}) string {
 
 	sort.Strings(signArr)
 	ret := strings.Join(signArr, "&")
-	Debug("GenSignStr get ret str[%s] from params[%#v]\n", ret, signMap)
+	Debug("GenSignStr get ret str from params[%v]\n", RedactMap(signMap))
 	return ret
 }
 
@@ -167,7 +167,7 @@ func GenSignStrWithSign(signMap map[string]interface{}) string {
 
 	sort.Strings(signArr)
 	ret := strings.Join(signArr, "&")
-	Debug("GenSignStr get ret str[%s] from params[%#v]\n", ret, signMap)
+	Debug("GenSignStr get ret str from params[%v]\n", RedactMap(signMap))
 	return ret
 }
 
@@ -243,12 +243,13 @@ func VerifySign(ctx context.Context, data map[string]interface{}, secret string)
 		}
 		sign = rsaSign
 	default:
-		Debug("bad sign_type\n", ctx, reqSign, sign)
+		Debug("Context: [%s], bad sign_type[%v]\n", ctx, signType)
 		return false
 	}
 
 	if sign != reqSign {
-		Debug("Context: [%s], sign error req sign %s, computed sign %s\n", ctx, reqSign, sign)
+		Debug("Context: [%s], sign error req sign %s, computed sign %s\n",
+			ctx, RedactValue("sign", fmt.Sprintf("%v", reqSign)), RedactValue("sign", sign))
 		return false
 	}
 
@@ -269,10 +270,9 @@ func BuildRsaSign(params map[string]interface{}, privateKey string, digest strin
 }
 
 func RsaSignWithSha1(target, privateKey string) (string, error) {
-	Debug("signContent : [%s]\n", target)
 	block, _ := pem.Decode([]byte(privateKey))
 	if block == nil || block.Type != "RSA PRIVATE KEY" {
-		Debug("RsaSign got invalid private key[%s]\n", privateKey)
+		Debug("RsaSign got invalid private key[%s]\n", MaskSecret(privateKey))
 		Debug("pem decode private block is nil[%v]\n", block == nil)
 		if block != nil {
 			Debug("pem decode private block type[%s] not RSA PRIVATE KEY\n", block.Type)
@@ -282,7 +282,7 @@ func RsaSignWithSha1(target, privateKey string) (string, error) {
 
 	priKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
 	if err != nil {
-		Debug("RsaSign x509.ParsePKCS1PrivateKey privateKey[%s] err[%s]\n", privateKey, err)
+		Debug("RsaSign x509.ParsePKCS1PrivateKey privateKey[%s] err[%s]\n", MaskSecret(privateKey), err)
 		return "", err
 	}
 
@@ -290,12 +290,12 @@ func RsaSignWithSha1(target, privateKey string) (string, error) {
 
 	signed, err := rsa.SignPKCS1v15(rand.Reader, priKey, crypto.SHA1, targetHash[:])
 	if err != nil {
-		Debug("RsaSign target[%s] private key[%s] failed\n", target, privateKey)
+		Debug("RsaSign private key[%s] failed\n", MaskSecret(privateKey))
 		return "", err
 	}
 
 	base64Sign := base64.StdEncoding.EncodeToString(signed)
-	Debug("RsaSign target[%s] privateKey[%s] to signed[%s]\n", target, privateKey, base64Sign)
+	Debug("RsaSign privateKey[%s] to signed[%s]\n", MaskSecret(privateKey), RedactValue("sign", base64Sign))
 	return base64Sign, nil
 }
 
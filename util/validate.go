@@ -0,0 +1,256 @@
+package util
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 参数查验使用的struct tag
+//
+// 规则之间以逗号分隔，按顺序执行，例如：
+//
+//	OutOrderNo string `ttpay:"oneof=OutOrderNo|TradeNo,omitempty,id,max=32"`
+//
+// 目前支持的规则：
+//
+//	required         不能为零值
+//	omitempty        为零值时跳过后续规则
+//	id               只能包含数字、字母及'-'、'_'，长度由max限制，默认32
+//	max=N            与id配合，限制最大长度
+//	json             必须为json字符串
+//	url              必须为url
+//	number           只能包含数字（时间戳等）
+//	version          形如a.b的版本号
+//	positive         整数必须大于0
+//	min=N            整数不能小于N
+//	eq=V             必须等于V
+//	nonnil           指针不能为nil
+//	oneof=A|B        A、B两个字段不能都为空，错误记在"A|B"上
+//	requiredwith=F   字段F已填写（数值大于0）时必须填写
+//
+// 规则前加"场景:"前缀时，只在ValidateStruct传入该场景时生效，例如"v2:required"
+const TagName = "ttpay"
+
+const RegexpIdPattern = "^[0-9a-zA-Z-_]{1,%d}$"
+
+type tagRule struct {
+	scene string
+	name  string
+	arg   string
+}
+
+type fieldRules struct {
+	index []int
+	name  string
+	rules []tagRule
+}
+
+var (
+	rulesCache sync.Map // reflect.Type -> []fieldRules
+	idRegexps  sync.Map // max length -> *regexp.Regexp
+)
+
+// ValidateStruct 按ttpay tag查验结构体参数，收集所有不合法的参数
+// v必须是结构体或结构体指针，匿名嵌入的结构体（如config.Config）会一并查验
+func ValidateStruct(v interface{}, scenes ...string) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return NewFieldError("", RuleNonnil, MsgNonnil)
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("ValidateStruct: unsupported kind %s", rv.Kind())
+	}
+
+	validator := new(Validator)
+	for _, field := range structRules(rv.Type()) {
+		validateField(validator, rv, field, scenes)
+	}
+	return validator.Err()
+}
+
+func validateField(validator *Validator, structVal reflect.Value, field fieldRules, scenes []string) {
+	fv := structVal.FieldByIndex(field.index)
+	for _, rule := range field.rules {
+		if rule.scene != "" && !containsKey(scenes, rule.scene) {
+			continue
+		}
+		switch rule.name {
+		case "omitempty":
+			if fv.IsZero() {
+				return
+			}
+		case "oneof":
+			names := strings.Split(rule.arg, "|")
+			allEmpty := true
+			for _, name := range names {
+				if other := structVal.FieldByName(name); other.IsValid() && !other.IsZero() {
+					allEmpty = false
+				}
+			}
+			if allEmpty {
+				validator.Add(rule.arg, RuleOneOf, "can't both be blank")
+				return
+			}
+		case "requiredwith":
+			other := structVal.FieldByName(rule.arg)
+			if other.IsValid() && isSet(other) && fv.IsZero() {
+				validator.Add(field.name, RuleRequired, MsgRequired)
+				return
+			}
+		default:
+			if err := checkRule(field.name, rule, fv, field.rules); err != nil {
+				validator.Check(err)
+				// 同一字段只报告第一个错误
+				return
+			}
+		}
+	}
+}
+
+// 数值类字段大于0才视为已填写
+func isSet(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() > 0
+	}
+	return !v.IsZero()
+}
+
+func checkRule(name string, rule tagRule, fv reflect.Value, rules []tagRule) error {
+	switch rule.name {
+	case RuleRequired:
+		if fv.IsZero() {
+			return NewFieldError(name, RuleRequired, MsgRequired)
+		}
+	case RuleNonnil:
+		if fv.IsNil() {
+			return NewFieldError(name, RuleNonnil, MsgNonnil)
+		}
+	case RuleId:
+		max := 32
+		for _, r := range rules {
+			if r.name == "max" {
+				if n, err := strconv.Atoi(r.arg); err == nil {
+					max = n
+				}
+			}
+		}
+		if !idRegexp(max).MatchString(fv.String()) {
+			return NewFieldError(name, RuleId, MsgId)
+		}
+	case RuleJson:
+		if !jsonRegExp.MatchString(fv.String()) {
+			return NewFieldError(name, RuleJson, MsgJson)
+		}
+	case RuleUrl:
+		if !urlRegExp.MatchString(fv.String()) {
+			return NewFieldError(name, RuleUrl, MsgUrl)
+		}
+	case RuleNumber:
+		if !timeStampRegExp.MatchString(fv.String()) {
+			return NewFieldError(name, RuleNumber, MsgNumber)
+		}
+	case RuleVersion:
+		if !versionRegExp.MatchString(fv.String()) {
+			return NewFieldError(name, RuleVersion, MsgVersion)
+		}
+	case RulePositive:
+		if fv.Int() <= 0 {
+			return NewFieldError(name, RulePositive, MsgInteger)
+		}
+	case RuleMin:
+		min, _ := strconv.ParseInt(rule.arg, 10, 64)
+		if fv.Int() < min {
+			return NewFieldError(name, RuleMin, "must not be less than "+rule.arg)
+		}
+	case RuleEq:
+		if fieldString(fv) != rule.arg {
+			return NewFieldError(name, RuleEq, "must be "+rule.arg)
+		}
+	case "max":
+		// 仅作为id的参数
+	default:
+		return fmt.Errorf("ValidateStruct: unknown rule %q on %s", rule.name, name)
+	}
+	return nil
+}
+
+// 按类型取字段的字符串值，不调用Interface()，未导出字段同样可用
+func fieldString(fv reflect.Value) string {
+	switch fv.Kind() {
+	case reflect.String:
+		return fv.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(fv.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(fv.Uint(), 10)
+	case reflect.Bool:
+		return strconv.FormatBool(fv.Bool())
+	}
+	return fv.String()
+}
+
+func structRules(t reflect.Type) []fieldRules {
+	if cached, ok := rulesCache.Load(t); ok {
+		return cached.([]fieldRules)
+	}
+	ret := collectRules(t, nil)
+	rulesCache.Store(t, ret)
+	return ret
+}
+
+func collectRules(t reflect.Type, index []int) []fieldRules {
+	var ret []fieldRules
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		fieldIndex := append(append([]int(nil), index...), i)
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			ret = append(ret, collectRules(sf.Type, fieldIndex)...)
+			continue
+		}
+		tag, ok := sf.Tag.Lookup(TagName)
+		if !ok || tag == "" || tag == "-" {
+			continue
+		}
+		ret = append(ret, fieldRules{index: fieldIndex, name: sf.Name, rules: parseTag(tag)})
+	}
+	return ret
+}
+
+func parseTag(tag string) []tagRule {
+	parts := strings.Split(tag, ",")
+	rules := make([]tagRule, 0, len(parts))
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		var rule tagRule
+		if i := strings.Index(part, ":"); i >= 0 && !strings.Contains(part[:i], "=") {
+			rule.scene, part = part[:i], part[i+1:]
+		}
+		if i := strings.Index(part, "="); i >= 0 {
+			rule.name, rule.arg = part[:i], part[i+1:]
+		} else {
+			rule.name = part
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+func idRegexp(max int) *regexp.Regexp {
+	if re, ok := idRegexps.Load(max); ok {
+		return re.(*regexp.Regexp)
+	}
+	re := regexp.MustCompile(fmt.Sprintf(RegexpIdPattern, max))
+	idRegexps.Store(max, re)
+	return re
+}
@@ -0,0 +1,83 @@
+package util
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type embeddedParams struct {
+	AppId string `ttpay:"id,max=8"`
+}
+
+type tagParams struct {
+	embeddedParams
+	Amount  int    `ttpay:"a:min=0,b:positive"`
+	OrderNo string `ttpay:"oneof=OrderNo|TradeNo,omitempty,id,max=4"`
+	TradeNo string
+	Notify  string `ttpay:"omitempty,url"`
+	Ref     string `ttpay:"requiredwith=Amount"`
+}
+
+func TestValidateStruct(t *testing.T) {
+	tests := []struct {
+		name   string
+		params tagParams
+		scenes []string
+		want   string
+	}{
+		{"valid", tagParams{embeddedParams{"app"}, 0, "o1", "", "", ""}, nil, ""},
+		{"embedded max", tagParams{embeddedParams{"app_123456"}, 0, "o1", "", "", ""}, nil, "AppId:id"},
+		{"oneof", tagParams{embeddedParams{"app"}, 0, "", "", "", ""}, nil, "OrderNo|TradeNo:oneof"},
+		{"oneof other set", tagParams{embeddedParams{"app"}, 0, "", "t1", "", ""}, nil, ""},
+		{"id max", tagParams{embeddedParams{"app"}, 0, "o1234", "", "", ""}, nil, "OrderNo:id"},
+		{"omitempty then url", tagParams{embeddedParams{"app"}, 0, "o1", "", "x", ""}, nil, "Notify:url"},
+		{"scene a", tagParams{embeddedParams{"app"}, -1, "o1", "", "", ""}, []string{"a"}, "Amount:min"},
+		{"scene b", tagParams{embeddedParams{"app"}, 0, "o1", "", "", ""}, []string{"b"}, "Amount:positive"},
+		{"requiredwith", tagParams{embeddedParams{"app"}, 1, "o1", "", "", ""}, nil, "Ref:required"},
+		{"requiredwith negative", tagParams{embeddedParams{"app"}, -1, "o1", "", "", ""}, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateStruct(&tt.params, tt.scenes...)
+			var got []string
+			if err != nil {
+				var ve *ValidationError
+				if !errors.As(err, &ve) {
+					t.Fatalf("expected ValidationError, got %v", err)
+				}
+				for _, f := range ve.Fields {
+					got = append(got, f.Field+":"+f.Rule)
+				}
+			}
+			if strings.Join(got, ",") != tt.want {
+				t.Errorf("got %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateStructUnknownRule(t *testing.T) {
+	var params struct {
+		Name string `ttpay:"nosuchrule"`
+	}
+	err := ValidateStruct(params)
+	if err == nil || !strings.Contains(err.Error(), "nosuchrule") {
+		t.Fatalf("expected unknown rule error, got %v", err)
+	}
+}
+
+func TestValidateStructEq(t *testing.T) {
+	type params struct {
+		Version string `ttpay:"eq=2.0"`
+		count   int    `ttpay:"eq=1"`
+	}
+	if err := ValidateStruct(&params{Version: "2.0", count: 1}); err != nil {
+		t.Fatal(err)
+	}
+	err := ValidateStruct(&params{Version: "1.0"})
+	var ve *ValidationError
+	if !errors.As(err, &ve) || len(ve.Fields) != 2 || ve.Fields[1].Field != "count" {
+		t.Fatalf("expected eq errors, got %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// 参数查验规则名，出现在FieldError.Rule中
+const (
+	RuleRequired = "required"
+	RuleId       = "id"
+	RuleJson     = "json"
+	RuleUrl      = "url"
+	RuleNumber   = "number"
+	RulePositive = "positive"
+	RuleMin      = "min"
+	RuleVersion  = "version"
+	RuleNonnil   = "nonnil"
+	RuleEq       = "eq"
+	RuleEnum     = "enum"
+	RuleOneOf    = "oneof"
+)
+
+// FieldError 为单个参数的查验错误
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// NewFieldError 初始化FieldError
+func NewFieldError(field, rule, message string) *FieldError {
+	return &FieldError{Field: field, Rule: rule, Message: message}
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf(ErrorFormat, e.Field, e.Message)
+}
+
+func (e *FieldError) Is(target error) bool {
+	return target == ErrInvalidParam || target == ErrPermanent
+}
+
+// ValidationError 汇总了一次查验中所有不合法的参数
+type ValidationError struct {
+	Fields []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		msgs = append(msgs, f.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalidParam || target == ErrPermanent
+}
+
+// Field 返回指定参数的错误，不存在时返回nil
+func (e *ValidationError) Field(name string) *FieldError {
+	for _, f := range e.Fields {
+		if f.Field == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// MarshalJSON 输出可直接返回给调用方的json，格式为：
+//
+//	{"code": "invalid_param", "message": "...", "fields": [{"field": "Uid", "rule": "id", "message": "..."}]}
+func (e *ValidationError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Code    string        `json:"code"`
+		Message string        `json:"message"`
+		Fields  []*FieldError `json:"fields"`
+	}{
+		Code:    "invalid_param",
+		Message: e.Error(),
+		Fields:  e.Fields,
+	})
+}
+
+// Validator 用于收集多个参数的查验错误
+type Validator struct {
+	fields []*FieldError
+}
+
+// Check 收集CheckXxx函数的返回值，err为nil时忽略
+func (v *Validator) Check(err error) {
+	if err == nil {
+		return
+	}
+	if f, ok := err.(*FieldError); ok {
+		v.fields = append(v.fields, f)
+		return
+	}
+	if ve, ok := err.(*ValidationError); ok {
+		v.fields = append(v.fields, ve.Fields...)
+		return
+	}
+	v.fields = append(v.fields, NewFieldError("", "", err.Error()))
+}
+
+// Add 添加一个参数错误
+func (v *Validator) Add(field, rule, message string) {
+	v.fields = append(v.fields, NewFieldError(field, rule, message))
+}
+
+// Err 没有错误时返回nil，否则返回*ValidationError
+func (v *Validator) Err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: v.fields}
+}
@@ -0,0 +1,59 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestValidator(t *testing.T) {
+	v := new(Validator)
+	if v.Err() != nil {
+		t.Fatal("empty validator should return nil")
+	}
+	v.Check(CheckAppId("app_1"))
+	v.Check(CheckUid("bad uid"))
+	v.Check(CheckNotifyUrl("not a url"))
+	v.Add("OutOrderNo|TradeNo", RuleOneOf, "can't both be blank")
+
+	err := v.Err()
+	var ve *ValidationError
+	if !errors.As(err, &ve) || len(ve.Fields) != 3 {
+		t.Fatalf("expected 3 field errors, got %v", err)
+	}
+	if !errors.Is(Wrap(err, "RefundCreate failed"), ErrInvalidParam) {
+		t.Error("ValidationError should match ErrInvalidParam")
+	}
+	if f := ve.Field("Uid"); f == nil || f.Rule != RuleId || f.Error() != "invalid param: Uid "+MsgId {
+		t.Errorf("unexpected Uid error %+v", f)
+	}
+	if ve.Field("NotifyUrl").Rule != RuleUrl || ve.Field("OutOrderNo|TradeNo").Rule != RuleOneOf {
+		t.Errorf("unexpected rules %+v", ve.Fields)
+	}
+
+	var out struct {
+		Code   string
+		Fields []FieldError
+	}
+	b, err := json.Marshal(ve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Code != "invalid_param" || len(out.Fields) != 3 || out.Fields[0].Field != "Uid" {
+		t.Errorf("unexpected json %s", b)
+	}
+}
+
+func TestFieldErrorIs(t *testing.T) {
+	err := CheckTotalAmount(0)
+	var f *FieldError
+	if !errors.As(err, &f) || f.Field != "TotalAmount" || f.Rule != RulePositive {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !errors.Is(err, ErrInvalidParam) || errors.Is(err, ErrRetryable) {
+		t.Error("FieldError should be a permanent invalid param error")
+	}
+}
@@ -0,0 +1,202 @@
+package tt_pay
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/liaoxxxx/tt_pay/consts"
+	"github.com/liaoxxxx/tt_pay/util"
+)
+
+func TestCheckParamsAggregatesErrors(t *testing.T) {
+	req := NewRefundCreateRequest(testConfig("http://127.0.0.1:1"))
+	req.Uid = "bad uid"
+	req.OutRefundNo = ""
+	req.RefundAmount = 0
+	req.NotifyUrl = "not a url"
+	req.RiskInfo = "not json"
+
+	_, err := RefundCreate(context.Background(), req)
+	var ve *util.ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+	want := []string{"Uid", "OutOrderNo|TradeNo", "OutRefundNo", "RefundAmount", "NotifyUrl", "RiskInfo"}
+	if len(ve.Fields) != len(want) {
+		t.Fatalf("expected %d field errors, got %v", len(want), ve)
+	}
+	for i, field := range want {
+		if ve.Fields[i].Field != field {
+			t.Errorf("field %d: got %s, want %s", i, ve.Fields[i].Field, field)
+		}
+	}
+}
+
+func validTradeCreateRequest() *TradeCreateRequest {
+	req := NewTradeCreateRequest(testConfig(""))
+	req.OutOrderNo = "order_1"
+	req.Uid = testUid
+	req.TotalAmount = 1
+	req.Currency = "CNY"
+	req.Subject = "subject"
+	req.Body = "body"
+	req.TradeTime = time.Unix(1565000000, 0)
+	req.ValidTime = 5 * time.Minute
+	req.NotifyUrl = "https://example.com/notify"
+	req.RiskInfo = `{"ip":"` + testIp + `"}`
+	req.ProductCode = "pay"
+	req.PaymentType = "direct"
+	req.TradeType = "H5"
+	return req
+}
+
+func validWithdrawCreateRequest(withLogin bool) *WithdrawCreateRequest {
+	req := NewWithdrawCreateRequest(testConfig(""))
+	req.WithLogin = withLogin
+	req.ProductCode = "withdraw"
+	req.PaymentType = "direct"
+	if withLogin {
+		return req
+	}
+	req.OutTradeNo = "w_order_1"
+	req.Uid = testUid
+	req.TotalAmount = 1
+	req.Currency = "CNY"
+	req.TradeName = "name"
+	req.TradeDesc = "desc"
+	req.TradeTime = time.Unix(1565000000, 0)
+	req.ValidTime = 5 * time.Minute
+	req.NotifyUrl = "https://example.com/notify"
+	req.RiskInfo = `{"ip":"` + testIp + `"}`
+	return req
+}
+
+// 与原手写checkParams的规则逐条对照
+func TestCheckParamsParity(t *testing.T) {
+	tests := []struct {
+		name  string
+		check func() error
+		want  []string // Field:Rule
+	}{
+		{"trade create 1.0 valid", func() error {
+			return validTradeCreateRequest().checkParams()
+		}, nil},
+		{"trade create 1.0 ignores 2.0 params", func() error {
+			req := validTradeCreateRequest()
+			req.ProductCode, req.PaymentType, req.TradeType, req.ValidTime = "", "", "", -time.Second
+			return req.checkParams()
+		}, nil},
+		{"trade create 2.0 params", func() error {
+			req := validTradeCreateRequest()
+			req.ProductCode, req.PaymentType, req.TradeType, req.ValidTime = "", "", "", -time.Second
+			return req.checkParams(sceneV2)
+		}, []string{"TradeType:required", "ProductCode:required", "PaymentType:required", "ValidTime:positive"}},
+		{"trade create common params", func() error {
+			req := validTradeCreateRequest()
+			req.AppId = "bad app id"
+			req.MerchantId = ""
+			req.Format, req.Charset, req.SignType = "XML", "gbk", "RSA"
+			req.Timestamp, req.Version = "now", "1"
+			req.bizContent = nil
+			req.OutOrderNo = strings.Repeat("a", 33)
+			req.Uid = ""
+			req.TotalAmount = 0
+			req.Currency, req.Subject, req.Body = "", "", ""
+			req.TradeTime, req.NotifyUrl, req.RiskInfo = time.Time{}, "x", "x"
+			return req.checkParams()
+		}, []string{"AppId:id", "MerchantId:id", "Format:eq", "Charset:eq", "SignType:eq",
+			"Timestamp:number", "Version:version", "bizContent:nonnil", "OutOrderNo:id", "Uid:id",
+			"TotalAmount:positive", "Currency:required", "Subject:required", "Body:required",
+			"TradeTime:required", "NotifyUrl:url", "RiskInfo:json"}},
+		{"trade query oneof", func() error {
+			req := NewTradeQueryRequest(testConfig(""))
+			req.Uid = testUid
+			return req.checkParams()
+		}, []string{"OutOrderNo|TradeNo:oneof"}},
+		{"trade query optional ids", func() error {
+			req := NewTradeQueryRequest(testConfig(""))
+			req.Method = consts.MethodTradeCreate
+			req.Uid = testUid
+			req.OutOrderNo = strings.Repeat("a", 33)
+			req.TradeNo = strings.Repeat("a", 64)
+			return req.checkParams()
+		}, []string{"Method:eq", "OutOrderNo:id"}},
+		{"refund create", func() error {
+			req := NewRefundCreateRequest(testConfig(""))
+			req.Uid = testUid
+			req.TradeNo = "trade_1"
+			req.OutRefundNo = "refund_1"
+			req.RefundAmount = -1
+			req.NotifyUrl = "https://example.com/notify"
+			req.RiskInfo = "{}"
+			return req.checkParams()
+		}, []string{"RefundAmount:positive", "RiskInfo:json"}},
+		{"refund query", func() error {
+			req := NewRefundQueryRequest(testConfig(""))
+			req.Uid = testUid
+			req.RefundNo = "bad refund no"
+			return req.checkParams()
+		}, []string{"RefundNo:id"}},
+		{"refund query oneof", func() error {
+			req := NewRefundQueryRequest(testConfig(""))
+			req.Uid = testUid
+			return req.checkParams()
+		}, []string{"OutRefundNo|RefundNo:oneof"}},
+		{"withdraw query oneof", func() error {
+			return NewWithdrawQueryRequest(testConfig("")).checkParams()
+		}, []string{"OutTradeNo|WithdrawTradeNo:oneof"}},
+		{"withdraw login valid", func() error {
+			return validWithdrawCreateRequest(true).checkParams()
+		}, nil},
+		{"withdraw login optional params", func() error {
+			req := validWithdrawCreateRequest(true)
+			req.TotalAmount = -1
+			req.NotifyUrl, req.RiskInfo, req.Exts = "x", "x", "x"
+			req.ExtParam, req.SettlementExt = "x", "x"
+			return req.checkParams()
+		}, []string{"TotalAmount:min", "NotifyUrl:url", "RiskInfo:json", "Exts:json"}},
+		{"withdraw login amount requires out_trade_no", func() error {
+			req := validWithdrawCreateRequest(true)
+			req.TotalAmount = 100
+			req.ProductCode = "pay"
+			return req.checkParams()
+		}, []string{"OutTradeNo:required", "ProductCode:eq"}},
+		{"withdraw without login valid", func() error {
+			return validWithdrawCreateRequest(false).checkParams()
+		}, nil},
+		{"withdraw without login", func() error {
+			req := validWithdrawCreateRequest(false)
+			req.OutTradeNo = ""
+			req.Uid = ""
+			req.TotalAmount = 0
+			req.Currency, req.TradeName, req.TradeDesc = "", "", ""
+			req.TradeTime, req.ValidTime, req.NotifyUrl, req.RiskInfo = time.Time{}, 0, "", ""
+			req.PaymentType = ""
+			req.ExtParam, req.SettlementExt = "x", "x"
+			return req.checkParams()
+		}, []string{"Uid:id", "TotalAmount:positive", "Currency:required", "TradeName:required",
+			"TradeDesc:required", "PaymentType:required", "TradeTime:required", "ValidTime:positive",
+			"NotifyUrl:url", "ExtParam:json", "SettlementExt:json", "RiskInfo:json"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.check()
+			var got []string
+			if err != nil {
+				var ve *util.ValidationError
+				if !errors.As(err, &ve) {
+					t.Fatalf("expected ValidationError, got %v", err)
+				}
+				for _, f := range ve.Fields {
+					got = append(got, f.Field+":"+f.Rule)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
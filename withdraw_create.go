@@ -3,19 +3,21 @@ package tt_pay
 import (
 	"context"
 	"encoding/json"
-	"errors"
-	"fmt"
-	"github.com/bitly/go-simplejson"
 	"net/url"
 	"strconv"
-	"strings"
-	"time"
 
-	"github.com/liaoxxxx/tt_pay/config"
-	"github.com/liaoxxxx/tt_pay/consts"
+	"github.com/bitly/go-simplejson"
+
+	"github.com/liaoxxxx/tt_pay/store"
 	"github.com/liaoxxxx/tt_pay/util"
 )
 
+// 登录态及非登录态的查验场景
+const (
+	sceneWithLogin    = "login"
+	sceneWithoutLogin = "nologin"
+)
+
 // 提现下单接口
 func WithdrawCreate(ctx context.Context, req *WithdrawCreateRequest) (*WithdrawCreateResponse, error) {
 	if err := req.checkParams(); err != nil {
@@ -33,149 +35,19 @@ func WithdrawCreate(ctx context.Context, req *WithdrawCreateRequest) (*WithdrawC
 			return nil, util.Wrap(err, "WithdrawCreate failed when [Execute()]")
 		}
 	}
+	recordOrder(ctx, &store.Order{
+		Kind:       store.KindWithdraw,
+		MerchantId: req.MerchantId,
+		OutNo:      req.OutTradeNo,
+		TradeNo:    resp.WithdrawTradeNo,
+		Uid:        req.Uid,
+		Amount:     int64(req.TotalAmount),
+		Currency:   req.Currency,
+		Status:     store.StatusCreated,
+	}, store.SourceCreate)
 	return resp, nil
 }
 
-// 提现下单Request
-type WithdrawCreateRequest struct {
-	config.Config
-	WithLogin            bool // 此参数用来区分登录态及非登录态
-	Method               string
-	Format               string
-	Charset              string
-	SignType             string
-	Timestamp            string
-	Version              string
-	bizContent           *simplejson.Json
-	OutTradeNo           string
-	Uid                  string
-	TotalAmount          int
-	Currency             string
-	TradeName            string
-	TradeDesc            string
-	ProductCode          string
-	PaymentType          string
-	TradeTime            string
-	ValidTime            string
-	NotifyUrl            string
-	ReturnUrl            string
-	ExtParam             string
-	SettlementExt        string
-	RiskInfo             string
-	AccountType          string
-	SettlementProuctCode string
-	TransCode            string
-	Exts                 string
-	path                 string
-}
-
-// New函数内赋默认值，目前含默认值（或仅支持一个值的）参数包括：
-// Version = "1.0"
-// SignType = "MD5"
-// Format = "JSON"
-// Charset = "utf-8"
-// Path = "gateway"
-// Config.TPDomain = "https://tp-pay.snssdk.com"
-// Method 根据不同接口设置
-// Timestamp 自动设置Unix时间戳
-// 另外，注意初始化bizContent，以免出现nil指针错误
-func NewWithdrawCreateRequest(config config.Config) *WithdrawCreateRequest {
-	ret := new(WithdrawCreateRequest)
-	ret.Config = config
-	ret.Version = "1.0"
-	ret.SignType = "MD5"
-	ret.Format = "JSON"
-	ret.Charset = "utf-8"
-	ret.path = consts.TPPath
-	if len(ret.Config.TPDomain) == 0 {
-		ret.Config.TPDomain = consts.TPDomain
-	}
-	ret.Method = consts.MethodWithdrawCreate
-	ret.Timestamp = fmt.Sprintf("%d", time.Now().Unix())
-	ret.bizContent = simplejson.New()
-	return ret
-}
-
-// 将Request编码成POST请求的Body
-func (req *WithdrawCreateRequest) Encode() (string, error) {
-	//加签
-	req.bizContent.Set("out_trade_no", req.OutTradeNo)
-	req.bizContent.Set("uid", req.Uid)
-	req.bizContent.Set("merchant_id", req.MerchantId)
-	req.bizContent.Set("amount", req.TotalAmount)
-	req.bizContent.Set("currency", req.Currency)
-	req.bizContent.Set("trade_name", req.TradeName)
-	req.bizContent.Set("trade_desc", req.TradeDesc)
-	req.bizContent.Set("product_code", req.ProductCode)
-	req.bizContent.Set("payment_type", req.PaymentType)
-	req.bizContent.Set("trade_time", req.TradeTime)
-	req.bizContent.Set("valid_time", req.ValidTime)
-	req.bizContent.Set("notify_url", req.NotifyUrl)
-	req.bizContent.Set("return_url", req.ReturnUrl)
-	req.bizContent.Set("ext_param", req.ExtParam)
-	req.bizContent.Set("settlement_ext", req.SettlementExt)
-	req.bizContent.Set("risk_info", req.RiskInfo)
-	req.bizContent.Set("account_type", req.AccountType)
-	req.bizContent.Set("settlement_product_code", req.SettlementProuctCode)
-
-	// Json encode
-	bizContentBytes, err := req.bizContent.Encode()
-	if err != nil {
-		util.Debug("WithdrawCreateRequest Encode bizContent.Encode err: %s, bizContent %s\n", err, *req.bizContent)
-		return "", util.Wrap(err, "WithdrawCreateRequest Encode failed when [bizContent.Encode()]")
-	}
-
-	signParams := make(map[string]interface{})
-	signParams["app_id"] = req.Config.AppId
-	signParams["method"] = req.Method
-	signParams["format"] = req.Format
-	signParams["charset"] = req.Charset
-	signParams["sign_type"] = req.SignType
-	signParams["timestamp"] = req.Timestamp
-	signParams["version"] = req.Version
-	signParams["biz_content"] = string(bizContentBytes)
-
-	sign := util.BuildMd5WithSalt(signParams, req.Config.AppSecret)
-	// URL Encode
-	values := url.Values{}
-	values.Set("app_id", req.Config.AppId)
-	values.Set("method", req.Method)
-	values.Set("format", req.Format)
-	values.Set("charset", req.Charset)
-	values.Set("sign_type", req.SignType)
-	values.Set("sign", sign)
-	values.Set("timestamp", req.Timestamp)
-	values.Set("version", req.Version)
-	values.Set("biz_content", string(bizContentBytes))
-
-	return values.Encode(), nil
-}
-
-// GetLogId 生成该次请求logid
-func (req *WithdrawCreateRequest) GetLogId() string {
-	return fmt.Sprintf("%s_%s_%s_%s", req.AppId, req.MerchantId, req.OutTradeNo, req.Timestamp)
-}
-
-// GetUrl 获取请求url地址
-func (req *WithdrawCreateRequest) GetUrl() string {
-	return req.Config.TPDomain + "/" + req.path
-}
-
-// 提现下单响应
-type WithdrawCreateResponse struct {
-	Data            *simplejson.Json
-	WithdrawTradeNo string                 `json:"withdraw_trade_no"`
-	req             *WithdrawCreateRequest // 包含拉起收银台所需参数
-}
-
-// 初始化体现下单响应
-func NewWithdrawCreateResponse(req *WithdrawCreateRequest) *WithdrawCreateResponse {
-	ret := new(WithdrawCreateResponse)
-	ret.Data = simplejson.New()
-	ret.req = req
-	return ret
-}
-
 // 返回拉起sdk收银台已经签名好的参数对
 func (resp *WithdrawCreateResponse) GetCashdeskSdkParams() (string, error) {
 	cashdeskParams, err := resp.getCashdeskSdkParams()
@@ -195,13 +67,18 @@ func (resp *WithdrawCreateResponse) GetCashdeskWithdrawH5() (string, error) {
 	if err != nil {
 		return "", util.Wrap(err, "GetCashdeskWithdrawH5 failed when [resp.getCashdeskSdkParams()]")
 	}
+	return resp.withdrawH5Url(cashDeskParams), nil
+}
+
+// 以已签名的参数拼接H5收银台url
+func (resp *WithdrawCreateResponse) withdrawH5Url(cashDeskParams map[string]interface{}) string {
 	// url encode cashDeskParams
 	paramsForEncode := make(map[string][]string)
 	for key, val := range cashDeskParams {
 		paramsForEncode[key] = []string{val.(string)}
 	}
 	query := url.Values(paramsForEncode).Encode()
-	return resp.req.TPDomain + "/redPacketWithdraw?" + query, nil
+	return ActiveDomain(resp.req.Config) + "/redPacketWithdraw?" + query
 }
 
 // 内部函数，对参数加签
@@ -237,9 +114,9 @@ func (resp *WithdrawCreateResponse) getCashdeskSdkParams() (map[string]interface
 		}
 	}
 
-	// 在登录态，商户未传TotalAmount 且 exts参数里没有openid时，不需要加签
+	// 在登录态，商户未传TotalAmount 且 未指定openid时，不需要加签
 	// 反之，需要加签
-	if !(resp.req.WithLogin && resp.req.TotalAmount == 0 && !strings.Contains(resp.req.Exts, "openid")) {
+	if !(resp.req.WithLogin && resp.req.TotalAmount == 0 && resp.req.openId() == "") {
 		cashDeskParams["sign_type"] = resp.req.SignType
 		cashDeskParams["sign"] = util.BuildMd5WithSalt(cashDeskParams, resp.req.AppSecret)
 	}
@@ -253,223 +130,38 @@ func (resp *WithdrawCreateResponse) getCashdeskSdkParams() (map[string]interface
 	return cashDeskParams, nil
 }
 
-// 将响应json数据反序列化为对应接口
-func (resp *WithdrawCreateResponse) Decode() error {
-	respBytes, err := resp.Data.Get("response").Encode()
-	if err != nil {
-		return err
+// 收银台参数使用的openid，优先取OpenId，未设置时取Exts中顶层的openid字段
+func (req *WithdrawCreateRequest) openId() string {
+	if req.OpenId != "" || req.Exts == "" {
+		return req.OpenId
 	}
-	if err := json.Unmarshal(respBytes, resp); err != nil {
-		return err
+	var exts struct {
+		OpenId string `json:"openid"`
 	}
-	return nil
-}
-
-// 设置原始响应
-func (resp *WithdrawCreateResponse) SetData(data *simplejson.Json) {
-	resp.Data = data
+	json.Unmarshal([]byte(req.Exts), &exts)
+	return exts.OpenId
 }
 
-func (req *WithdrawCreateRequest) checkParams() error {
-	if req.WithLogin {
-		if err := req.checkParamsWithLogin(); err != nil {
-			return err
-		}
-	} else {
-		if err := req.checkParamsWithoutLogin(); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-func (req *WithdrawCreateRequest) checkParamsWithLogin() error {
-	if req.Method != consts.MethodWithdrawCreate {
-		return fmt.Errorf(util.ErrorFormat, "Method", "must be tp.withdraw.create")
-	}
-
-	if err := util.CheckFormat(req.Format); err != nil {
-		return err
-	}
-
-	if err := util.CheckCharset(req.Charset); err != nil {
-		return err
-	}
-
-	if err := util.CheckSignType(req.SignType); err != nil {
-		return err
-	}
-
-	if err := util.CheckTimeStamp(req.Timestamp); err != nil {
-		return err
-	}
-
-	if err := util.CheckVersion(req.Version); err != nil {
-		return err
-	}
-
-	if err := util.CheckBizContent(req.bizContent); err != nil {
-		return err
-	}
-
-	if err := util.CheckAppId(req.AppId); err != nil {
-		return err
-	}
-
-	if err := util.CheckMerchantId(req.MerchantId); err != nil {
-		return err
-	}
-
-	if req.ProductCode != "withdraw" {
-		return errors.New("invalid param: ProductCode")
-	}
-
-	if err := util.CheckPaymentType(req.PaymentType); err != nil {
-		return err
-	}
-
-	if req.TotalAmount < 0 {
-		return errors.New("invalid param: TotalAmount")
-	}
-
-	if req.NotifyUrl != "" {
-		if err := util.CheckNotifyUrl(req.NotifyUrl); err != nil {
-			return err
-		}
-	}
-
-	if req.RiskInfo != "" {
-		if err := util.CheckRiskInfo(req.RiskInfo); err != nil {
-			return err
-		}
-	}
-
-	// 这里区分商户指定提现金额和商户未指定提现金额的参数查验
-	if req.TotalAmount > 0 {
-		if err := util.CheckOutTradeNo(req.OutTradeNo); err != nil {
-			return err
-		}
-
-		if len(req.Exts) > 0 {
-			if err := util.CheckExt(req.Exts); err != nil {
-				return err
-			}
-		}
-	} else {
-		if len(req.Exts) > 0 {
-			if err := util.CheckExt(req.Exts); err != nil {
-				return err
-			}
+// 复制请求，bizContent单独复制以免互相影响
+func (req *WithdrawCreateRequest) clone() *WithdrawCreateRequest {
+	ret := *req
+	ret.bizContent = simplejson.New()
+	if m, err := req.bizContent.Map(); err == nil {
+		for k, v := range m {
+			ret.bizContent.Set(k, v)
 		}
 	}
-
-	return nil
+	return &ret
 }
 
-func (req *WithdrawCreateRequest) checkParamsWithoutLogin() error {
-	if req.Method != consts.MethodWithdrawCreate {
-		return fmt.Errorf(util.ErrorFormat, "Method", "must be tp.withdraw.create")
-	}
-
-	if err := util.CheckFormat(req.Format); err != nil {
-		return err
-	}
-
-	if err := util.CheckCharset(req.Charset); err != nil {
-		return err
-	}
-
-	if err := util.CheckSignType(req.SignType); err != nil {
-		return err
-	}
-
-	if err := util.CheckTimeStamp(req.Timestamp); err != nil {
-		return err
-	}
-
-	if err := util.CheckVersion(req.Version); err != nil {
-		return err
-	}
-
-	if err := util.CheckBizContent(req.bizContent); err != nil {
-		return err
-	}
-
-	if err := util.CheckAppId(req.AppId); err != nil {
-		return err
-	}
-
-	if err := util.CheckMerchantId(req.MerchantId); err != nil {
-		return err
-	}
-
-	if err := util.CheckTotalAmount(req.TotalAmount); err != nil {
-		return err
-	}
-
-	if req.OutTradeNo != "" {
-		if err := util.CheckOutTradeNo(req.OutTradeNo); err != nil {
-			return err
-		}
-	}
-
-	if err := util.CheckUid(req.Uid); err != nil {
-		return err
-	}
-
-	if err := util.CheckCurrency(req.Currency); err != nil {
-		return err
-	}
-
-	if err := util.CheckTradeName(req.TradeName); err != nil {
-		return err
-	}
-
-	if err := util.CheckTradeDesc(req.TradeDesc); err != nil {
-		return err
-	}
-
-	if err := util.CheckTradeTime(req.TradeTime); err != nil {
-		return err
-	}
-
-	if err := util.CheckValidTime(req.ValidTime); err != nil {
-		return err
-	}
-
-	if err := util.CheckNotifyUrl(req.NotifyUrl); err != nil {
-		return err
-	}
-
-	if err := util.CheckRiskInfo(req.RiskInfo); err != nil {
-		return err
-	}
-
-	if req.ProductCode != "withdraw" {
-		return errors.New("invalid param: ProductCode")
-	}
-
-	if err := util.CheckPaymentType(req.PaymentType); err != nil {
-		return err
-	}
-
-	if len(req.Exts) > 0 {
-		if err := util.CheckExt(req.Exts); err != nil {
-			return err
-		}
-	}
-
-	if len(req.ExtParam) > 0 {
-		if err := util.CheckExtParam(req.ExtParam); err != nil {
-			return err
-		}
-	}
-
-	if len(req.SettlementExt) > 0 {
-		if err := util.CheckSettlementExt(req.SettlementExt); err != nil {
-			return err
-		}
+// 参数查验，登录态与非登录态的规则不同，见字段的ttpay tag
+// AccountType的取值未见于网关文档，不在本地校验，由网关判断
+func (req *WithdrawCreateRequest) checkParams() error {
+	scene := sceneWithoutLogin
+	if req.WithLogin {
+		scene = sceneWithLogin
 	}
-
-	return nil
+	v := new(util.Validator)
+	v.Check(util.ValidateStruct(req, scene))
+	return v.Err()
 }
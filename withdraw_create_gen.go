@@ -0,0 +1,218 @@
+// Code generated by ttpaygen from schema/tp.withdraw.create.json. DO NOT EDIT.
+
+package tt_pay
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bitly/go-simplejson"
+
+	"github.com/liaoxxxx/tt_pay/config"
+	"github.com/liaoxxxx/tt_pay/consts"
+	"github.com/liaoxxxx/tt_pay/util"
+)
+
+// 提现下单Request
+type WithdrawCreateRequest struct {
+	config.Config
+	Method               string           `ttpay:"eq=tp.withdraw.create"`
+	Format               string           `ttpay:"eq=JSON"`
+	Charset              string           `ttpay:"eq=utf-8"`
+	SignType             string           `ttpay:"eq=MD5"`
+	Timestamp            string           `ttpay:"number"`
+	Version              string           `ttpay:"version"`
+	bizContent           *simplejson.Json `ttpay:"nonnil"`
+	path                 string
+	WithLogin            bool          // 此参数用来区分登录态及非登录态
+	OutTradeNo           string        `ttpay:"login:requiredwith=TotalAmount"`
+	Uid                  string        `ttpay:"nologin:id,max=32"`
+	TotalAmount          int           `ttpay:"login:min=0,nologin:positive"`
+	Currency             string        `ttpay:"nologin:required"`
+	TradeName            string        `ttpay:"nologin:required"`
+	TradeDesc            string        `ttpay:"nologin:required"`
+	ProductCode          string        `ttpay:"eq=withdraw"`
+	PaymentType          string        `ttpay:"required"`
+	TradeTime            time.Time     `ttpay:"nologin:required"` // 交易时间，编码为Unix时间戳
+	ValidTime            time.Duration `ttpay:"nologin:positive"` // 有效时长，编码为秒数
+	NotifyUrl            string        `ttpay:"login:omitempty,url"`
+	ReturnUrl            string
+	ExtParam             string      `ttpay:"nologin:omitempty,nologin:json"`
+	SettlementExt        string      `ttpay:"nologin:omitempty,nologin:json"`
+	RiskInfo             string      `ttpay:"login:omitempty,json"`
+	AccountType          AccountType // 收款账户类型，见AccountType*常量
+	SettlementProuctCode string
+	TransCode            string
+	Exts                 string `ttpay:"omitempty,json"`
+	OpenId               string // 用户openid，登录态设置后收银台参数需要加签，需与Exts中的openid一致
+}
+
+// New函数内赋默认值，目前含默认值（或仅支持一个值的）参数包括：
+// Version = "1.0"
+// SignType = "MD5"
+// Format = "JSON"
+// Charset = "utf-8"
+// Path = "gateway"，可通过SetPath改为"gateway-u"
+// Config.TPDomain = "https://tp-pay.snssdk.com"（未配置TPDomains时）
+// Method = "tp.withdraw.create"
+// Timestamp 自动设置为当前Unix时间戳，时间来源可通过SetClock替换
+// 另外，注意初始化bizContent，以免出现nil指针错误
+func NewWithdrawCreateRequest(config config.Config) *WithdrawCreateRequest {
+	ret := new(WithdrawCreateRequest)
+	ret.Config = config
+	ret.Version = "1.0"
+	ret.SignType = "MD5"
+	ret.Format = "JSON"
+	ret.Charset = "utf-8"
+	ret.path = consts.TPPath
+	if len(ret.Config.TPDomain) == 0 && len(ret.Config.TPDomains) == 0 {
+		ret.Config.TPDomain = consts.TPDomain
+	}
+	ret.Method = consts.MethodWithdrawCreate
+	ret.Timestamp = fmt.Sprintf("%d", Now().Unix())
+	ret.bizContent = simplejson.New()
+	return ret
+}
+
+// 将Request编码成POST请求的Body
+func (req *WithdrawCreateRequest) Encode() (string, error) {
+	bizContent, err := req.encodeBizContent()
+	if err != nil {
+		return "", err
+	}
+	return encodeGatewayForm(req.gatewayParams(), bizContent), nil
+}
+
+// 编码biz_content
+func (req *WithdrawCreateRequest) encodeBizContent() (string, error) {
+	req.bizContent.Set("out_trade_no", req.OutTradeNo)
+	req.bizContent.Set("uid", req.Uid)
+	req.bizContent.Set("merchant_id", req.MerchantId)
+	req.bizContent.Set("amount", req.TotalAmount)
+	req.bizContent.Set("currency", req.Currency)
+	req.bizContent.Set("trade_name", req.TradeName)
+	req.bizContent.Set("trade_desc", req.TradeDesc)
+	req.bizContent.Set("product_code", req.ProductCode)
+	req.bizContent.Set("payment_type", req.PaymentType)
+	req.bizContent.Set("trade_time", formatUnixTime(req.TradeTime))
+	req.bizContent.Set("valid_time", formatSeconds(req.ValidTime))
+	req.bizContent.Set("notify_url", req.NotifyUrl)
+	req.bizContent.Set("return_url", req.ReturnUrl)
+	req.bizContent.Set("ext_param", req.ExtParam)
+	req.bizContent.Set("settlement_ext", req.SettlementExt)
+	req.bizContent.Set("risk_info", req.RiskInfo)
+	req.bizContent.Set("account_type", req.AccountType)
+	req.bizContent.Set("settlement_product_code", req.SettlementProuctCode)
+
+	bizContentBytes, err := req.bizContent.Encode()
+	if err != nil {
+		util.Debug("WithdrawCreateRequest Encode bizContent.Encode err: %s, bizContent %v\n", err, util.RedactMap(req.bizContent.MustMap()))
+		return "", util.Wrap(err, "WithdrawCreateRequest Encode failed when [bizContent.Encode()]")
+	}
+
+	return string(bizContentBytes), nil
+}
+
+// 网关公共参数
+func (req *WithdrawCreateRequest) gatewayParams() gatewayParams {
+	return gatewayParams{
+		AppId:     req.Config.AppId,
+		AppSecret: req.Config.AppSecret,
+		Method:    req.Method,
+		Format:    req.Format,
+		Charset:   req.Charset,
+		SignType:  req.SignType,
+		Timestamp: req.Timestamp,
+		Version:   req.Version,
+	}
+}
+
+// 生成该次请求logid
+func (req *WithdrawCreateRequest) GetLogId() string {
+	id := req.OutTradeNo
+	return fmt.Sprintf("%s_%s_%s_%s", req.Config.AppId, req.Config.MerchantId, id, req.Timestamp)
+}
+
+// 获取请求url地址，配置多个域名时使用当前可用的域名
+func (req *WithdrawCreateRequest) GetUrl() string {
+	return ActiveDomain(req.Config) + "/" + req.path
+}
+
+// 获取请求路径，切换域名时与各域名拼接
+func (req *WithdrawCreateRequest) GetPath() string {
+	return req.path
+}
+
+// 设置请求路径，可选consts.TPPath（默认）或consts.TPPathU
+// 两者加签方式相同，响应的解析见Decode
+func (req *WithdrawCreateRequest) SetPath(path string) {
+	req.path = path
+}
+
+// 获取接口方法名
+func (req *WithdrawCreateRequest) GetMethod() string {
+	return req.Method
+}
+
+// 订单号，用于链路追踪
+func (req *WithdrawCreateRequest) orderAttributes() map[string]string {
+	return map[string]string{
+		"out_trade_no": req.OutTradeNo,
+	}
+}
+
+// 输出请求参数，AppSecret已脱敏
+func (req *WithdrawCreateRequest) String() string {
+	return formatRequest(req)
+}
+
+// 用于%#v输出，AppSecret已脱敏
+func (req *WithdrawCreateRequest) GoString() string {
+	return formatRequest(req)
+}
+
+// 提供该接口，方便业务方设置可选参数，比如product_code、payment_type等
+func (req *WithdrawCreateRequest) SetBizContentKV(key string, val interface{}) {
+	req.bizContent.Set(key, val)
+}
+
+// 提现下单响应
+type WithdrawCreateResponse struct {
+	Data            *simplejson.Json
+	WithdrawTradeNo string                 `json:"withdraw_trade_no"`
+	req             *WithdrawCreateRequest // 包含拉起收银台所需参数
+}
+
+// 初始化提现下单响应
+func NewWithdrawCreateResponse(req *WithdrawCreateRequest) *WithdrawCreateResponse {
+	ret := new(WithdrawCreateResponse)
+	ret.Data = simplejson.New()
+	ret.req = req
+	return ret
+}
+
+// 将响应json数据反序列化为对应接口
+func (resp *WithdrawCreateResponse) Decode() error {
+	var respBytes []byte
+	var err error
+	// 走网关的接口拿到的参数在response里，否则（如gateway-u）在data里
+	switch resp.Data.Get("response").Interface() {
+	case nil:
+		respBytes, err = resp.Data.Get("data").Encode()
+	default:
+		respBytes, err = resp.Data.Get("response").Encode()
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(respBytes, resp); err != nil {
+		return err
+	}
+	return nil
+}
+
+// 设置原始响应
+func (resp *WithdrawCreateResponse) SetData(data *simplejson.Json) {
+	resp.Data = data
+}
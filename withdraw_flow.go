@@ -0,0 +1,145 @@
+package tt_pay
+
+import (
+	"context"
+	"errors"
+
+	"github.com/liaoxxxx/tt_pay/config"
+	"github.com/liaoxxxx/tt_pay/consts"
+	"github.com/liaoxxxx/tt_pay/util"
+)
+
+// WithdrawMode 提现模式
+type WithdrawMode int
+
+const (
+	WithdrawWithoutLogin WithdrawMode = iota // 非登录态：商户先调用网关下单，再拉起收银台
+	WithdrawWithLogin                        // 登录态：不调用网关，用户在收银台登录后下单
+)
+
+func (m WithdrawMode) String() string {
+	if m == WithdrawWithLogin {
+		return sceneWithLogin
+	}
+	return sceneWithoutLogin
+}
+
+// WithdrawExts 为提现的exts参数，编码为JSON对象
+type WithdrawExts struct {
+	OpenId string                 // 用户openid，登录态设置后收银台参数需要加签
+	Extra  map[string]interface{} // 其他参数，与OpenId同名时以OpenId为准
+}
+
+func (e WithdrawExts) encode() (string, error) {
+	if e.OpenId == "" && len(e.Extra) == 0 {
+		return "", nil
+	}
+	m := make(map[string]interface{}, len(e.Extra)+1)
+	for k, v := range e.Extra {
+		m[k] = v
+	}
+	if e.OpenId != "" {
+		m["openid"] = e.OpenId
+	}
+	return util.JsonMarshal(m)
+}
+
+// WithdrawResult 为提现下单结果，可通过ApplyNotify、Refresh跟踪提现状态
+type WithdrawResult struct {
+	Mode            WithdrawMode
+	OutTradeNo      string
+	WithdrawTradeNo string // 非登录态下单时返回，登录态在回调或查询后获得
+	Status          string // 提现状态，见consts.WithdrawStatus*，下单后为空
+	SdkParams       string // 拉起sdk收银台的参数
+	H5Url           string // 拉起H5收银台的url
+	Signed          bool   // 收银台参数是否已加签
+
+	config config.Config
+}
+
+// StartWithdraw 按mode提现下单并生成收银台参数，不修改req
+// 下单使用req的副本，WithLogin由mode决定，exts非空时覆盖Exts，exts.OpenId决定登录态是否加签
+func StartWithdraw(ctx context.Context, req *WithdrawCreateRequest, mode WithdrawMode, exts WithdrawExts) (*WithdrawResult, error) {
+	req = req.clone()
+	req.WithLogin = mode == WithdrawWithLogin
+	s, err := exts.encode()
+	if err != nil {
+		return nil, util.Wrap(err, "StartWithdraw failed when [exts.encode()]")
+	}
+	if s != "" {
+		req.Exts = s
+		req.OpenId = exts.OpenId
+	}
+	resp, err := WithdrawCreate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	params, err := resp.getCashdeskSdkParams()
+	if err != nil {
+		return nil, util.Wrap(err, "StartWithdraw failed when [resp.getCashdeskSdkParams()]")
+	}
+	result := &WithdrawResult{
+		Mode:            mode,
+		OutTradeNo:      req.OutTradeNo,
+		WithdrawTradeNo: resp.WithdrawTradeNo,
+		config:          req.Config,
+	}
+	// 签名状态、sdk参数及H5链接均取自同一份参数
+	_, result.Signed = params["sign"]
+	if result.SdkParams, err = util.JsonMarshal(params); err != nil {
+		return nil, util.Wrap(err, "StartWithdraw failed when [JsonMarshal()]")
+	}
+	result.H5Url = resp.withdrawH5Url(params)
+	return result, nil
+}
+
+// Done 提现是否已有最终结果
+func (r *WithdrawResult) Done() bool {
+	return r.Status == consts.WithdrawStatusSuccess || r.Status == consts.WithdrawStatusFail
+}
+
+// ApplyNotify 以提现回调更新结果，回调不属于该提现时返回false
+// 登录态下单时没有withdraw_trade_no，以回调中的为准
+func (r *WithdrawResult) ApplyNotify(resp *WithdrawNotifyResponse) bool {
+	if resp.MerchantId != r.config.MerchantId {
+		return false
+	}
+	if !r.match(resp.OutTradeNo, resp.WithdrawTradeNo) {
+		return false
+	}
+	r.update(resp.OutTradeNo, resp.WithdrawTradeNo, resp.WithdrawStatus)
+	return true
+}
+
+// Refresh 查询提现状态并更新结果
+func (r *WithdrawResult) Refresh(ctx context.Context) (*WithdrawQueryResponse, error) {
+	if r.OutTradeNo == "" && r.WithdrawTradeNo == "" {
+		return nil, errors.New("tt_pay: withdraw has neither out_trade_no nor withdraw_trade_no")
+	}
+	req := NewWithdrawQueryRequest(r.config)
+	req.OutTradeNo = r.OutTradeNo
+	req.WithdrawTradeNo = r.WithdrawTradeNo
+	resp, err := WithdrawQuery(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	r.update(resp.OutTradeNo, resp.WithdrawTradeNo, resp.Status)
+	return resp, nil
+}
+
+// 以已知的单号匹配，任一单号为空时只比较另一个
+func (r *WithdrawResult) match(outTradeNo, withdrawTradeNo string) bool {
+	if r.WithdrawTradeNo != "" && withdrawTradeNo != "" {
+		return r.WithdrawTradeNo == withdrawTradeNo
+	}
+	return r.OutTradeNo != "" && r.OutTradeNo == outTradeNo
+}
+
+func (r *WithdrawResult) update(outTradeNo, withdrawTradeNo, status string) {
+	r.OutTradeNo = firstNonEmpty(r.OutTradeNo, outTradeNo)
+	r.WithdrawTradeNo = firstNonEmpty(r.WithdrawTradeNo, withdrawTradeNo)
+	// 已有最终结果时不再被乱序到达的中间状态覆盖
+	if status != "" && !r.Done() {
+		r.Status = status
+	}
+}
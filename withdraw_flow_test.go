@@ -0,0 +1,100 @@
+package tt_pay
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/liaoxxxx/tt_pay/consts"
+)
+
+func TestStartWithdrawWithoutLogin(t *testing.T) {
+	ts, calls := newRoutedGateway(t, map[string]string{
+		consts.MethodWithdrawCreate + ":w_order_1": `{"response":{"code":"10000","msg":"Success","withdraw_trade_no":"wt_1"}}`,
+		consts.MethodWithdrawQuery + ":w_order_1": `{"response":{"code":"10000","msg":"Success","out_trade_no":"w_order_1",` +
+			`"withdraw_trade_no":"wt_1","status":"SUCCESS"}}`,
+	})
+	req := validWithdrawCreateRequest(false)
+	req.Config = testConfig(ts.URL)
+	result, err := StartWithdraw(context.Background(), req, WithdrawWithoutLogin, WithdrawExts{OpenId: "open_1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.WithdrawTradeNo != "wt_1" || !result.Signed || result.Status != "" {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if !strings.Contains(result.SdkParams, `"withdraw_trade_no":"wt_1"`) || !strings.Contains(result.SdkParams, "openid") {
+		t.Errorf("unexpected sdk params %s", result.SdkParams)
+	}
+	if !strings.HasPrefix(result.H5Url, ts.URL+"/redPacketWithdraw?") {
+		t.Errorf("unexpected h5 url %s", result.H5Url)
+	}
+
+	if _, err := result.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !result.Done() || result.Status != consts.WithdrawStatusSuccess {
+		t.Fatalf("expected success, got %+v", result)
+	}
+	// 最终结果不被中间状态覆盖
+	result.ApplyNotify(&WithdrawNotifyResponse{MerchantId: "merchant_1", WithdrawTradeNo: "wt_1", WithdrawStatus: consts.WithdrawStatusProcessing})
+	if result.Status != consts.WithdrawStatusSuccess {
+		t.Errorf("final status overwritten: %s", result.Status)
+	}
+	if calls[consts.MethodWithdrawCreate+":w_order_1"] != 1 {
+		t.Errorf("unexpected calls %v", calls)
+	}
+}
+
+func TestStartWithdrawWithLogin(t *testing.T) {
+	req := validWithdrawCreateRequest(true)
+	req.Config = testConfig("http://127.0.0.1:0")
+
+	// 登录态未传金额和openid时不加签，且不调用网关
+	result, err := StartWithdraw(context.Background(), req, WithdrawWithLogin, WithdrawExts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Signed || result.WithdrawTradeNo != "" || strings.Contains(result.SdkParams, `"sign"`) {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	// Extra中的键值含openid字样不影响加签，且不修改调用方的请求
+	req = validWithdrawCreateRequest(false)
+	req.TotalAmount = 0
+	result, err = StartWithdraw(context.Background(), req, WithdrawWithLogin, WithdrawExts{Extra: map[string]interface{}{"openid_hint": "openid"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Signed || req.WithLogin || req.Exts != "" {
+		t.Fatalf("unexpected result %+v, request %+v", result, req)
+	}
+
+	// Exts中直接携带openid时同样需要加签
+	req = validWithdrawCreateRequest(true)
+	req.Exts = `{"openid":"open_0"}`
+	if result, err = StartWithdraw(context.Background(), req, WithdrawWithLogin, WithdrawExts{}); err != nil || !result.Signed {
+		t.Fatalf("expected signed params with exts openid, result %+v err %v", result, err)
+	}
+
+	req = validWithdrawCreateRequest(true)
+	req.OutTradeNo = "w_order_2"
+	result, err = StartWithdraw(context.Background(), req, WithdrawWithLogin, WithdrawExts{OpenId: "open_1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Signed {
+		t.Fatal("expected signed params with openid")
+	}
+	if req.OpenId != "" || req.Exts != "" {
+		t.Fatalf("request modified %+v", req)
+	}
+	if result.ApplyNotify(&WithdrawNotifyResponse{MerchantId: "merchant_1", OutTradeNo: "w_order_3", WithdrawStatus: "SUCCESS"}) {
+		t.Fatal("applied notify of other withdraw")
+	}
+	if !result.ApplyNotify(&WithdrawNotifyResponse{MerchantId: "merchant_1", OutTradeNo: "w_order_2", WithdrawTradeNo: "wt_2", WithdrawStatus: "FAIL"}) {
+		t.Fatal("expected notify applied")
+	}
+	if result.WithdrawTradeNo != "wt_2" || result.Status != consts.WithdrawStatusFail || !result.Done() {
+		t.Fatalf("unexpected result %+v", result)
+	}
+}
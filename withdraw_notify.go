@@ -2,15 +2,25 @@ package tt_pay
 
 import (
 	"context"
-	"errors"
 	"net/url"
 
 	"github.com/liaoxxxx/tt_pay/consts"
+	"github.com/liaoxxxx/tt_pay/store"
 	"github.com/liaoxxxx/tt_pay/util"
 )
 
 // 提现回调接口
 func WithdrawNotify(ctx context.Context, req *WithdrawNotifyRequest) (*WithdrawNotifyResponse, error) {
+	ctx, span := tracer.Start(ctx, spanNotify)
+	resp, err := withdrawNotify(ctx, req)
+	if err == nil {
+		recordOrder(ctx, resp.storeOrder(), store.SourceNotify)
+	}
+	finishNotify(span, consts.NotifyTypeWithdraw, resp, err)
+	return resp, err
+}
+
+func withdrawNotify(ctx context.Context, req *WithdrawNotifyRequest) (*WithdrawNotifyResponse, error) {
 	params, err := url.ParseQuery(req.Param)
 
 	if err != nil {
@@ -31,8 +41,8 @@ func WithdrawNotify(ctx context.Context, req *WithdrawNotifyRequest) (*WithdrawN
 
 	sign := resp.Get("sign")
 
-	if valid := util.VerifyMd5WithRsa(signMap, sign, consts.TtPayPublicKey); !valid {
-		return nil, errors.New("Invalid sign")
+	if valid := util.VerifyMd5WithRsa(signMap, sign, notifyPublicKey(req.PublicKey)); !valid {
+		return nil, util.ErrInvalidSign
 	}
 
 	return resp, nil
@@ -40,7 +50,8 @@ func WithdrawNotify(ctx context.Context, req *WithdrawNotifyRequest) (*WithdrawN
 
 // 提现回调请求
 type WithdrawNotifyRequest struct {
-	Param string
+	Param     string
+	PublicKey string // 验签公钥，为空时使用consts.TtPayPublicKey
 }
 
 // SetParam 将回调的param参数赋值给该实例成员变量
@@ -58,7 +69,7 @@ type WithdrawNotifyResponse struct {
 	OutTradeNo      string
 	WithdrawTradeNo string
 	Amount          string
-	WithdrawTime    string
+	WithdrawTime    GatewayTime
 	WithdrawStatus  string
 	TradeMsg        string
 	Extension       string `json:"extension"`
@@ -73,7 +84,8 @@ func (resp *WithdrawNotifyResponse) Decode() {
 	resp.OutTradeNo = resp.Get("out_trade_no")
 	resp.WithdrawTradeNo = resp.Get("withdraw_trade_no")
 	resp.Amount = resp.Get("amount")
-	resp.WithdrawTime = resp.Get("withdraw_time")
+	// 格式无法识别时为零值，原始值可通过Get获取
+	resp.WithdrawTime, _ = ParseGatewayTime(resp.Get("withdraw_time"))
 	resp.WithdrawStatus = resp.Get("withdraw_status")
 	resp.TradeMsg = resp.Get("trade_msg")
 	resp.Extension = resp.Get("extension")
@@ -83,3 +95,22 @@ func (resp *WithdrawNotifyResponse) Decode() {
 func (resp *WithdrawNotifyResponse) Get(key string) string {
 	return resp.Param[key]
 }
+
+// 订单号，用于链路追踪
+func (resp *WithdrawNotifyResponse) orderAttributes() map[string]string {
+	return map[string]string{
+		"out_trade_no": resp.OutTradeNo,
+	}
+}
+
+// 订单存储记录
+func (resp *WithdrawNotifyResponse) storeOrder() *store.Order {
+	return &store.Order{
+		Kind:       store.KindWithdraw,
+		MerchantId: resp.MerchantId,
+		OutNo:      resp.OutTradeNo,
+		TradeNo:    resp.WithdrawTradeNo,
+		Amount:     parseAmount(resp.Amount),
+		Status:     resp.WithdrawStatus,
+	}
+}
@@ -0,0 +1,121 @@
+package tt_pay
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/liaoxxxx/tt_pay/consts"
+	"github.com/liaoxxxx/tt_pay/util"
+)
+
+// WithdrawType 为提现到账方式，未收录的值原样保留
+// 以下取值未见于网关文档，为按线上响应整理，未经确认，不能用于拒绝未知值
+type WithdrawType string
+
+const (
+	WithdrawTypeAlipay   WithdrawType = "ALIPAY"   // 支付宝
+	WithdrawTypeWechat   WithdrawType = "WX"       // 微信
+	WithdrawTypeBankCard WithdrawType = "BANKCARD" // 银行卡
+)
+
+// Known 是否为已收录的提现方式，未收录不代表网关不支持
+func (t WithdrawType) Known() bool {
+	switch t {
+	case WithdrawTypeAlipay, WithdrawTypeWechat, WithdrawTypeBankCard:
+		return true
+	}
+	return false
+}
+
+// AccountType 为提现下单时指定的收款账户类型，未收录的值原样发送给网关
+// 以下取值未见于网关文档，未经确认，仅作为常用值的便捷写法
+type AccountType string
+
+const (
+	AccountTypeAlipay   AccountType = "ALIPAY"   // 支付宝账户
+	AccountTypeWechat   AccountType = "WX"       // 微信账户
+	AccountTypeBankCard AccountType = "BANKCARD" // 银行卡
+)
+
+// Known 是否为已收录的账户类型，未收录不代表网关不支持
+func (t AccountType) Known() bool {
+	switch t {
+	case AccountTypeAlipay, AccountTypeWechat, AccountTypeBankCard:
+		return true
+	}
+	return false
+}
+
+// WithdrawErrorCode 为提现失败的错误码（err_code），未收录的值原样保留
+// 以下取值与分类未见于网关文档，为按线上响应整理，未经确认；以财经侧文档为准，可通过RegisterWithdrawErrorCode修正
+type WithdrawErrorCode string
+
+const (
+	WithdrawErrAccountNotExist  WithdrawErrorCode = "ACCOUNT_NOT_EXIST"  // 收款账户不存在
+	WithdrawErrAccountFrozen    WithdrawErrorCode = "ACCOUNT_FROZEN"     // 收款账户被冻结
+	WithdrawErrNameMismatch     WithdrawErrorCode = "NAME_MISMATCH"      // 收款人姓名与账户不一致
+	WithdrawErrExceedLimit      WithdrawErrorCode = "EXCEED_LIMIT"       // 超出提现限额
+	WithdrawErrBalanceNotEnough WithdrawErrorCode = "BALANCE_NOT_ENOUGH" // 商户余额不足
+	WithdrawErrSystem           WithdrawErrorCode = "SYSTEM_ERROR"       // 系统错误，可使用新单号重新发起
+)
+
+var (
+	withdrawErrorLock sync.RWMutex
+
+	// 预置的错误码分类，未经确认，未收录的按util.CategoryUnknown（不可重试）处理
+	withdrawErrorCategories = map[WithdrawErrorCode]util.Category{
+		WithdrawErrAccountNotExist:  util.CategoryBusiness,
+		WithdrawErrAccountFrozen:    util.CategoryBusiness,
+		WithdrawErrNameMismatch:     util.CategoryInvalidParam,
+		WithdrawErrExceedLimit:      util.CategoryBusiness,
+		WithdrawErrBalanceNotEnough: util.CategoryInsufficientBalance,
+		WithdrawErrSystem:           util.CategorySystem,
+	}
+)
+
+// RegisterWithdrawErrorCode 收录提现错误码的分类，已存在时覆盖
+func RegisterWithdrawErrorCode(code WithdrawErrorCode, c util.Category) {
+	withdrawErrorLock.Lock()
+	defer withdrawErrorLock.Unlock()
+	withdrawErrorCategories[code] = c
+}
+
+// UnregisterWithdrawErrorCode 移除已收录的提现错误码，包括预置的错误码
+func UnregisterWithdrawErrorCode(code WithdrawErrorCode) {
+	withdrawErrorLock.Lock()
+	defer withdrawErrorLock.Unlock()
+	delete(withdrawErrorCategories, code)
+}
+
+// Category 返回错误码的分类
+func (c WithdrawErrorCode) Category() util.Category {
+	withdrawErrorLock.RLock()
+	defer withdrawErrorLock.RUnlock()
+	if cat, ok := withdrawErrorCategories[c]; ok {
+		return cat
+	}
+	return util.CategoryUnknown
+}
+
+// WithdrawError 为提现失败的原因，由WithdrawQueryResponse.Err返回
+// errors.Is可按错误码的分类匹配，如util.ErrInsufficientBalance
+type WithdrawError struct {
+	Code WithdrawErrorCode
+	Msg  string
+}
+
+func (e *WithdrawError) Error() string {
+	return fmt.Sprintf("tt_pay: withdraw failed: %s %s", e.Code, e.Msg)
+}
+
+func (e *WithdrawError) Is(target error) bool {
+	return e.Code.Category().Matches(target)
+}
+
+// Err 提现失败（状态为FAIL或返回了err_code）时返回*WithdrawError，其余情况返回nil
+func (resp *WithdrawQueryResponse) Err() error {
+	if resp.Status != consts.WithdrawStatusFail && resp.ErrorCode == "" {
+		return nil
+	}
+	return &WithdrawError{Code: resp.ErrorCode, Msg: resp.ErrMsg}
+}
@@ -0,0 +1,117 @@
+package tt_pay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/liaoxxxx/tt_pay/util"
+)
+
+func TestWithdrawQueryTypedFields(t *testing.T) {
+	ts := newStubGateway(t, `{"response":{"code":"10000","msg":"Success","withdraw_trade_no":"wt_1","status":"FAIL",`+
+		`"withdraw_type":"ALIPAY","account":"`+testAccount+`","name":"`+testName+`","validity_seconds":"3600",`+
+		`"err_code":"BALANCE_NOT_ENOUGH","err_msg":"balance not enough"}}`)
+	req := NewWithdrawQueryRequest(testConfig(ts.URL))
+	req.OutTradeNo = "w_order_1"
+	resp, err := WithdrawQuery(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.WithdrawType != WithdrawTypeAlipay || !resp.WithdrawType.Known() {
+		t.Errorf("unexpected withdraw type %q", resp.WithdrawType)
+	}
+	if resp.ValiditySeconds.Duration != time.Hour {
+		t.Errorf("unexpected validity %v", resp.ValiditySeconds)
+	}
+	if string(resp.Account) != testAccount || string(resp.Name) != testName {
+		t.Errorf("decoded values changed: %q %q", string(resp.Account), string(resp.Name))
+	}
+
+	// Data为原始响应，不在脱敏范围内
+	typed := *resp
+	typed.Data = nil
+	b, err := json.Marshal(typed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(b) + fmt.Sprintf("%v %+v %#v", resp, resp, resp)
+	for _, secret := range []string{testAccount, testName} {
+		if strings.Contains(out, secret) {
+			t.Errorf("output leaks %q:\n%s", secret, out)
+		}
+	}
+	if !strings.Contains(string(b), `"validity_seconds":"3600"`) {
+		t.Errorf("unexpected json %s", b)
+	}
+
+	err = resp.Err()
+	var we *WithdrawError
+	if !errors.As(err, &we) || we.Code != WithdrawErrBalanceNotEnough {
+		t.Fatalf("expected WithdrawError, got %v", err)
+	}
+	if !errors.Is(err, util.ErrInsufficientBalance) || errors.Is(err, util.ErrRetryable) {
+		t.Errorf("unexpected categories for %v", err)
+	}
+	if !errors.Is(&WithdrawError{Code: WithdrawErrSystem}, util.ErrRetryable) {
+		t.Error("SYSTEM_ERROR should be retryable")
+	}
+	if (&WithdrawQueryResponse{Status: "SUCCESS"}).Err() != nil {
+		t.Error("expected nil error for successful withdraw")
+	}
+}
+
+func TestRegisterWithdrawErrorCode(t *testing.T) {
+	const code WithdrawErrorCode = "RISK_REJECT"
+	if code.Category() != util.CategoryUnknown || errors.Is(&WithdrawError{Code: code}, util.ErrRetryable) {
+		t.Fatalf("unexpected category %s", code.Category())
+	}
+	RegisterWithdrawErrorCode(code, util.CategorySystem)
+	defer UnregisterWithdrawErrorCode(code)
+	if !errors.Is(&WithdrawError{Code: code}, util.ErrRetryable) {
+		t.Errorf("expected registered code retryable")
+	}
+
+	// 预置的分类可被覆盖
+	RegisterWithdrawErrorCode(WithdrawErrSystem, util.CategoryBusiness)
+	defer RegisterWithdrawErrorCode(WithdrawErrSystem, util.CategorySystem)
+	if WithdrawErrSystem.Category() != util.CategoryBusiness {
+		t.Errorf("unexpected category %s", WithdrawErrSystem.Category())
+	}
+}
+
+func TestWithdrawCreateAccountType(t *testing.T) {
+	req := validWithdrawCreateRequest(false)
+	req.AccountType = AccountTypeBankCard
+	if err := req.checkParams(); err != nil {
+		t.Fatal(err)
+	}
+	// 未收录的账户类型交由网关判断
+	req.AccountType = "CARD"
+	if err := req.checkParams(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := req.Encode(); err != nil {
+		t.Fatal(err)
+	}
+	if got := req.bizContent.Get("account_type").Interface(); got != AccountType("CARD") {
+		t.Errorf("account_type = %v", got)
+	}
+}
+
+func TestDurationSecondsUnmarshal(t *testing.T) {
+	for in, want := range map[string]time.Duration{`"60"`: time.Minute, `120`: 2 * time.Minute, `""`: 0, `null`: 0} {
+		var d DurationSeconds
+		if err := json.Unmarshal([]byte(in), &d); err != nil || d.Duration != want {
+			t.Errorf("Unmarshal(%s) = %v, %v; want %v", in, d, err, want)
+		}
+	}
+	var d DurationSeconds
+	if err := json.Unmarshal([]byte(`"1h"`), &d); err == nil {
+		t.Error("expected error for invalid seconds")
+	}
+}